@@ -0,0 +1,343 @@
+package avroipc
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned by clients protected by a circuit breaker
+// instead of sending a request while the circuit is open.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// The number of buckets the failure ratio window is split into.
+const breakerBuckets = 10
+
+// BreakerState is a state of a circuit breaker.
+type BreakerState int
+
+const (
+	// Requests are passed through and their results are counted.
+	StateClosed BreakerState = iota
+	// Requests are rejected with the ErrCircuitOpen error.
+	StateOpen
+	// A limited number of trial requests is passed through to check
+	// whether the remote side has recovered.
+	StateHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// BreakerConfig provides a configuration for the circuit breaker.
+type BreakerConfig struct {
+	// A duration of the sliding window that is used to calculate the failure
+	// ratio in the closed state.
+	//
+	// Defaults to zero which means 10 seconds.
+	Window time.Duration
+
+	// A minimum number of requests in the window required to open the
+	// circuit. It protects against opening the circuit by a single failure
+	// after a quiet period.
+	//
+	// Defaults to zero which means 10 requests.
+	MinRequests int
+
+	// A ratio of failed requests in the window from 0 to 1 that opens the
+	// circuit.
+	//
+	// Defaults to zero which means 0.5.
+	FailureRatio float64
+
+	// A duration of the open state after which the circuit becomes
+	// half-open.
+	//
+	// Defaults to zero which means 5 seconds.
+	Cooldown time.Duration
+
+	// A number of successful trial requests in the half-open state required
+	// to close the circuit. Only this number of requests is passed through
+	// concurrently in the half-open state, any failed one opens the circuit
+	// again.
+	//
+	// Defaults to zero which means a single request.
+	HalfOpenRequests int
+
+	// Used to decide whether an error returned by a request is a failure.
+	//
+	// Defaults to nil which means that all errors are failures.
+	IsFailure func(err error) bool
+
+	// Called synchronously on every state change of the circuit breaker. It
+	// is called without holding the lock of the circuit breaker, so it may
+	// call its methods, e.g. State.
+	//
+	// Defaults to nil.
+	OnStateChange func(from, to BreakerState)
+}
+
+type breakerBucket struct {
+	start    time.Time
+	requests int
+	failures int
+}
+
+// CircuitBreaker implements the circuit breaker pattern. It counts results of
+// requests and rejects new ones for a while when too many of them failed.
+//
+// A single instance is safe for concurrent use and may be shared between
+// several clients talking to the same remote endpoint.
+type CircuitBreaker struct {
+	mu sync.Mutex
+
+	config BreakerConfig
+	now    func() time.Time
+
+	state    BreakerState
+	openedAt time.Time
+	buckets  []breakerBucket
+
+	// Incremented on every state change to ignore results of requests
+	// started in a previous state.
+	generation uint64
+	inFlight   int
+	successes  int
+
+	// State changes made under the lock that are reported to the callback
+	// after releasing it.
+	changes []breakerChange
+}
+
+type breakerChange struct {
+	from, to BreakerState
+}
+
+// NewCircuitBreaker creates a circuit breaker in the closed state with
+// considering values of options from the passed configuration object.
+func NewCircuitBreaker(config *BreakerConfig) *CircuitBreaker {
+	b := &CircuitBreaker{
+		config: *config,
+		now:    time.Now,
+	}
+
+	if b.config.Window <= 0 {
+		b.config.Window = 10 * time.Second
+	}
+	if b.config.MinRequests <= 0 {
+		b.config.MinRequests = 10
+	}
+	if b.config.FailureRatio <= 0 {
+		b.config.FailureRatio = 0.5
+	}
+	if b.config.Cooldown <= 0 {
+		b.config.Cooldown = 5 * time.Second
+	}
+	if b.config.HalfOpenRequests <= 0 {
+		b.config.HalfOpenRequests = 1
+	}
+
+	return b
+}
+
+// State returns the current state of the circuit breaker.
+func (b *CircuitBreaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.unlock()
+
+	b.checkCooldown(b.now())
+	return b.state
+}
+
+// Do calls the passed function if the circuit breaker allows it and counts
+// the result of the call. The ErrCircuitOpen error is returned without
+// calling the function if the circuit is open.
+func (b *CircuitBreaker) Do(fn func() error) error {
+	generation, err := b.before()
+	if err != nil {
+		return err
+	}
+
+	err = fn()
+	b.after(generation, err)
+
+	return err
+}
+
+func (b *CircuitBreaker) before() (uint64, error) {
+	b.mu.Lock()
+	defer b.unlock()
+
+	b.checkCooldown(b.now())
+
+	switch b.state {
+	case StateOpen:
+		return 0, ErrCircuitOpen
+	case StateHalfOpen:
+		if b.inFlight+b.successes >= b.config.HalfOpenRequests {
+			return 0, ErrCircuitOpen
+		}
+		b.inFlight++
+	}
+
+	return b.generation, nil
+}
+
+func (b *CircuitBreaker) after(generation uint64, err error) {
+	b.mu.Lock()
+	defer b.unlock()
+
+	if generation != b.generation {
+		return
+	}
+
+	now := b.now()
+	failed := b.isFailure(err)
+
+	switch b.state {
+	case StateClosed:
+		b.count(now, failed)
+
+		requests, failures := b.totals(now)
+		if requests >= b.config.MinRequests && float64(failures) >= b.config.FailureRatio*float64(requests) {
+			b.setState(StateOpen, now)
+		}
+	case StateHalfOpen:
+		b.inFlight--
+		if failed {
+			b.setState(StateOpen, now)
+			return
+		}
+
+		b.successes++
+		if b.successes >= b.config.HalfOpenRequests {
+			b.setState(StateClosed, now)
+		}
+	}
+}
+
+func (b *CircuitBreaker) isFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+	if b.config.IsFailure != nil {
+		return b.config.IsFailure(err)
+	}
+
+	return true
+}
+
+func (b *CircuitBreaker) checkCooldown(now time.Time) {
+	if b.state == StateOpen && now.Sub(b.openedAt) >= b.config.Cooldown {
+		b.setState(StateHalfOpen, now)
+	}
+}
+
+func (b *CircuitBreaker) setState(state BreakerState, now time.Time) {
+	prev := b.state
+
+	b.state = state
+	b.generation++
+	b.buckets = b.buckets[:0]
+	b.inFlight = 0
+	b.successes = 0
+	if state == StateOpen {
+		b.openedAt = now
+	}
+
+	if b.config.OnStateChange != nil {
+		b.changes = append(b.changes, breakerChange{from: prev, to: state})
+	}
+}
+
+// unlock releases the lock and reports state changes made under it.
+func (b *CircuitBreaker) unlock() {
+	changes := b.changes
+	b.changes = nil
+	b.mu.Unlock()
+
+	for _, c := range changes {
+		b.config.OnStateChange(c.from, c.to)
+	}
+}
+
+// count adds a result of a request to the current bucket of the window.
+func (b *CircuitBreaker) count(now time.Time, failed bool) {
+	size := b.config.Window / breakerBuckets
+
+	n := len(b.buckets)
+	if n == 0 || now.Sub(b.buckets[n-1].start) >= size {
+		b.buckets = append(b.buckets, breakerBucket{start: now})
+		n++
+	}
+
+	b.buckets[n-1].requests++
+	if failed {
+		b.buckets[n-1].failures++
+	}
+}
+
+// totals removes expired buckets and returns the number of requests and
+// failures in the window.
+func (b *CircuitBreaker) totals(now time.Time) (requests, failures int) {
+	i := 0
+	for i < len(b.buckets) && now.Sub(b.buckets[i].start) >= b.config.Window {
+		i++
+	}
+	b.buckets = append(b.buckets[:0], b.buckets[i:]...)
+
+	for _, bucket := range b.buckets {
+		requests += bucket.requests
+		failures += bucket.failures
+	}
+
+	return
+}
+
+type breakerClient struct {
+	client  Client
+	breaker *CircuitBreaker
+}
+
+// NewBreakerClient wraps the passed client with the circuit breaker. The
+// wrapped client returns the ErrCircuitOpen error without sending a message
+// while the circuit is open.
+func NewBreakerClient(client Client, breaker *CircuitBreaker) Client {
+	return &breakerClient{
+		client:  client,
+		breaker: breaker,
+	}
+}
+
+func (c *breakerClient) Close() error {
+	return c.client.Close()
+}
+
+func (c *breakerClient) SendMessage(method string, datum interface{}) (status string, err error) {
+	err = c.breaker.Do(func() error {
+		status, err = c.client.SendMessage(method, datum)
+		return err
+	})
+
+	return
+}
+
+func (c *breakerClient) SendMessageContext(ctx context.Context, method string, datum interface{}) (status string, err error) {
+	err = c.breaker.Do(func() error {
+		status, err = SendMessageContext(ctx, c.client, method, datum)
+		return err
+	})
+
+	return
+}
@@ -0,0 +1,161 @@
+package avroipc
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/myzhan/avroipc/flume/mocks"
+
+	"github.com/stretchr/testify/require"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) Add(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func prepareBreaker(config *BreakerConfig) (*CircuitBreaker, *fakeClock, *[]string) {
+	changes := &[]string{}
+	config.OnStateChange = func(from, to BreakerState) {
+		*changes = append(*changes, from.String()+"->"+to.String())
+	}
+
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	b := NewCircuitBreaker(config)
+	b.now = clock.Now
+
+	return b, clock, changes
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	testErr := errors.New("test error")
+	succeed := func() error { return nil }
+	failed := func() error { return testErr }
+
+	t.Run("stays closed below min requests", func(t *testing.T) {
+		b, _, changes := prepareBreaker(&BreakerConfig{MinRequests: 3})
+
+		require.EqualError(t, b.Do(failed), "test error")
+		require.EqualError(t, b.Do(failed), "test error")
+		require.Equal(t, StateClosed, b.State())
+		require.Empty(t, *changes)
+	})
+
+	t.Run("opens on failure ratio", func(t *testing.T) {
+		b, _, changes := prepareBreaker(&BreakerConfig{MinRequests: 4, FailureRatio: 0.5})
+
+		require.NoError(t, b.Do(succeed))
+		require.NoError(t, b.Do(succeed))
+		require.EqualError(t, b.Do(failed), "test error")
+		require.Equal(t, StateClosed, b.State())
+		require.EqualError(t, b.Do(failed), "test error")
+		require.Equal(t, StateOpen, b.State())
+
+		called := false
+		err := b.Do(func() error {
+			called = true
+			return nil
+		})
+		require.Equal(t, ErrCircuitOpen, err)
+		require.False(t, called)
+		require.Equal(t, []string{"closed->open"}, *changes)
+	})
+
+	t.Run("forgets old results", func(t *testing.T) {
+		b, clock, _ := prepareBreaker(&BreakerConfig{Window: time.Second, MinRequests: 2})
+
+		require.EqualError(t, b.Do(failed), "test error")
+		clock.Add(time.Second)
+		require.EqualError(t, b.Do(failed), "test error")
+		require.Equal(t, StateClosed, b.State())
+		require.EqualError(t, b.Do(failed), "test error")
+		require.Equal(t, StateOpen, b.State())
+	})
+
+	t.Run("closes after successful trials", func(t *testing.T) {
+		b, clock, changes := prepareBreaker(&BreakerConfig{MinRequests: 1, Cooldown: time.Second, HalfOpenRequests: 2})
+
+		require.EqualError(t, b.Do(failed), "test error")
+		clock.Add(time.Second)
+		require.Equal(t, StateHalfOpen, b.State())
+
+		err := b.Do(func() error {
+			// Only a limited number of concurrent trials is allowed.
+			require.NoError(t, b.Do(succeed))
+			require.Equal(t, ErrCircuitOpen, b.Do(succeed))
+			return nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, StateClosed, b.State())
+		require.Equal(t, []string{"closed->open", "open->half-open", "half-open->closed"}, *changes)
+	})
+
+	t.Run("opens again after failed trial", func(t *testing.T) {
+		b, clock, changes := prepareBreaker(&BreakerConfig{MinRequests: 1, Cooldown: time.Second})
+
+		require.EqualError(t, b.Do(failed), "test error")
+		clock.Add(time.Second)
+		require.EqualError(t, b.Do(failed), "test error")
+		require.Equal(t, StateOpen, b.State())
+		require.Equal(t, []string{"closed->open", "open->half-open", "half-open->open"}, *changes)
+	})
+
+	t.Run("custom failure classifier", func(t *testing.T) {
+		b, _, _ := prepareBreaker(&BreakerConfig{
+			MinRequests: 1,
+			IsFailure: func(err error) bool {
+				return err != testErr
+			},
+		})
+
+		require.EqualError(t, b.Do(failed), "test error")
+		require.Equal(t, StateClosed, b.State())
+	})
+}
+
+func TestCircuitBreaker_OnStateChange(t *testing.T) {
+	var states []BreakerState
+
+	var b *CircuitBreaker
+	b = NewCircuitBreaker(&BreakerConfig{
+		MinRequests: 1,
+		OnStateChange: func(from, to BreakerState) {
+			// The callback may call methods of the circuit breaker.
+			states = append(states, b.State())
+		},
+	})
+
+	require.EqualError(t, b.Do(func() error { return errors.New("test error") }), "test error")
+	require.Equal(t, []BreakerState{StateOpen}, states)
+}
+
+func TestBreakerClient(t *testing.T) {
+	method := "append"
+	datum := "test data"
+
+	x := &mocks.MockClient{}
+	b, _, _ := prepareBreaker(&BreakerConfig{MinRequests: 1})
+	c := NewBreakerClient(x, b)
+
+	x.On("SendMessage", method, datum).Return("", errors.New("test error")).Once()
+	x.On("Close").Return(nil).Once()
+
+	status, err := c.SendMessage(method, datum)
+	require.EqualError(t, err, "test error")
+	require.Equal(t, "", status)
+
+	status, err = c.SendMessage(method, datum)
+	require.Equal(t, ErrCircuitOpen, err)
+	require.Equal(t, "", status)
+
+	require.NoError(t, c.Close())
+	x.AssertExpectations(t)
+}
@@ -1,27 +1,97 @@
 package avroipc
 
 import (
+	"context"
 	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"sync"
 	"time"
 
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
 	"github.com/myzhan/avroipc/layers"
+	"github.com/myzhan/avroipc/logger"
 	"github.com/myzhan/avroipc/protocols"
 	"github.com/myzhan/avroipc/transports"
 )
 
+// A ping request consists of empty call metadata and an empty message name.
+// Avro servers answer such requests with an empty response without calling
+// any message.
+//
+// See http://avro.apache.org/docs/1.8.2/spec.html#handshake for details.
+var pingRequest = []byte{0x00, 0x00}
+
+// DebugEnv is a name of an environment variable that enables the debug layer
+// for all clients regardless of the Debug option of their configurations.
+// Any value accepted by strconv.ParseBool as true enables it.
+const DebugEnv = "AVROIPC_DEBUG"
+
 // An avro client implementation
 type Client interface {
 	Close() error
 	SendMessage(method string, datum interface{}) (string, error)
 }
 
+// ContextClient is an optional interface of clients that are able to send
+// messages with a context. Clients created by this package implement it.
+type ContextClient interface {
+	// SendMessageContext sends a message in the same way as SendMessage but
+	// uses the passed context as a parent of tracing spans and propagates its
+	// trace context to the server in the call metadata. The deadline of the
+	// context limits reading and writing operations in the same way as the
+	// SendTimeout option.
+	SendMessageContext(ctx context.Context, method string, datum interface{}) (string, error)
+}
+
+// SendMessageContext sends a message with the passed context if the client
+// implements the ContextClient interface. Otherwise, it checks the context
+// only before sending the message with the SendMessage method.
+func SendMessageContext(ctx context.Context, c Client, method string, datum interface{}) (string, error) {
+	if cc, ok := c.(ContextClient); ok {
+		return cc.SendMessageContext(ctx, method, datum)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	return c.SendMessage(method, datum)
+}
+
 type client struct {
+	mu sync.Mutex
+
+	addr   string
+	proto  protocols.MessageProtocol
+	config *Config
+
 	sendTimeout time.Duration
+	retryPolicy *RetryPolicy
+	metrics     Metrics
+	tracer      trace.Tracer
+	propagator  propagation.TextMapPropagator
+	logger      logger.Logger
+	debugLogger logger.Logger
 
 	transport         transports.Transport
+	counter           *transports.Counting
 	framingLayer      layers.FramingLayer
 	callProtocol      protocols.CallProtocol
 	handshakeProtocol protocols.HandshakeProtocol
+
+	// The connection is considered broken after any transport error because
+	// the state of the stream is unknown at that moment. A broken connection
+	// is reestablished before sending the next request.
+	broken   bool
+	lastSend time.Time
+	done     chan struct{}
+	// A closed client neither sends requests nor reconnects, so no new
+	// connections are left open after closing it.
+	closed bool
 }
 
 // NewClient creates an avro client with considering values of options from
@@ -30,31 +100,74 @@ type client struct {
 //
 // This constructor supposed to be used in production environments.
 func NewClientWithConfig(addr string, proto protocols.MessageProtocol, config *Config) (Client, error) {
-	c := &client{}
+	c := &client{
+		addr:   addr,
+		proto:  proto,
+		config: config,
+		done:   make(chan struct{}),
+	}
 	c.sendTimeout = config.SendTimeout
+	c.retryPolicy = config.RetryPolicy
+	c.metrics = config.Metrics
+	c.logger = logger.OrNop(config.Logger).With("addr", addr)
+	c.initDebug(config)
+	c.initTracing(config)
 
-	err := c.initTransports(addr, config)
+	err := c.connect(context.Background())
 	if err != nil {
+		if c.transport != nil {
+			_ = c.transport.Close()
+		}
 		return nil, err
 	}
 
-	c.initProtocols(proto)
-	return c, c.handshake()
+	if config.PingInterval > 0 {
+		go c.keepAlive(c.done, config.PingInterval)
+	}
+
+	return c, nil
+}
+
+func (c *client) connect(ctx context.Context) error {
+	err := c.initTransports(c.addr, c.config)
+	if err != nil {
+		return err
+	}
+
+	c.initProtocols(c.proto, c.config)
+	return c.handshake(ctx)
 }
 
-func (c *client) initProtocols(proto protocols.MessageProtocol) {
+func (c *client) initProtocols(proto protocols.MessageProtocol, config *Config) {
 	// All errors here are only related to compilations of Avro schemas
 	// and are not possible at runtime because they will be caught by unit tests.
-	c.framingLayer = layers.NewFraming(c.transport)
+	c.framingLayer = layers.NewFramingWithConfig(c.transport, &layers.FramingConfig{
+		FrameSize:       config.FrameSize,
+		MaxFrames:       config.MaxFrames,
+		MaxResponseSize: config.MaxResponseSize,
+		Logger:          c.logger,
+	})
 	c.callProtocol, _ = protocols.NewCall(proto)
-	c.handshakeProtocol, _ = protocols.NewHandshake(proto)
+	c.handshakeProtocol, _ = protocols.NewHandshakeWithLogger(proto, c.logger)
 }
 
 func (c *client) initTransports(addr string, config *Config) (err error) {
-
-	c.transport, err = transports.NewSocket(addr, config.Timeout)
+	if config.Dialer != nil {
+		c.transport, err = config.Dialer(addr)
+	} else {
+		c.transport, err = transports.NewSocketWithConfig(addr, &transports.SocketConfig{
+			Timeout:   config.Timeout,
+			KeepAlive: config.KeepAlive,
+			Logger:    c.logger,
+		})
+	}
 	if err != nil {
-		return err
+		return &TransportError{Err: err}
+	}
+
+	if config.Metrics != nil {
+		c.counter = transports.NewCounting(c.transport)
+		c.transport = c.counter
 	}
 
 	if config.CompressionLevel > 0 {
@@ -67,7 +180,7 @@ func (c *client) initTransports(addr string, config *Config) (err error) {
 	if config.TLSConfig != nil {
 		c.transport, err = transports.NewTLS(c.transport, config.TLSConfig)
 		if err != nil {
-			return err
+			return &TransportError{Err: err}
 		}
 	}
 
@@ -75,50 +188,139 @@ func (c *client) initTransports(addr string, config *Config) (err error) {
 		c.transport = transports.NewBuffered(c.transport, config.BufferSize)
 	}
 
+	// The debug layer must be right under the framing layer to see requests
+	// and responses before compression and encryption.
+	if c.debugLogger != nil {
+		c.transport = layers.NewDebug(c.transport, &layers.DebugConfig{
+			Logger:   c.debugLogger,
+			Protocol: c.proto,
+		})
+	}
+
 	return
 }
 
-func (c *client) send(request []byte) ([]byte, error) {
-	err := c.applyDeadline()
+// initDebug enables the debug layer if it is requested by the configuration
+// or the environment. Dumps are written to the standard error if there is no
+// configured logger because otherwise they would be silently discarded.
+func (c *client) initDebug(config *Config) {
+	enabled, _ := strconv.ParseBool(os.Getenv(DebugEnv))
+	if !config.Debug && !enabled {
+		return
+	}
+
+	if config.Logger != nil {
+		c.debugLogger = c.logger
+	} else {
+		c.debugLogger = logger.NewSlog(slog.New(slog.NewTextHandler(os.Stderr, nil))).With("addr", c.addr)
+	}
+}
+
+// reconnect closes the current connection and establishes a new one
+// including a new handshake.
+func (c *client) reconnect(ctx context.Context) (err error) {
+	ctx, span := c.startSpan(ctx, "avroipc.reconnect", attribute.String("server.address", c.addr))
+	defer func() { endSpan(span, err) }()
+
+	if c.transport != nil {
+		_ = c.transport.Close()
+		c.transport = nil
+	}
+
+	err = c.connect(ctx)
+	if c.metrics != nil {
+		c.metrics.ObserveReconnect(err)
+	}
 	if err != nil {
-		return nil, err
+		c.logger.Warn("reconnection failed", "error", err)
+		if c.transport != nil {
+			_ = c.transport.Close()
+			c.transport = nil
+		}
+		return err
 	}
 
-	err = c.framingLayer.Write(request)
+	c.logger.Info("reconnected")
+	c.broken = false
+	return nil
+}
+
+func (c *client) send(ctx context.Context, request []byte) ([]byte, error) {
+	c.lastSend = time.Now()
+
+	response, err := c.roundTrip(ctx, request)
 	if err != nil {
-		return nil, err
+		c.broken = true
+		return nil, &TransportError{Err: err}
 	}
 
-	err = c.transport.Flush()
+	return response, nil
+}
+
+func (c *client) roundTrip(ctx context.Context, request []byte) ([]byte, error) {
+	err := c.applyDeadline(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	response, err := c.framingLayer.Read()
+	err = c.write(ctx, request)
 	if err != nil {
 		return nil, err
 	}
 
-	return response, nil
+	return c.read(ctx)
+}
+
+func (c *client) write(ctx context.Context, request []byte) (err error) {
+	_, span := c.startSpan(ctx, "avroipc.framing.write", attribute.Int("avroipc.request.size", len(request)))
+	defer func() { endSpan(span, err) }()
+
+	err = c.framingLayer.Write(request)
+	if err != nil {
+		return err
+	}
+
+	return c.transport.Flush()
+}
+
+func (c *client) read(ctx context.Context) (response []byte, err error) {
+	_, span := c.startSpan(ctx, "avroipc.framing.read")
+	defer func() {
+		span.SetAttributes(attribute.Int("avroipc.response.size", len(response)))
+		endSpan(span, err)
+	}()
+
+	return c.framingLayer.Read()
 }
 
-func (c *client) handshake() error {
+func (c *client) handshake(ctx context.Context) (err error) {
+	ctx, span := c.startSpan(ctx, "avroipc.handshake")
+	defer func() { endSpan(span, err) }()
+
 	request, err := c.handshakeProtocol.PrepareRequest()
 	if err != nil {
 		return err
 	}
 
-	responseBytes, err := c.send(request)
+	responseBytes, err := c.send(ctx, request)
 	if err != nil {
 		return err
 	}
 
 	needResend, err := c.handshakeProtocol.ProcessResponse(responseBytes)
+	if r, ok := c.handshakeProtocol.(protocols.MatchReporter); ok && (c.metrics != nil || span.IsRecording()) {
+		if match := r.Match(); match != "" {
+			span.SetAttributes(attribute.String("avroipc.handshake.match", match))
+			if c.metrics != nil {
+				c.metrics.ObserveHandshake(match)
+			}
+		}
+	}
 	if err != nil {
 		return err
 	}
 	if needResend {
-		err = c.handshake()
+		err = c.handshake(ctx)
 		if err != nil {
 			return err
 		}
@@ -127,9 +329,63 @@ func (c *client) handshake() error {
 	return nil
 }
 
-func (c *client) applyDeadline() error {
+// keepAlive periodically pings the server while the client is idle until
+// the client is closed. The done channel is passed explicitly because the
+// Close method resets the field.
+func (c *client) keepAlive(done <-chan struct{}, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			_ = c.ping(interval)
+		}
+	}
+}
+
+// ping sends a ping request to the server if there were no other requests
+// during the specified interval. A failed ping marks the connection as broken
+// and triggers reconnection.
+func (c *client) ping(interval time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return ErrClosed
+	}
+
+	ctx := context.Background()
+
+	if c.broken {
+		return c.reconnect(ctx)
+	}
+	if time.Since(c.lastSend) < interval {
+		return nil
+	}
+
+	_, err := c.send(ctx, pingRequest)
+	if err != nil {
+		c.logger.Warn("ping failed", "error", err)
+		_ = c.reconnect(ctx)
+		return err
+	}
+
+	return nil
+}
+
+func (c *client) applyDeadline(ctx context.Context) error {
+	d, ok := ctx.Deadline()
 	if c.sendTimeout > 0 {
-		d := time.Now().Add(c.sendTimeout)
+		t := time.Now().Add(c.sendTimeout)
+		if !ok || t.Before(d) {
+			d, ok = t, true
+		}
+	}
+
+	if ok {
 		return c.transport.SetDeadline(d)
 	}
 
@@ -137,7 +393,24 @@ func (c *client) applyDeadline() error {
 }
 
 func (c *client) Close() error {
-	err := c.applyDeadline()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+
+	if c.done != nil {
+		close(c.done)
+		c.done = nil
+	}
+
+	if c.transport == nil {
+		return nil
+	}
+
+	err := c.applyDeadline(context.Background())
 	if err != nil {
 		return err
 	}
@@ -146,16 +419,87 @@ func (c *client) Close() error {
 }
 
 func (c *client) SendMessage(method string, datum interface{}) (string, error) {
-	request, err := c.callProtocol.PrepareRequest(method, datum)
+	return c.SendMessageContext(context.Background(), method, datum)
+}
+
+// SendMessageContext holds the lock of the client only during attempts, so
+// other goroutines including pings may use the client between them.
+func (c *client) SendMessageContext(ctx context.Context, method string, datum interface{}) (status string, err error) {
+	ctx, span := c.startSpan(ctx, "avroipc.SendMessage",
+		attribute.String("rpc.system", "avro"),
+		attribute.String("rpc.method", method),
+		attribute.String("server.address", c.addr),
+	)
+	defer func() { endSpan(span, err) }()
+
+	if c.metrics != nil {
+		defer func(start time.Time) {
+			c.metrics.ObserveCall(method, time.Since(start), err)
+		}(time.Now())
+	}
+
+	if c.retryPolicy == nil {
+		return c.lockedSendMessage(ctx, method, datum)
+	}
+
+	attempt := 0
+	err = c.retryPolicy.DoContext(ctx, func() error {
+		err = ctx.Err()
+		if err != nil {
+			return err
+		}
+
+		attempt++
+		if attempt > 1 {
+			c.logger.Debug("retrying message", "method", method, "attempt", attempt)
+		}
+
+		status, err = c.lockedSendMessage(ctx, method, datum)
+		return err
+	})
+
+	return
+}
+
+func (c *client) lockedSendMessage(ctx context.Context, method string, datum interface{}) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.sendMessage(ctx, method, datum)
+}
+
+func (c *client) sendMessage(ctx context.Context, method string, datum interface{}) (string, error) {
+	if c.closed {
+		return "", ErrClosed
+	}
+
+	if c.broken {
+		err := c.reconnect(ctx)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	request, err := c.prepareRequest(ctx, method, datum)
 	if err != nil {
 		return "", err
 	}
 
-	responseBytes, err := c.send(request)
+	var read, written uint64
+	if c.counter != nil {
+		read, written = c.counter.BytesRead(), c.counter.BytesWritten()
+	}
+
+	responseBytes, err := c.send(ctx, request)
 	if err != nil {
 		return "", err
 	}
 
+	if c.metrics != nil && c.counter != nil {
+		c.metrics.ObserveRequestSize(method, len(request), int(c.counter.BytesWritten()-written))
+		c.metrics.ObserveResponseSize(method, len(responseBytes), int(c.counter.BytesRead()-read))
+	}
+
 	response, err := c.callProtocol.ParseResponse(method, responseBytes)
 	if err != nil {
 		return "", err
@@ -168,3 +512,15 @@ func (c *client) SendMessage(method string, datum interface{}) (string, error) {
 
 	return status, nil
 }
+
+// prepareRequest prepares a request with the trace context of the passed
+// context if the call protocol is able to send call metadata.
+func (c *client) prepareRequest(ctx context.Context, method string, datum interface{}) ([]byte, error) {
+	if p, ok := c.callProtocol.(protocols.MetaCallProtocol); ok {
+		if meta := c.injectMeta(ctx); meta != nil {
+			return p.PrepareRequestWithMeta(method, meta, datum)
+		}
+	}
+
+	return c.callProtocol.PrepareRequest(method, datum)
+}
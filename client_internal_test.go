@@ -1,12 +1,19 @@
 package avroipc
 
 import (
+	"context"
 	"errors"
 	"testing"
+	"time"
 
+	"github.com/myzhan/avroipc/logger"
 	"github.com/myzhan/avroipc/mocks"
+	"github.com/myzhan/avroipc/protocols"
+	"github.com/myzhan/avroipc/transports"
 
+	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace"
 )
 
 func prepare() (*client, *mocks.MockTransport, *mocks.MockFramingLayer, *mocks.MockCallProtocol, *mocks.MockHandshakeProtocol) {
@@ -16,6 +23,7 @@ func prepare() (*client, *mocks.MockTransport, *mocks.MockFramingLayer, *mocks.M
 	h := &mocks.MockHandshakeProtocol{}
 
 	c := &client{
+		logger:            logger.NewNop(),
 		transport:         t,
 		framingLayer:      f,
 		callProtocol:      p,
@@ -25,6 +33,32 @@ func prepare() (*client, *mocks.MockTransport, *mocks.MockFramingLayer, *mocks.M
 	return c, t, f, p, h
 }
 
+func TestClient_initDebug(t *testing.T) {
+	t.Run("disabled", func(t *testing.T) {
+		t.Setenv(DebugEnv, "")
+		c, _, _, _, _ := prepare()
+
+		c.initDebug(NewConfig())
+		require.Nil(t, c.debugLogger)
+	})
+
+	t.Run("config", func(t *testing.T) {
+		t.Setenv(DebugEnv, "")
+		c, _, _, _, _ := prepare()
+
+		c.initDebug(NewConfig().WithDebug(true).WithLogger(c.logger))
+		require.Equal(t, c.logger, c.debugLogger)
+	})
+
+	t.Run("environment", func(t *testing.T) {
+		t.Setenv(DebugEnv, "true")
+		c, _, _, _, _ := prepare()
+
+		c.initDebug(NewConfig())
+		require.NotNil(t, c.debugLogger)
+	})
+}
+
 func TestClient_handshake(t *testing.T) {
 	testErr := errors.New("test error")
 
@@ -50,7 +84,7 @@ func TestClient_handshake(t *testing.T) {
 		f.On("Read").Return(response2, nil).Once()
 		h.On("ProcessResponse", response2).Return(false, nil).Once()
 
-		err := c.handshake()
+		err := c.handshake(context.Background())
 		require.NoError(t, err)
 		h.AssertExpectations(t)
 		f.AssertExpectations(t)
@@ -65,13 +99,97 @@ func TestClient_handshake(t *testing.T) {
 		// The first handshake request: emulate an unknown client protocol
 		h.On("PrepareRequest").Return(request, testErr).Once()
 
-		err := c.handshake()
+		err := c.handshake(context.Background())
 		require.EqualError(t, err, "test error")
 		h.AssertExpectations(t)
 		f.AssertExpectations(t)
 	})
 }
 
+func TestNewClientWithConfig(t *testing.T) {
+	t.Run("handshake failed", func(t *testing.T) {
+		x := &mocks.MockTransport{}
+		x.On("Write", mock.Anything).Return(0, errors.New("test error"))
+		x.On("Flush").Return(errors.New("test error")).Maybe()
+		x.On("SetDeadline", mock.Anything).Return(nil).Maybe()
+		x.On("Close").Return(nil).Once()
+
+		config := NewConfig().WithDialer(func(addr string) (transports.Transport, error) {
+			return x, nil
+		})
+		proto, err := protocols.ParseProtocol(`{"protocol": "P", "messages": {}}`)
+		require.NoError(t, err)
+
+		c, err := NewClientWithConfig("", proto, config)
+		require.Error(t, err)
+		require.Nil(t, c)
+		// The transport of the failed handshake is not leaked.
+		x.AssertExpectations(t)
+	})
+}
+
+func TestClient_ping(t *testing.T) {
+	testErr := errors.New("test error")
+
+	response := []byte{}
+
+	t.Run("idle", func(t *testing.T) {
+		c, x, f, _, _ := prepare()
+
+		f.On("Write", pingRequest).Return(nil).Once()
+		x.On("Flush").Return(nil).Once()
+		f.On("Read").Return(response, nil).Once()
+
+		err := c.ping(time.Minute)
+		require.NoError(t, err)
+		require.False(t, c.broken)
+		f.AssertExpectations(t)
+		x.AssertExpectations(t)
+	})
+
+	t.Run("not idle", func(t *testing.T) {
+		c, x, f, _, _ := prepare()
+		c.lastSend = time.Now()
+
+		err := c.ping(time.Minute)
+		require.NoError(t, err)
+		require.False(t, c.broken)
+		f.AssertExpectations(t)
+		x.AssertExpectations(t)
+	})
+
+	t.Run("failed", func(t *testing.T) {
+		c, x, f, _, _ := prepare()
+		c.addr = "1:2:3"
+		c.config = NewConfig()
+
+		f.On("Write", pingRequest).Return(testErr).Once()
+		x.On("Close").Return(nil).Once()
+
+		err := c.ping(time.Minute)
+		require.EqualError(t, err, "test error")
+		require.True(t, c.broken)
+		f.AssertExpectations(t)
+		x.AssertExpectations(t)
+	})
+
+	t.Run("broken", func(t *testing.T) {
+		c, x, f, _, _ := prepare()
+		c.addr = "1:2:3"
+		c.config = NewConfig()
+		c.broken = true
+
+		x.On("Close").Return(nil).Once()
+
+		err := c.ping(time.Minute)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "too many colons in address")
+		require.True(t, c.broken)
+		f.AssertExpectations(t)
+		x.AssertExpectations(t)
+	})
+}
+
 func TestClient_Close(t *testing.T) {
 	testErr := errors.New("test error")
 
@@ -94,6 +212,25 @@ func TestClient_Close(t *testing.T) {
 		require.EqualError(t, err, "test error")
 		x.AssertExpectations(t)
 	})
+
+	t.Run("no reconnection after close", func(t *testing.T) {
+		c, x, f, p, _ := prepare()
+		c.addr = "1:2:3"
+		c.config = NewConfig()
+		c.broken = true
+
+		x.On("Close").Return(nil).Once()
+
+		require.NoError(t, c.Close())
+		require.NoError(t, c.Close())
+
+		_, err := c.SendMessage("append", "test data")
+		require.Equal(t, ErrClosed, err)
+		require.Equal(t, ErrClosed, c.ping(time.Minute))
+		x.AssertExpectations(t)
+		f.AssertExpectations(t)
+		p.AssertExpectations(t)
+	})
 }
 
 func TestClient_SendMessage(t *testing.T) {
@@ -120,6 +257,182 @@ func TestClient_SendMessage(t *testing.T) {
 		x.AssertExpectations(t)
 	})
 
+	t.Run("transport error", func(t *testing.T) {
+		c, x, f, p, _ := prepare()
+
+		p.On("PrepareRequest", method, datum).Return(request, nil).Once()
+		f.On("Write", request).Return(nil).Once()
+		x.On("Flush").Return(errors.New("test error")).Once()
+
+		status, err := c.SendMessage(method, datum)
+		require.EqualError(t, err, "test error")
+		require.Equal(t, "", status)
+		require.True(t, c.broken)
+		p.AssertExpectations(t)
+		f.AssertExpectations(t)
+		x.AssertExpectations(t)
+	})
+
+	t.Run("reconnect failed", func(t *testing.T) {
+		c, x, f, p, _ := prepare()
+		c.addr = "1:2:3"
+		c.config = NewConfig()
+		c.broken = true
+
+		x.On("Close").Return(nil).Once()
+
+		status, err := c.SendMessage(method, datum)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "too many colons in address")
+		require.Equal(t, "", status)
+		require.True(t, c.broken)
+		p.AssertExpectations(t)
+		f.AssertExpectations(t)
+		x.AssertExpectations(t)
+	})
+
+	t.Run("retry transport error", func(t *testing.T) {
+		c, x, f, p, _ := prepare()
+		c.addr = "1:2:3"
+		c.config = NewConfig()
+		c.retryPolicy = &RetryPolicy{MaxAttempts: 3, BaseBackoff: time.Nanosecond}
+
+		p.On("PrepareRequest", method, datum).Return(request, nil).Once()
+		f.On("Write", request).Return(nil).Once()
+		x.On("Flush").Return(errors.New("test error")).Once()
+		x.On("Close").Return(nil).Once()
+
+		status, err := c.SendMessage(method, datum)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "too many colons in address")
+		require.Equal(t, "", status)
+		require.True(t, c.broken)
+		p.AssertExpectations(t)
+		f.AssertExpectations(t)
+		x.AssertExpectations(t)
+	})
+
+	t.Run("cancel retry backoff", func(t *testing.T) {
+		c, x, f, p, _ := prepare()
+		c.retryPolicy = &RetryPolicy{MaxAttempts: 3, BaseBackoff: time.Hour}
+
+		p.On("PrepareRequest", method, datum).Return(request, nil).Once()
+		f.On("Write", request).Return(nil).Once()
+		attempted := make(chan struct{})
+		x.On("Flush").Return(errors.New("test error")).Run(func(mock.Arguments) { close(attempted) }).Once()
+
+		// The lock is released during the backoff, so other goroutines may
+		// use the client while it waits.
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			<-attempted
+			for !c.mu.TryLock() {
+				time.Sleep(time.Millisecond)
+			}
+			c.mu.Unlock()
+			cancel()
+		}()
+
+		status, err := c.SendMessageContext(ctx, method, datum)
+		require.Equal(t, context.Canceled, err)
+		require.Equal(t, "", status)
+		p.AssertExpectations(t)
+		f.AssertExpectations(t)
+		x.AssertExpectations(t)
+	})
+
+	t.Run("do not retry remote error", func(t *testing.T) {
+		c, x, f, p, _ := prepare()
+		c.retryPolicy = &RetryPolicy{MaxAttempts: 3, BaseBackoff: time.Nanosecond}
+
+		p.On("PrepareRequest", method, datum).Return(request, nil).Once()
+		f.On("Write", request).Return(nil).Once()
+		x.On("Flush").Return(nil).Once()
+		f.On("Read").Return(response, nil).Once()
+		p.On("ParseResponse", method, response).Return(nil, &protocols.RemoteError{Message: "remote error"}).Once()
+
+		status, err := c.SendMessage(method, datum)
+		require.EqualError(t, err, "remote error")
+		require.Equal(t, "", status)
+		require.False(t, c.broken)
+		p.AssertExpectations(t)
+		f.AssertExpectations(t)
+		x.AssertExpectations(t)
+	})
+
+	t.Run("metrics", func(t *testing.T) {
+		c, x, f, p, _ := prepare()
+		m := &mocks.MockMetrics{}
+		c.metrics = m
+		c.counter = transports.NewCounting(x)
+
+		p.On("PrepareRequest", method, datum).Return(request, nil).Once()
+		f.On("Write", request).Return(nil).Once()
+		x.On("Flush").Return(nil).Once()
+		f.On("Read").Return(response, nil).Once()
+		p.On("ParseResponse", method, response).Return("SOME", nil).Once()
+		m.On("ObserveRequestSize", method, 2, 0).Once()
+		m.On("ObserveResponseSize", method, 2, 0).Once()
+		m.On("ObserveCall", method, mock.AnythingOfType("time.Duration"), nil).Once()
+
+		status, err := c.SendMessage(method, datum)
+		require.NoError(t, err)
+		require.Equal(t, "SOME", status)
+		p.AssertExpectations(t)
+		f.AssertExpectations(t)
+		x.AssertExpectations(t)
+		m.AssertExpectations(t)
+	})
+
+	t.Run("trace context", func(t *testing.T) {
+		c, x, f, p, _ := prepare()
+		c.initTracing(NewConfig())
+
+		ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+			TraceID:    trace.TraceID{0x1},
+			SpanID:     trace.SpanID{0x2},
+			TraceFlags: trace.FlagsSampled,
+		}))
+		meta := map[string][]byte{
+			"traceparent": []byte("00-01000000000000000000000000000000-0200000000000000-01"),
+		}
+
+		p.On("PrepareRequestWithMeta", method, meta, datum).Return(request, nil).Once()
+		f.On("Write", request).Return(nil).Once()
+		x.On("Flush").Return(nil).Once()
+		f.On("Read").Return(response, nil).Once()
+		p.On("ParseResponse", method, response).Return("SOME", nil).Once()
+
+		status, err := c.SendMessageContext(ctx, method, datum)
+		require.NoError(t, err)
+		require.Equal(t, "SOME", status)
+		p.AssertExpectations(t)
+		f.AssertExpectations(t)
+		x.AssertExpectations(t)
+	})
+
+	t.Run("context deadline", func(t *testing.T) {
+		c, x, f, p, _ := prepare()
+
+		d := time.Now().Add(time.Minute)
+		ctx, cancel := context.WithDeadline(context.Background(), d)
+		defer cancel()
+
+		p.On("PrepareRequest", method, datum).Return(request, nil).Once()
+		x.On("SetDeadline", d).Return(nil).Once()
+		f.On("Write", request).Return(nil).Once()
+		x.On("Flush").Return(nil).Once()
+		f.On("Read").Return(response, nil).Once()
+		p.On("ParseResponse", method, response).Return("SOME", nil).Once()
+
+		status, err := c.SendMessageContext(ctx, method, datum)
+		require.NoError(t, err)
+		require.Equal(t, "SOME", status)
+		p.AssertExpectations(t)
+		f.AssertExpectations(t)
+		x.AssertExpectations(t)
+	})
+
 	t.Run("incorrect status type", func(t *testing.T) {
 		c, x, f, p, _ := prepare()
 
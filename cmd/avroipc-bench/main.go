@@ -0,0 +1,369 @@
+// Command avroipc-bench generates load against a Flume Avro source and
+// reports throughput, latency percentiles and errors. Concurrency, batch
+// sizes, event sizes and compression levels accept comma-separated lists,
+// every combination of them is run as a separate scenario.
+//
+// Usage:
+//
+//	avroipc-bench -addr localhost:41414 -concurrency 1,4 -batch 10,100 -duration 30s [flags]
+package main
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/myzhan/avroipc"
+	"github.com/myzhan/avroipc/flume"
+	"github.com/myzhan/avroipc/internal/cli"
+)
+
+// A pause of a worker after a transport error to avoid spinning on a broken
+// connection.
+const errorBackoff = 100 * time.Millisecond
+
+type ints []int
+
+func (v *ints) String() string {
+	s := make([]string, len(*v))
+	for i, x := range *v {
+		s[i] = strconv.Itoa(x)
+	}
+	return strings.Join(s, ",")
+}
+
+func (v *ints) Set(s string) error {
+	*v = nil
+	for _, f := range strings.Split(s, ",") {
+		x, err := strconv.Atoi(strings.TrimSpace(f))
+		if err != nil {
+			return err
+		}
+		*v = append(*v, x)
+	}
+	return nil
+}
+
+type options struct {
+	addr        string
+	duration    time.Duration
+	requests    int64
+	timeout     time.Duration
+	sendTimeout time.Duration
+	tls         cli.TLSFlags
+	json        bool
+
+	tlsConfig *tls.Config
+}
+
+type scenario struct {
+	Concurrency int `json:"concurrency"`
+	BatchSize   int `json:"batch_size"`
+	EventSize   int `json:"event_size"`
+	Compression int `json:"compression"`
+}
+
+// latency is a summary of request latencies in milliseconds.
+type latency struct {
+	Mean float64 `json:"mean"`
+	P50  float64 `json:"p50"`
+	P90  float64 `json:"p90"`
+	P99  float64 `json:"p99"`
+	Max  float64 `json:"max"`
+}
+
+type result struct {
+	scenario
+	Duration          float64        `json:"duration_seconds"`
+	Attempts          int64          `json:"attempted_requests"`
+	Requests          int64          `json:"requests"`
+	Events            int64          `json:"events"`
+	Bytes             int64          `json:"bytes"`
+	RequestsPerSecond float64        `json:"requests_per_second"`
+	EventsPerSecond   float64        `json:"events_per_second"`
+	BytesPerSecond    float64        `json:"bytes_per_second"`
+	Latency           latency        `json:"latency_ms"`
+	Errors            map[string]int `json:"errors"`
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	var opts options
+	concurrency, batchSizes, eventSizes, compressions := ints{1}, ints{100}, ints{256}, ints{0}
+
+	fs := flag.NewFlagSet("avroipc-bench", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: avroipc-bench -addr host:port [flags]")
+		fs.PrintDefaults()
+	}
+	fs.StringVar(&opts.addr, "addr", "", "address of the Flume Avro source")
+	fs.Var(&concurrency, "concurrency", "comma-separated numbers of concurrent clients")
+	fs.Var(&batchSizes, "batch", "comma-separated numbers of events in a batch")
+	fs.Var(&eventSizes, "size", "comma-separated sizes of event bodies in bytes")
+	fs.Var(&compressions, "compression", "comma-separated zlib compression levels, 0 disables compression")
+	fs.DurationVar(&opts.duration, "duration", 10*time.Second, "duration of each scenario")
+	fs.Int64Var(&opts.requests, "requests", 0, "number of requests of each scenario, 0 means no limit")
+	fs.DurationVar(&opts.timeout, "timeout", 10*time.Second, "connection timeout")
+	fs.DurationVar(&opts.sendTimeout, "send-timeout", 10*time.Second, "read/write timeout")
+	opts.tls.Register(fs)
+	fs.BoolVar(&opts.json, "json", false, "print results as JSON")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if opts.addr == "" || fs.NArg() > 0 || !positive(concurrency, batchSizes, eventSizes) || !nonNegative(compressions) {
+		fs.Usage()
+		return 2
+	}
+
+	var err error
+	opts.tlsConfig, err = opts.tls.Config()
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	var results []*result
+	for _, c := range concurrency {
+		for _, b := range batchSizes {
+			for _, s := range eventSizes {
+				for _, l := range compressions {
+					r := bench(scenario{Concurrency: c, BatchSize: b, EventSize: s, Compression: l}, &opts)
+					results = append(results, r)
+					if !opts.json {
+						printResult(stdout, r)
+					}
+				}
+			}
+		}
+	}
+
+	if opts.json {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(results); err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+	}
+
+	for _, r := range results {
+		if len(r.Errors) > 0 {
+			return 1
+		}
+	}
+	return 0
+}
+
+func positive(lists ...ints) bool {
+	for _, l := range lists {
+		for _, x := range l {
+			if x <= 0 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func nonNegative(lists ...ints) bool {
+	for _, l := range lists {
+		for _, x := range l {
+			if x < 0 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// bench runs the scenario with a separate client per worker. The time of
+// the scenario is measured after connecting all workers.
+func bench(s scenario, opts *options) *result {
+	config := avroipc.NewConfig().
+		WithTimeout(opts.timeout).
+		WithSendTimeout(opts.sendTimeout).
+		WithCompressionLevel(s.Compression).
+		WithTLSConfig(opts.tlsConfig)
+
+	var (
+		mu        sync.Mutex
+		latencies []time.Duration
+		errs      = make(map[string]int)
+		attempts  atomic.Int64
+		connected sync.WaitGroup
+		wg        sync.WaitGroup
+
+		ready    = make(chan struct{})
+		start    time.Time
+		deadline time.Time
+	)
+	addError := func(kind string) {
+		mu.Lock()
+		errs[kind]++
+		mu.Unlock()
+	}
+
+	for w := 0; w < s.Concurrency; w++ {
+		wg.Add(1)
+		connected.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+
+			client, err := flume.NewClientWithConfig(opts.addr, config, flume.WithStatusErrors())
+			connected.Done()
+			if err != nil {
+				addError("connect")
+				return
+			}
+			defer client.Close()
+
+			batch := makeBatch(rand.New(rand.NewSource(seed)), s.BatchSize, s.EventSize)
+			var local []time.Duration
+			<-ready
+			for time.Now().Before(deadline) {
+				if n := attempts.Add(1); opts.requests > 0 && n > opts.requests {
+					// Count only requests that are sent.
+					attempts.Add(-1)
+					break
+				}
+
+				t := time.Now()
+				_, err := client.AppendBatch(batch)
+				if err != nil {
+					addError(errorKind(err))
+					var transportErr *avroipc.TransportError
+					if errors.As(err, &transportErr) {
+						time.Sleep(min(errorBackoff, time.Until(deadline)))
+					}
+					continue
+				}
+				local = append(local, time.Since(t))
+			}
+
+			mu.Lock()
+			latencies = append(latencies, local...)
+			mu.Unlock()
+		}(int64(w))
+	}
+	connected.Wait()
+	start = time.Now()
+	deadline = start.Add(opts.duration)
+	close(ready)
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	r := &result{
+		scenario: s,
+		Duration: elapsed.Seconds(),
+		Attempts: attempts.Load(),
+		Requests: int64(len(latencies)),
+		Latency:  summarize(latencies),
+		Errors:   errs,
+	}
+	r.Events = r.Requests * int64(s.BatchSize)
+	r.Bytes = r.Events * int64(s.EventSize)
+	if r.Duration > 0 {
+		r.RequestsPerSecond = float64(r.Requests) / r.Duration
+		r.EventsPerSecond = float64(r.Events) / r.Duration
+		r.BytesPerSecond = float64(r.Bytes) / r.Duration
+	}
+
+	return r
+}
+
+func makeBatch(rnd *rand.Rand, batchSize, eventSize int) []*flume.Event {
+	const letters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+	batch := make([]*flume.Event, batchSize)
+	for i := range batch {
+		body := make([]byte, eventSize)
+		for j := range body {
+			body[j] = letters[rnd.Intn(len(letters))]
+		}
+		batch[i] = &flume.Event{Headers: map[string]string{}, Body: body}
+	}
+	return batch
+}
+
+// errorKind returns a key of the error breakdown: a status for status
+// errors and a class of the avroipc.ErrorType function for other errors.
+func errorKind(err error) string {
+	var statusErr *flume.StatusError
+	if errors.As(err, &statusErr) {
+		return "status " + string(statusErr.Status)
+	}
+	return avroipc.ErrorType(err)
+}
+
+func summarize(latencies []time.Duration) latency {
+	if len(latencies) == 0 {
+		return latency{}
+	}
+
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+
+	var sum time.Duration
+	for _, l := range latencies {
+		sum += l
+	}
+	percentile := func(p float64) float64 {
+		i := int(p*float64(len(latencies))+0.5) - 1
+		if i < 0 {
+			i = 0
+		}
+		return ms(latencies[i])
+	}
+
+	return latency{
+		Mean: ms(sum / time.Duration(len(latencies))),
+		P50:  percentile(0.5),
+		P90:  percentile(0.9),
+		P99:  percentile(0.99),
+		Max:  ms(latencies[len(latencies)-1]),
+	}
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+func printResult(w io.Writer, r *result) {
+	fmt.Fprintf(w, "concurrency=%d batch=%d size=%d compression=%d\n",
+		r.Concurrency, r.BatchSize, r.EventSize, r.Compression)
+	fmt.Fprintf(w, "  %d of %d requests succeeded, %d events, %d bytes in %.2fs\n",
+		r.Requests, r.Attempts, r.Events, r.Bytes, r.Duration)
+	fmt.Fprintf(w, "  throughput: %.1f requests/s, %.1f events/s, %.1f MB/s\n",
+		r.RequestsPerSecond, r.EventsPerSecond, r.BytesPerSecond/1e6)
+	fmt.Fprintf(w, "  latency ms: mean=%.3f p50=%.3f p90=%.3f p99=%.3f max=%.3f\n",
+		r.Latency.Mean, r.Latency.P50, r.Latency.P90, r.Latency.P99, r.Latency.Max)
+
+	if len(r.Errors) == 0 {
+		fmt.Fprintln(w, "  errors: none")
+		return
+	}
+	kinds := make([]string, 0, len(r.Errors))
+	for k := range r.Errors {
+		kinds = append(kinds, k)
+	}
+	sort.Strings(kinds)
+	fmt.Fprint(w, "  errors:")
+	for _, k := range kinds {
+		fmt.Fprintf(w, " %s=%d", k, r.Errors[k])
+	}
+	fmt.Fprintln(w)
+}
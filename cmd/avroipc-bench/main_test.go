@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/myzhan/avroipc"
+	"github.com/myzhan/avroipc/flume"
+	"github.com/myzhan/avroipc/flumetest"
+)
+
+func TestRun(t *testing.T) {
+	t.Run("text", func(t *testing.T) {
+		a := flumetest.NewAgent(t)
+
+		var stdout, stderr bytes.Buffer
+		code := run([]string{"-addr", a.Addr(), "-concurrency", "1,2", "-batch", "3", "-size", "5", "-requests", "4"}, &stdout, &stderr)
+		require.Equal(t, 0, code, stderr.String())
+
+		out := stdout.String()
+		require.Contains(t, out, "concurrency=1 batch=3 size=5 compression=0\n")
+		require.Contains(t, out, "concurrency=2 batch=3 size=5 compression=0\n")
+		require.Contains(t, out, "  4 of 4 requests succeeded, 12 events, 60 bytes in ")
+		require.Contains(t, out, "  errors: none\n")
+		require.Len(t, a.Calls(), 8)
+		require.Len(t, a.Events()[0].Body, 5)
+	})
+
+	t.Run("json with errors", func(t *testing.T) {
+		a := flumetest.NewAgent(t)
+		a.Script(flumetest.Reply{Status: flume.StatusFailed}, flumetest.Reply{Error: "test error"})
+
+		var stdout, stderr bytes.Buffer
+		code := run([]string{"-addr", a.Addr(), "-requests", "3", "-json"}, &stdout, &stderr)
+		require.Equal(t, 1, code)
+
+		var results []*result
+		require.NoError(t, json.Unmarshal(stdout.Bytes(), &results))
+		require.Len(t, results, 1)
+		require.Equal(t, scenario{Concurrency: 1, BatchSize: 100, EventSize: 256}, results[0].scenario)
+		require.Equal(t, int64(3), results[0].Attempts)
+		require.Equal(t, int64(1), results[0].Requests)
+		require.Equal(t, int64(100), results[0].Events)
+		require.Equal(t, map[string]int{"status FAILED": 1, "remote": 1}, results[0].Errors)
+		require.Greater(t, results[0].Latency.Max, 0.0)
+	})
+
+	t.Run("connection error", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		code := run([]string{"-addr", "127.0.0.1:1", "-duration", "10ms", "-timeout", "100ms"}, &stdout, &stderr)
+		require.Equal(t, 1, code)
+		require.Contains(t, stdout.String(), "errors: connect=1\n")
+	})
+
+	t.Run("transport error", func(t *testing.T) {
+		a := flumetest.NewAgent(t)
+		a.Script(flumetest.Reply{Drop: true})
+
+		var stdout, stderr bytes.Buffer
+		start := time.Now()
+		code := run([]string{"-addr", a.Addr(), "-requests", "2", "-json"}, &stdout, &stderr)
+		require.Equal(t, 1, code)
+		// The worker backs off after the dropped connection.
+		require.GreaterOrEqual(t, time.Since(start), errorBackoff)
+
+		var results []*result
+		require.NoError(t, json.Unmarshal(stdout.Bytes(), &results))
+		require.Equal(t, int64(2), results[0].Attempts)
+		require.Equal(t, int64(1), results[0].Requests)
+		require.Equal(t, map[string]int{"transport": 1}, results[0].Errors)
+	})
+
+	t.Run("missing CA file", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		code := run([]string{"-addr", "x", "-tls", "-tls-ca", "missing.pem"}, &stdout, &stderr)
+		require.Equal(t, 1, code)
+		require.Contains(t, stderr.String(), "missing.pem")
+	})
+
+	t.Run("bad flags", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		require.Equal(t, 2, run(nil, &stdout, &stderr))
+		require.Equal(t, 2, run([]string{"-addr", "x", "-batch", "0"}, &stdout, &stderr))
+		require.Equal(t, 2, run([]string{"-addr", "x", "-compression", "-1"}, &stdout, &stderr))
+		require.Equal(t, 2, run([]string{"-addr", "x", "-size", "a"}, &stdout, &stderr))
+		require.Contains(t, stderr.String(), "Usage: avroipc-bench")
+	})
+}
+
+func TestSummarize(t *testing.T) {
+	latencies := make([]time.Duration, 100)
+	for i := range latencies {
+		latencies[i] = time.Duration(100-i) * time.Millisecond
+	}
+
+	require.Equal(t, latency{Mean: 50.5, P50: 50, P90: 90, P99: 99, Max: 100}, summarize(latencies))
+	require.Equal(t, latency{}, summarize(nil))
+}
+
+func TestErrorKind(t *testing.T) {
+	require.Equal(t, "status UNKNOWN", errorKind(&flume.StatusError{Status: flume.StatusUnknown}))
+	require.Equal(t, "transport", errorKind(&avroipc.TransportError{Err: errors.New("test error")}))
+}
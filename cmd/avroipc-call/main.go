@@ -0,0 +1,304 @@
+// Command avroipc-call calls a message of an arbitrary Avro RPC service
+// described by a protocol declaration (an .avpr file) and prints the response
+// or the declared error in the Avro JSON encoding. Request parameters are
+// passed as a JSON object with parameter names as keys, "-" reads them from
+// the standard input.
+//
+// The probe subcommand performs just the handshake and reports whether the
+// server knows the client protocol, the server hash and the server protocol
+// with a diff against the client protocol.
+//
+// Usage:
+//
+//	avroipc-call -proto service.avpr -addr localhost:9090 [flags] message [params]
+//	avroipc-call probe -proto service.avpr -addr localhost:9090 [flags]
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/myzhan/avroipc"
+	"github.com/myzhan/avroipc/internal/cli"
+	"github.com/myzhan/avroipc/logger"
+	"github.com/myzhan/avroipc/protocols"
+)
+
+// jsonProtocol returns responses in the Avro JSON encoding because the
+// avroipc client only returns string responses.
+type jsonProtocol struct {
+	*protocols.Protocol
+}
+
+func (p jsonProtocol) ParseMessage(method string, responseBytes []byte) (interface{}, []byte, error) {
+	datum, rest, err := p.Protocol.ParseMessage(method, responseBytes)
+	if err != nil {
+		return nil, rest, err
+	}
+
+	text, err := p.ResponseToJSON(method, datum)
+	if err != nil {
+		return nil, rest, err
+	}
+	return string(text), rest, nil
+}
+
+// verboseLogger prints handshakes and calls decoded by the debug layer of
+// the client in a human-readable form.
+type verboseLogger struct {
+	w io.Writer
+}
+
+func (l verboseLogger) Debug(string, ...interface{}) {}
+
+func (l verboseLogger) Info(msg string, keysAndValues ...interface{}) {
+	kv := make(map[string]interface{}, len(keysAndValues)/2)
+	for i := 0; i+1 < len(keysAndValues); i += 2 {
+		if k, ok := keysAndValues[i].(string); ok {
+			kv[k] = keysAndValues[i+1]
+		}
+	}
+
+	switch msg {
+	case "request sent":
+		if h, ok := kv["handshake"].(map[string]interface{}); ok {
+			fmt.Fprintf(l.w, "> handshake: client protocol sent: %t\n", h["clientProtocol"] != nil)
+		}
+		if m, ok := kv["method"]; ok {
+			fmt.Fprintf(l.w, "> call: %v %v\n", m, kv["datum"])
+		}
+	case "response received":
+		if h, ok := kv["handshake"].(map[string]interface{}); ok {
+			fmt.Fprintf(l.w, "< handshake: match: %v\n", h["match"])
+			if hash, ok := h["serverHash"].(map[string]interface{}); ok {
+				b, _ := hash["org.apache.avro.ipc.MD5"].([]byte)
+				fmt.Fprintf(l.w, "< server hash: %s\n", hex.EncodeToString(b))
+			}
+			if proto, ok := h["serverProtocol"].(map[string]interface{}); ok {
+				fmt.Fprintf(l.w, "< server protocol: %v\n", proto["string"])
+			}
+		}
+		if e, ok := kv["decodeError"]; ok {
+			fmt.Fprintf(l.w, "< cannot decode response: %v\n", e)
+		}
+	default:
+		l.print("info", msg, keysAndValues)
+	}
+}
+
+func (l verboseLogger) Warn(msg string, keysAndValues ...interface{}) {
+	l.print("warning", msg, keysAndValues)
+}
+
+func (l verboseLogger) Error(msg string, keysAndValues ...interface{}) {
+	l.print("error", msg, keysAndValues)
+}
+
+func (l verboseLogger) With(...interface{}) logger.Logger {
+	return l
+}
+
+func (l verboseLogger) print(level, msg string, keysAndValues []interface{}) {
+	fmt.Fprintf(l.w, "%s: %s %v\n", level, msg, keysAndValues)
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// connFlags are flags of the connection to the server shared by all
+// subcommands.
+type connFlags struct {
+	protoFile   string
+	addr        string
+	timeout     time.Duration
+	sendTimeout time.Duration
+	compression int
+	tls         cli.TLSFlags
+	verbose     bool
+}
+
+func (f *connFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.protoFile, "proto", "", "Avro protocol declaration (.avpr) file")
+	fs.StringVar(&f.addr, "addr", "", "address of the server")
+	fs.DurationVar(&f.timeout, "timeout", 10*time.Second, "connection timeout")
+	fs.DurationVar(&f.sendTimeout, "send-timeout", 10*time.Second, "read/write timeout")
+	fs.IntVar(&f.compression, "compression", 0, "zlib compression level, 0 disables compression")
+	f.tls.Register(fs)
+	fs.BoolVar(&f.verbose, "v", false, "print handshakes and calls to the standard error")
+}
+
+func (f *connFlags) config(stderr io.Writer) (*avroipc.Config, error) {
+	tlsConfig, err := f.tls.Config()
+	if err != nil {
+		return nil, err
+	}
+
+	config := avroipc.NewConfig().
+		WithTimeout(f.timeout).
+		WithSendTimeout(f.sendTimeout).
+		WithCompressionLevel(f.compression).
+		WithTLSConfig(tlsConfig)
+	if f.verbose {
+		config.WithDebug(true).WithLogger(verboseLogger{w: stderr})
+	}
+
+	return config, nil
+}
+
+func (f *connFlags) protocol() (*protocols.Protocol, error) {
+	avpr, err := os.ReadFile(f.protoFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return protocols.ParseProtocol(string(avpr))
+}
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) > 0 && args[0] == "probe" {
+		return probe(args[1:], stdout, stderr)
+	}
+
+	var conn connFlags
+
+	fs := flag.NewFlagSet("avroipc-call", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: avroipc-call -proto file.avpr -addr host:port [flags] message [params]")
+		fmt.Fprintln(stderr, "       avroipc-call probe -proto file.avpr -addr host:port [flags]")
+		fs.PrintDefaults()
+	}
+	conn.register(fs)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if conn.protoFile == "" || conn.addr == "" || fs.NArg() < 1 || fs.NArg() > 2 {
+		fs.Usage()
+		return 2
+	}
+	method := fs.Arg(0)
+
+	proto, err := conn.protocol()
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	if proto.OneWay(method) {
+		fmt.Fprintf(stderr, "one-way message %s is not supported\n", method)
+		return 1
+	}
+
+	params := "{}"
+	if fs.NArg() == 2 {
+		params = fs.Arg(1)
+	}
+	if params == "-" {
+		b, err := io.ReadAll(stdin)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		params = strings.TrimSpace(string(b))
+	}
+	datum, err := proto.RequestFromJSON(method, []byte(params))
+	if err != nil {
+		fmt.Fprintf(stderr, "invalid params: %v\n", err)
+		return 1
+	}
+
+	config, err := conn.config(stderr)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	client, err := avroipc.NewClientWithConfig(conn.addr, jsonProtocol{proto}, config)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	defer client.Close()
+
+	response, err := client.SendMessage(method, datum)
+	var declared *protocols.DeclaredError
+	if errors.As(err, &declared) {
+		fmt.Fprintf(stdout, "{%q:%s}\n", declared.Type, declared.JSON)
+		return 1
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	fmt.Fprintln(stdout, response)
+	return 0
+}
+
+// probe performs the handshake and reports its result. It fails if the
+// protocols differ and the -strict flag is set.
+func probe(args []string, stdout, stderr io.Writer) int {
+	var (
+		conn   connFlags
+		strict bool
+	)
+
+	fs := flag.NewFlagSet("avroipc-call probe", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: avroipc-call probe -proto file.avpr -addr host:port [flags]")
+		fs.PrintDefaults()
+	}
+	conn.register(fs)
+	fs.BoolVar(&strict, "strict", false, "exit with the status 1 if the server protocol differs from the client one")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if conn.protoFile == "" || conn.addr == "" || fs.NArg() > 0 {
+		fs.Usage()
+		return 2
+	}
+
+	proto, err := conn.protocol()
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	config, err := conn.config(stderr)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	r, err := avroipc.Probe(conn.addr, proto, config)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	fmt.Fprintf(stdout, "initial match: %s\n", r.InitialMatch)
+	fmt.Fprintf(stdout, "match: %s\n", r.Match)
+	fmt.Fprintf(stdout, "client protocol sent: %t\n", r.ClientProtocolSent)
+	fmt.Fprintf(stdout, "client hash: %s\n", hex.EncodeToString(r.ClientHash))
+	fmt.Fprintf(stdout, "server hash: %s\n", hex.EncodeToString(r.ServerHash))
+	fmt.Fprintf(stdout, "server protocol:\n%s\n", r.ServerProtocol)
+
+	diff := r.Diff()
+	if diff == "" {
+		fmt.Fprintln(stdout, "protocols are equal")
+		return 0
+	}
+
+	fmt.Fprintf(stdout, "diff:\n%s", diff)
+	if strict {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/myzhan/avroipc"
+	"github.com/myzhan/avroipc/protocols"
+	"github.com/myzhan/avroipc/transports"
+)
+
+const protoFile = "../../protocols/testdata/simple.avpr"
+
+func runServer(t *testing.T, avpr string) string {
+	proto, err := protocols.ParseProtocol(avpr)
+	require.NoError(t, err)
+
+	handler := func(method string, datum interface{}) (interface{}, error) {
+		params, _ := datum.(map[string]interface{})
+		switch method {
+		case "add":
+			return params["arg1"].(int32) + params["arg2"].(int32), nil
+		case "echo":
+			return params["record"], nil
+		case "error":
+			return nil, &protocols.DeclaredError{
+				Type:  "org.apache.avro.test.TestError",
+				Datum: map[string]interface{}{"message": "oops"},
+			}
+		default:
+			return nil, errors.New("not implemented")
+		}
+	}
+
+	ln, err := net.Listen("tcp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				_ = avroipc.Serve(transports.NewConn(conn), proto, handler)
+			}()
+		}
+	}()
+
+	return ln.Addr().String()
+}
+
+func readProto(t *testing.T) string {
+	avpr, err := os.ReadFile(protoFile)
+	require.NoError(t, err)
+	return string(avpr)
+}
+
+func TestRun(t *testing.T) {
+	addr := runServer(t, readProto(t))
+
+	t.Run("response", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		code := run([]string{"-proto", protoFile, "-addr", addr, "add", `{"arg1": 1, "arg2": 2}`}, nil, &stdout, &stderr)
+		require.Equal(t, 0, code, stderr.String())
+		require.Equal(t, "3\n", stdout.String())
+	})
+
+	t.Run("params from stdin", func(t *testing.T) {
+		params := `{"record": {"name": "n", "kind": "FOO", "hash": "0123456789abcdef", "nested": null}}`
+
+		var stdout, stderr bytes.Buffer
+		code := run([]string{"-proto", protoFile, "-addr", addr, "echo", "-"}, strings.NewReader(params), &stdout, &stderr)
+		require.Equal(t, 0, code, stderr.String())
+		require.JSONEq(t, `{"name": "n", "kind": "FOO", "hash": "0123456789abcdef", "nested": null}`, stdout.String())
+	})
+
+	t.Run("declared error", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		code := run([]string{"-proto", protoFile, "-addr", addr, "error"}, nil, &stdout, &stderr)
+		require.Equal(t, 1, code)
+		require.Equal(t, `{"org.apache.avro.test.TestError":{"message":"oops"}}`+"\n", stdout.String())
+	})
+
+	t.Run("system error", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		code := run([]string{"-proto", protoFile, "-addr", addr, "hello", `{"greeting": "hi"}`}, nil, &stdout, &stderr)
+		require.Equal(t, 1, code)
+		require.Equal(t, "not implemented\n", stderr.String())
+	})
+
+	t.Run("invalid params", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		code := run([]string{"-proto", protoFile, "-addr", addr, "add", `{"arg1": 1}`}, nil, &stdout, &stderr)
+		require.Equal(t, 1, code)
+		require.Contains(t, stderr.String(), "invalid params:")
+	})
+
+	t.Run("one-way message", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		code := run([]string{"-proto", protoFile, "-addr", addr, "ack"}, nil, &stdout, &stderr)
+		require.Equal(t, 1, code)
+		require.Equal(t, "one-way message ack is not supported\n", stderr.String())
+	})
+
+	t.Run("missing CA file", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		code := run([]string{"-proto", protoFile, "-addr", addr, "-tls", "-tls-ca", "missing.pem", "add", `{"arg1": 1, "arg2": 2}`}, nil, &stdout, &stderr)
+		require.Equal(t, 1, code)
+		require.Contains(t, stderr.String(), "missing.pem")
+	})
+
+	t.Run("bad flags", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		require.Equal(t, 2, run([]string{"-addr", addr, "add"}, nil, &stdout, &stderr))
+		require.Equal(t, 2, run([]string{"-proto", protoFile, "-addr", addr}, nil, &stdout, &stderr))
+		require.Contains(t, stderr.String(), "Usage: avroipc-call")
+	})
+}
+
+func TestRun_Verbose(t *testing.T) {
+	// A server with a different declaration text has a different protocol
+	// hash, so it sends its protocol in the handshake.
+	serverProto := strings.Replace(readProto(t), "A simple protocol for tests.", "A server protocol.", 1)
+	addr := runServer(t, serverProto)
+
+	var stdout, stderr bytes.Buffer
+	code := run([]string{"-v", "-proto", protoFile, "-addr", addr, "add", `{"arg1": 1, "arg2": 2}`}, nil, &stdout, &stderr)
+	require.Equal(t, 0, code, stderr.String())
+	require.Equal(t, "3\n", stdout.String())
+
+	out := stderr.String()
+	require.Contains(t, out, "> handshake: client protocol sent: false\n")
+	require.Contains(t, out, "< handshake: match: NONE\n")
+	require.Contains(t, out, "< server hash: ")
+	require.Contains(t, out, "< server protocol: "+strings.TrimSpace(serverProto)+"\n")
+	require.Contains(t, out, "> handshake: client protocol sent: true\n")
+	require.Contains(t, out, "> call: add map[arg1:1 arg2:2]\n")
+}
+
+func TestProbe(t *testing.T) {
+	t.Run("same protocol", func(t *testing.T) {
+		addr := runServer(t, readProto(t))
+
+		var stdout, stderr bytes.Buffer
+		code := run([]string{"probe", "-strict", "-proto", protoFile, "-addr", addr}, nil, &stdout, &stderr)
+		require.Equal(t, 0, code, stderr.String())
+		require.Contains(t, stdout.String(), "initial match: BOTH\nmatch: BOTH\nclient protocol sent: false\n")
+		require.Contains(t, stdout.String(), "protocols are equal\n")
+	})
+
+	t.Run("different protocol", func(t *testing.T) {
+		serverProto := strings.Replace(readProto(t), "A simple protocol for tests.", "A server protocol.", 1)
+		addr := runServer(t, serverProto)
+
+		var stdout, stderr bytes.Buffer
+		code := run([]string{"probe", "-proto", protoFile, "-addr", addr}, nil, &stdout, &stderr)
+		require.Equal(t, 0, code, stderr.String())
+
+		out := stdout.String()
+		require.Contains(t, out, "initial match: NONE\nmatch: BOTH\nclient protocol sent: true\n")
+		require.Contains(t, out, "server protocol:\n"+strings.TrimSpace(serverProto)+"\n")
+		require.Contains(t, out, "diff:\n--- client\n+++ server\n")
+		require.Contains(t, out, "\n-  \"doc\": \"A simple protocol for tests.\",\n+  \"doc\": \"A server protocol.\",\n")
+
+		code = run([]string{"probe", "-strict", "-proto", protoFile, "-addr", addr}, nil, &stdout, &stderr)
+		require.Equal(t, 1, code)
+	})
+
+	t.Run("bad flags", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		require.Equal(t, 2, run([]string{"probe", "-proto", protoFile}, nil, &stdout, &stderr))
+		require.Contains(t, stderr.String(), "Usage: avroipc-call probe")
+	})
+}
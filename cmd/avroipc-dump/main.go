@@ -0,0 +1,389 @@
+// Command avroipc-dump decodes captured Avro RPC traffic and prints framed
+// requests and responses with their handshakes, call metadata and datums.
+// Datums are decoded with a protocol declaration (an .avpr file) or with the
+// protocol of the Flume Avro source.
+//
+// Traffic may be read from a pcap capture written by tcpdump, e.g. with
+// "tcpdump -w capture.pcap -s 0 tcp port 41414", from a session written by
+// the recording transport or from raw streams of the client and the server.
+//
+// Usage:
+//
+//	avroipc-dump -flume -port 41414 [flags] capture.pcap
+//	avroipc-dump -proto service.avpr -session session.jsonl [flags]
+//	avroipc-dump -proto service.avpr -client requests.bin -server responses.bin [flags]
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/myzhan/avroipc/dissector"
+	"github.com/myzhan/avroipc/flume"
+	"github.com/myzhan/avroipc/protocols"
+	"github.com/myzhan/avroipc/transports"
+)
+
+type options struct {
+	port       int
+	session    string
+	client     string
+	server     string
+	protoFile  string
+	flume      bool
+	skip       bool
+	compressed bool
+	dump       bool
+	json       bool
+}
+
+// connection is a pair of streams to dissect.
+type connection struct {
+	name       string
+	client     []byte
+	server     []byte
+	incomplete bool
+}
+
+// record is a request or a response in the JSON output.
+type record struct {
+	Connection  string      `json:"connection,omitempty"`
+	Direction   string      `json:"direction"`
+	Serial      uint32      `json:"serial"`
+	Frames      []int       `json:"frames"`
+	Size        int         `json:"size"`
+	Handshake   interface{} `json:"handshake,omitempty"`
+	Meta        interface{} `json:"meta,omitempty"`
+	Method      string      `json:"method,omitempty"`
+	Datum       interface{} `json:"datum,omitempty"`
+	Error       string      `json:"error,omitempty"`
+	Rest        string      `json:"rest,omitempty"`
+	DecodeError string      `json:"decodeError,omitempty"`
+	Dump        string      `json:"dump,omitempty"`
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	var opts options
+
+	fs := flag.NewFlagSet("avroipc-dump", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: avroipc-dump [flags] capture.pcap")
+		fmt.Fprintln(stderr, "       avroipc-dump [flags] -session file")
+		fmt.Fprintln(stderr, "       avroipc-dump [flags] -client file -server file")
+		fs.PrintDefaults()
+	}
+	fs.IntVar(&opts.port, "port", 0, "server port of connections in the capture, 0 detects servers by SYN packets")
+	fs.StringVar(&opts.session, "session", "", "session file written by the recording transport")
+	fs.StringVar(&opts.client, "client", "", "file with raw bytes sent by the client")
+	fs.StringVar(&opts.server, "server", "", "file with raw bytes sent by the server")
+	fs.StringVar(&opts.protoFile, "proto", "", "protocol declaration (.avpr) to decode datums")
+	fs.BoolVar(&opts.flume, "flume", false, "decode datums with the protocol of the Flume Avro source")
+	fs.BoolVar(&opts.skip, "skip-handshake", false, "streams start after the handshake")
+	fs.BoolVar(&opts.compressed, "compressed", false, "streams are compressed with zlib")
+	fs.BoolVar(&opts.dump, "hex", false, "print hex dumps of payloads")
+	fs.BoolVar(&opts.json, "json", false, "print a JSON object per request and response")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	inputs := fs.NArg()
+	if opts.session != "" {
+		inputs++
+	}
+	if opts.client != "" || opts.server != "" {
+		inputs++
+	}
+	if inputs != 1 || fs.NArg() > 1 || opts.port < 0 || opts.port > 65535 || (opts.flume && opts.protoFile != "") {
+		fs.Usage()
+		return 2
+	}
+
+	config := &dissector.Config{
+		SkipHandshake: opts.skip,
+		Compressed:    opts.compressed,
+	}
+	var err error
+	config.Protocol, err = loadProtocol(&opts)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	conns, err := readConnections(fs.Arg(0), &opts)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	if len(conns) == 0 {
+		fmt.Fprintln(stderr, "no connections found")
+		return 1
+	}
+
+	for _, conn := range conns {
+		r, err := dissector.Dissect(conn.client, conn.server, config)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		if opts.json {
+			err = printJSON(stdout, conn, r, &opts)
+		} else {
+			err = printText(stdout, conn, r, &opts)
+		}
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+	}
+
+	return 0
+}
+
+func loadProtocol(opts *options) (protocols.MessageProtocol, error) {
+	if opts.flume {
+		return flume.NewAvroSource()
+	}
+	if opts.protoFile == "" {
+		return nil, nil
+	}
+
+	avpr, err := os.ReadFile(opts.protoFile)
+	if err != nil {
+		return nil, err
+	}
+	return protocols.ParseProtocol(string(avpr))
+}
+
+func readConnections(capture string, opts *options) ([]*connection, error) {
+	switch {
+	case capture != "":
+		f, err := os.Open(capture)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		captured, err := dissector.ReadPcap(f, uint16(opts.port))
+		if err != nil {
+			return nil, err
+		}
+
+		conns := make([]*connection, 0, len(captured))
+		for _, c := range captured {
+			conns = append(conns, &connection{
+				name:       c.Client.String() + " -> " + c.Server.String(),
+				client:     c.ClientData,
+				server:     c.ServerData,
+				incomplete: c.Incomplete,
+			})
+		}
+		return conns, nil
+	case opts.session != "":
+		f, err := os.Open(opts.session)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		exchanges, err := transports.ReadExchanges(f)
+		if err != nil {
+			return nil, err
+		}
+
+		conn := &connection{}
+		for _, e := range exchanges {
+			conn.client = append(conn.client, e.Request...)
+			conn.server = append(conn.server, e.Response...)
+		}
+		return []*connection{conn}, nil
+	default:
+		conn := &connection{}
+		var err error
+		if opts.client != "" {
+			conn.client, err = os.ReadFile(opts.client)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if opts.server != "" {
+			conn.server, err = os.ReadFile(opts.server)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return []*connection{conn}, nil
+	}
+}
+
+func printText(w io.Writer, conn *connection, r *dissector.Result, opts *options) error {
+	var buf bytes.Buffer
+	if conn.name != "" {
+		fmt.Fprintf(&buf, "connection %s\n", conn.name)
+	}
+	if conn.incomplete {
+		fmt.Fprintln(&buf, "! some segments are missing in the capture, data after them is dropped")
+	}
+
+	for _, e := range r.Exchanges {
+		for _, rec := range []*record{newRecord(e.Request, "request", opts), newRecord(e.Response, "response", opts)} {
+			if rec == nil {
+				continue
+			}
+
+			prefix := ">"
+			if rec.Direction == "response" {
+				prefix = "<"
+			}
+			fmt.Fprintf(&buf, "%s %s serial=%d frames=%v size=%d\n", prefix, rec.Direction, rec.Serial, rec.Frames, rec.Size)
+
+			if rec.DecodeError != "" {
+				fmt.Fprintf(&buf, "    decode error: %s\n", rec.DecodeError)
+			}
+			for _, field := range []struct {
+				name  string
+				value interface{}
+			}{
+				{"handshake", rec.Handshake},
+				{"meta", rec.Meta},
+				{"datum", rec.Datum},
+			} {
+				if field.value == nil {
+					continue
+				}
+				b, err := json.Marshal(field.value)
+				if err != nil {
+					return err
+				}
+				fmt.Fprintf(&buf, "    %s: %s\n", field.name, b)
+			}
+			if rec.Method != "" {
+				fmt.Fprintf(&buf, "    method: %s\n", rec.Method)
+			}
+			if rec.Error != "" {
+				fmt.Fprintf(&buf, "    error: %s\n", rec.Error)
+			}
+			if rec.Rest != "" {
+				fmt.Fprintf(&buf, "    rest: %s\n", rec.Rest)
+			}
+			if rec.Dump != "" {
+				fmt.Fprint(&buf, rec.Dump)
+			}
+		}
+	}
+
+	if r.ClientRest > 0 {
+		fmt.Fprintf(&buf, "! %d bytes at the end of the client stream are not a complete request\n", r.ClientRest)
+	}
+	if r.ServerRest > 0 {
+		fmt.Fprintf(&buf, "! %d bytes at the end of the server stream are not a complete response\n", r.ServerRest)
+	}
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func printJSON(w io.Writer, conn *connection, r *dissector.Result, opts *options) error {
+	encoder := json.NewEncoder(w)
+	for _, e := range r.Exchanges {
+		for _, rec := range []*record{newRecord(e.Request, "request", opts), newRecord(e.Response, "response", opts)} {
+			if rec == nil {
+				continue
+			}
+			rec.Connection = conn.name
+			if err := encoder.Encode(rec); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func newRecord(r *dissector.Record, direction string, opts *options) *record {
+	if r == nil {
+		return nil
+	}
+
+	rec := &record{
+		Direction: direction,
+		Serial:    r.Serial,
+		Frames:    r.Frames,
+		Size:      len(r.Payload),
+	}
+	if opts.dump {
+		rec.Dump = hex.Dump(r.Payload)
+	}
+	if r.Err != nil {
+		rec.DecodeError = r.Err.Error()
+		return rec
+	}
+
+	m := r.Message
+	if m.Handshake != nil {
+		rec.Handshake = printable(m.Handshake)
+	}
+	if len(m.Meta) > 0 {
+		rec.Meta = printable(m.Meta)
+	}
+	rec.Method = m.Method
+	if m.Datum != nil {
+		rec.Datum = printable(m.Datum)
+	}
+	if m.Error != nil {
+		rec.Error = m.Error.Error()
+	}
+	if m.Rest != nil {
+		rec.Rest = hex.EncodeToString(m.Rest)
+	}
+
+	return rec
+}
+
+// printable converts bytes of decoded datums to text if they are readable
+// or to hex strings otherwise, e.g. for hashes of protocols.
+func printable(v interface{}) interface{} {
+	switch v := v.(type) {
+	case []byte:
+		if isText(v) {
+			return string(v)
+		}
+		return hex.EncodeToString(v)
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			m[k] = printable(item)
+		}
+		return m
+	case []interface{}:
+		a := make([]interface{}, len(v))
+		for i, item := range v {
+			a[i] = printable(item)
+		}
+		return a
+	default:
+		return v
+	}
+}
+
+func isText(b []byte) bool {
+	if !utf8.Valid(b) {
+		return false
+	}
+	for _, r := range string(b) {
+		if !unicode.IsPrint(r) && !unicode.IsSpace(r) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/myzhan/avroipc"
+	"github.com/myzhan/avroipc/flume"
+	"github.com/myzhan/avroipc/flumetest"
+	"github.com/myzhan/avroipc/transports"
+)
+
+// recordSession sends an event to a fake agent and writes the session to a
+// file.
+func recordSession(t *testing.T) string {
+	a := flumetest.NewAgent(t)
+
+	var session bytes.Buffer
+	config := avroipc.NewConfig().WithDialer(func(addr string) (transports.Transport, error) {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			return nil, err
+		}
+		return transports.NewRecording(transports.NewConn(conn), &session), nil
+	})
+
+	client, err := flume.NewClientWithConfig(a.Addr(), config)
+	require.NoError(t, err)
+	_, err = client.Append(&flume.Event{Headers: map[string]string{"k": "v"}, Body: []byte("hello")})
+	require.NoError(t, err)
+	require.NoError(t, client.Close())
+
+	file := filepath.Join(t.TempDir(), "session.jsonl")
+	require.NoError(t, os.WriteFile(file, session.Bytes(), 0o600))
+
+	return file
+}
+
+// writePcap writes a capture with a raw IPv4 packet per stream.
+func writePcap(t *testing.T, client, server []byte) string {
+	packet := func(src, dst byte, srcPort, dstPort uint16, data []byte) []byte {
+		b := make([]byte, 40, 40+len(data))
+		b[0] = 0x45
+		binary.BigEndian.PutUint16(b[2:4], uint16(40+len(data)))
+		b[9] = 6
+		copy(b[12:16], []byte{10, 0, 0, src})
+		copy(b[16:20], []byte{10, 0, 0, dst})
+		binary.BigEndian.PutUint16(b[20:22], srcPort)
+		binary.BigEndian.PutUint16(b[22:24], dstPort)
+		b[32] = 5 << 4
+		return append(b, data...)
+	}
+
+	var buf bytes.Buffer
+	header := make([]byte, 24)
+	binary.LittleEndian.PutUint32(header[0:4], 0xa1b2c3d4)
+	binary.LittleEndian.PutUint32(header[20:24], 101)
+	buf.Write(header)
+	for _, p := range [][]byte{
+		packet(1, 2, 50000, 41414, client),
+		packet(2, 1, 41414, 50000, server),
+	} {
+		packetHeader := make([]byte, 16)
+		binary.LittleEndian.PutUint32(packetHeader[8:12], uint32(len(p)))
+		binary.LittleEndian.PutUint32(packetHeader[12:16], uint32(len(p)))
+		buf.Write(packetHeader)
+		buf.Write(p)
+	}
+
+	file := filepath.Join(t.TempDir(), "capture.pcap")
+	require.NoError(t, os.WriteFile(file, buf.Bytes(), 0o600))
+
+	return file
+}
+
+func readStreams(t *testing.T, session string) ([]byte, []byte) {
+	f, err := os.Open(session)
+	require.NoError(t, err)
+	defer f.Close()
+
+	exchanges, err := transports.ReadExchanges(f)
+	require.NoError(t, err)
+
+	var client, server []byte
+	for _, e := range exchanges {
+		client = append(client, e.Request...)
+		server = append(server, e.Response...)
+	}
+	return client, server
+}
+
+func TestRun(t *testing.T) {
+	session := recordSession(t)
+
+	t.Run("session", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		require.Equal(t, 0, run([]string{"-flume", "-session", session}, &stdout, &stderr), stderr.String())
+
+		out := stdout.String()
+		require.NotContains(t, out, "connection")
+		require.Contains(t, out, "> request serial=1 frames=")
+		require.Contains(t, out, `"match":"BOTH"`)
+		require.Contains(t, out, "> request serial=2 frames=")
+		require.Contains(t, out, "    method: append\n")
+		require.Contains(t, out, `    datum: {"body":"hello","headers":{"k":"v"}}`)
+		require.Contains(t, out, "< response serial=2 frames=")
+		require.Contains(t, out, "    datum: \"OK\"\n")
+	})
+
+	t.Run("raw streams without protocol", func(t *testing.T) {
+		client, server := readStreams(t, session)
+		dir := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "client"), client, 0o600))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "server"), server[:len(server)-1], 0o600))
+
+		var stdout, stderr bytes.Buffer
+		code := run([]string{"-hex", "-client", filepath.Join(dir, "client"), "-server", filepath.Join(dir, "server")}, &stdout, &stderr)
+		require.Equal(t, 0, code, stderr.String())
+
+		out := stdout.String()
+		require.Contains(t, out, "    method: append\n")
+		require.Contains(t, out, "    rest: ")
+		require.Contains(t, out, "00000000  ")
+		require.Contains(t, out, "bytes at the end of the server stream are not a complete response")
+	})
+
+	t.Run("pcap as json", func(t *testing.T) {
+		client, server := readStreams(t, session)
+		capture := writePcap(t, client, server)
+
+		var stdout, stderr bytes.Buffer
+		require.Equal(t, 0, run([]string{"-flume", "-json", "-port", "41414", capture}, &stdout, &stderr), stderr.String())
+
+		var records []record
+		d := json.NewDecoder(&stdout)
+		for d.More() {
+			var r record
+			require.NoError(t, d.Decode(&r))
+			records = append(records, r)
+		}
+		require.Len(t, records, 4)
+		require.Equal(t, "10.0.0.1:50000 -> 10.0.0.2:41414", records[0].Connection)
+		require.Equal(t, "request", records[2].Direction)
+		require.Equal(t, uint32(2), records[2].Serial)
+		require.Equal(t, "append", records[2].Method)
+		require.Equal(t, "response", records[3].Direction)
+		require.Equal(t, "OK", records[3].Datum)
+
+		stdout.Reset()
+		require.Equal(t, 1, run([]string{"-port", "80", capture}, &stdout, &stderr))
+		require.Equal(t, "no connections found\n", stderr.String())
+	})
+
+	t.Run("skipped handshake", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		require.Equal(t, 0, run([]string{"-skip-handshake", "-session", session}, &stdout, &stderr), stderr.String())
+		require.Contains(t, stdout.String(), "    decode error: ")
+	})
+
+	t.Run("bad flags", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		require.Equal(t, 2, run(nil, &stdout, &stderr))
+		require.Equal(t, 2, run([]string{"-session", session, "capture.pcap"}, &stdout, &stderr))
+		require.Equal(t, 2, run([]string{"-flume", "-proto", "x.avpr", "capture.pcap"}, &stdout, &stderr))
+		require.Contains(t, stderr.String(), "Usage: avroipc-dump")
+	})
+}
@@ -0,0 +1,228 @@
+// Command flume-avro-client sends events to a Flume Avro source like the
+// avro-client of flume-ng. Events are read from the standard input or a file,
+// either one event per line or one JSON object per line:
+//
+//	{"headers": {"topic": "test"}, "body": "hello"}
+//
+// Usage:
+//
+//	flume-avro-client -addr localhost:41414 [flags] [file]
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/myzhan/avroipc"
+	"github.com/myzhan/avroipc/flume"
+	"github.com/myzhan/avroipc/internal/cli"
+)
+
+type options struct {
+	addr        string
+	format      string
+	batchSize   int
+	headers     cli.Headers
+	timeout     time.Duration
+	sendTimeout time.Duration
+	compression int
+	retries     int
+	tls         cli.TLSFlags
+	quiet       bool
+}
+
+type jsonEvent struct {
+	Headers map[string]string `json:"headers"`
+	Body    string            `json:"body"`
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	opts := options{headers: cli.Headers{}}
+
+	fs := flag.NewFlagSet("flume-avro-client", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: flume-avro-client -addr host:port [flags] [file]")
+		fs.PrintDefaults()
+	}
+	fs.StringVar(&opts.addr, "addr", "", "address of the Flume Avro source")
+	fs.StringVar(&opts.format, "format", "line", "input format: line (an event per line) or json (JSON lines with headers and body)")
+	fs.IntVar(&opts.batchSize, "batch", 100, "number of events in a batch")
+	fs.Var(opts.headers, "header", "header `key=value` of every event, may be repeated")
+	fs.DurationVar(&opts.timeout, "timeout", 10*time.Second, "connection timeout")
+	fs.DurationVar(&opts.sendTimeout, "send-timeout", 10*time.Second, "read/write timeout")
+	fs.IntVar(&opts.compression, "compression", 0, "zlib compression level, 0 disables compression")
+	fs.IntVar(&opts.retries, "retries", 0, "number of retries of failed batches")
+	opts.tls.Register(fs)
+	fs.BoolVar(&opts.quiet, "quiet", false, "don't report statuses of batches")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if opts.addr == "" || fs.NArg() > 1 || opts.batchSize <= 0 || (opts.format != "line" && opts.format != "json") {
+		fs.Usage()
+		return 2
+	}
+
+	in := stdin
+	if fs.NArg() == 1 {
+		f, err := os.Open(fs.Arg(0))
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		defer f.Close()
+		in = f
+	}
+
+	config, err := newConfig(&opts)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	client, err := flume.NewClientWithConfig(opts.addr, config, flume.WithStatusErrors())
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	defer client.Close()
+
+	if err := send(client, in, stdout, &opts); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	return 0
+}
+
+func newConfig(opts *options) (*avroipc.Config, error) {
+	tlsConfig, err := opts.tls.Config()
+	if err != nil {
+		return nil, err
+	}
+
+	config := avroipc.NewConfig().
+		WithTimeout(opts.timeout).
+		WithSendTimeout(opts.sendTimeout).
+		WithCompressionLevel(opts.compression).
+		WithTLSConfig(tlsConfig)
+	if opts.retries > 0 {
+		config.WithRetryPolicy(&avroipc.RetryPolicy{MaxAttempts: opts.retries + 1})
+	}
+
+	return config, nil
+}
+
+// send reads events from the input and sends them in batches reporting
+// statuses of batches and the total throughput. Only events of successful
+// batches are counted as sent, events of failed batches are reported
+// separately.
+func send(client flume.Client, in io.Reader, out io.Writer, opts *options) error {
+	r := bufio.NewReader(in)
+	start := time.Now()
+
+	var (
+		batches, events, size            int
+		failed, failedEvents, failedSize int
+	)
+	batch := make([]*flume.Event, 0, opts.batchSize)
+
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		batches++
+
+		batchSize := 0
+		for _, event := range batch {
+			batchSize += len(event.Body)
+		}
+
+		batchStart := time.Now()
+		status, err := client.AppendBatch(batch)
+		if err != nil {
+			failed++
+			failedEvents += len(batch)
+			failedSize += batchSize
+			fmt.Fprintf(out, "batch %d: %d events: %v\n", batches, len(batch), err)
+		} else {
+			events += len(batch)
+			size += batchSize
+			if !opts.quiet {
+				fmt.Fprintf(out, "batch %d: %d events: %s in %v\n", batches, len(batch), status, time.Since(batchStart))
+			}
+		}
+		batch = batch[:0]
+	}
+
+	for line := 1; ; line++ {
+		b, err := r.ReadBytes('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+
+		b = bytes.TrimRight(b, "\r\n")
+		if len(b) > 0 {
+			event, parseErr := parseEvent(b, opts)
+			if parseErr != nil {
+				return fmt.Errorf("line %d: %w", line, parseErr)
+			}
+			batch = append(batch, event)
+			if len(batch) >= opts.batchSize {
+				flush()
+			}
+		}
+
+		if err != nil {
+			break
+		}
+	}
+	flush()
+
+	elapsed := time.Since(start)
+	seconds := elapsed.Seconds()
+	if seconds == 0 {
+		seconds = 1e-9
+	}
+	fmt.Fprintf(out, "sent %d events (%d bytes) in %d batches in %v: %.1f events/s, %.1f bytes/s\n",
+		events, size, batches-failed, elapsed.Round(time.Millisecond), float64(events)/seconds, float64(size)/seconds)
+
+	if failed > 0 {
+		fmt.Fprintf(out, "failed to send %d events (%d bytes) in %d batches\n", failedEvents, failedSize, failed)
+		return fmt.Errorf("%d of %d batches failed", failed, batches)
+	}
+	return nil
+}
+
+func parseEvent(b []byte, opts *options) (*flume.Event, error) {
+	event := &flume.Event{Headers: make(map[string]string, len(opts.headers))}
+	for k, v := range opts.headers {
+		event.Headers[k] = v
+	}
+
+	if opts.format == "line" {
+		event.Body = append([]byte(nil), b...)
+		return event, nil
+	}
+
+	var e jsonEvent
+	if err := json.Unmarshal(b, &e); err != nil {
+		return nil, err
+	}
+	for k, v := range e.Headers {
+		event.Headers[k] = v
+	}
+	event.Body = []byte(e.Body)
+
+	return event, nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/myzhan/avroipc/flume"
+	"github.com/myzhan/avroipc/flumetest"
+)
+
+func TestRun(t *testing.T) {
+	t.Run("lines", func(t *testing.T) {
+		a := flumetest.NewAgent(t)
+
+		var stdout, stderr bytes.Buffer
+		code := run([]string{"-addr", a.Addr(), "-batch", "2", "-header", "topic=test"},
+			strings.NewReader("a\r\nb\n\nc"), &stdout, &stderr)
+		require.Equal(t, 0, code, stderr.String())
+
+		a.RequireBodies(t, "a", "b", "c")
+		require.Len(t, a.Calls(), 2)
+		require.Equal(t, map[string]string{"topic": "test"}, a.Events()[2].Headers)
+		require.Contains(t, stdout.String(), "batch 1: 2 events: OK")
+		require.Contains(t, stdout.String(), "batch 2: 1 events: OK")
+		require.Contains(t, stdout.String(), "sent 3 events (3 bytes) in 2 batches")
+	})
+
+	t.Run("json file", func(t *testing.T) {
+		a := flumetest.NewAgent(t)
+
+		file := filepath.Join(t.TempDir(), "events.json")
+		require.NoError(t, os.WriteFile(file, []byte(`{"headers":{"k":"v"},"body":"a"}`+"\n"), 0o600))
+
+		var stdout, stderr bytes.Buffer
+		code := run([]string{"-addr", a.Addr(), "-format", "json", "-header", "k=x", "-header", "h=y", "-quiet", file},
+			nil, &stdout, &stderr)
+		require.Equal(t, 0, code, stderr.String())
+
+		a.RequireBodies(t, "a")
+		require.Equal(t, map[string]string{"k": "v", "h": "y"}, a.Events()[0].Headers)
+		require.NotContains(t, stdout.String(), "batch 1")
+	})
+
+	t.Run("failed batch", func(t *testing.T) {
+		a := flumetest.NewAgent(t)
+		a.Script(flumetest.Reply{Status: flume.StatusFailed}, flumetest.Reply{Status: flume.StatusUnknown})
+
+		var stdout, stderr bytes.Buffer
+		code := run([]string{"-addr", a.Addr(), "-retries", "1"}, strings.NewReader("a\n"), &stdout, &stderr)
+		require.Equal(t, 1, code)
+		require.Contains(t, stdout.String(), "batch 1: 1 events: unexpected status: UNKNOWN")
+		require.Contains(t, stdout.String(), "sent 0 events (0 bytes) in 0 batches")
+		require.Contains(t, stdout.String(), "failed to send 1 events (1 bytes) in 1 batches")
+		require.Equal(t, "1 of 1 batches failed\n", stderr.String())
+		require.Len(t, a.Calls(), 2)
+	})
+
+	t.Run("partially failed", func(t *testing.T) {
+		a := flumetest.NewAgent(t)
+		a.Script(flumetest.Reply{Status: flume.StatusFailed})
+
+		var stdout, stderr bytes.Buffer
+		code := run([]string{"-addr", a.Addr(), "-batch", "1"}, strings.NewReader("a\nbb\n"), &stdout, &stderr)
+		require.Equal(t, 1, code)
+		require.Contains(t, stdout.String(), "sent 1 events (2 bytes) in 1 batches")
+		require.Contains(t, stdout.String(), "failed to send 1 events (1 bytes) in 1 batches")
+		require.Equal(t, "1 of 2 batches failed\n", stderr.String())
+		a.RequireBodies(t, "bb")
+	})
+
+	t.Run("bad json", func(t *testing.T) {
+		a := flumetest.NewAgent(t)
+
+		var stdout, stderr bytes.Buffer
+		code := run([]string{"-addr", a.Addr(), "-format", "json"}, strings.NewReader("{}\n{"), &stdout, &stderr)
+		require.Equal(t, 1, code)
+		require.Contains(t, stderr.String(), "line 2: unexpected end of JSON input")
+		require.Empty(t, a.Calls())
+	})
+
+	t.Run("missing CA file", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		code := run([]string{"-addr", "x", "-tls", "-tls-ca", "missing.pem"}, strings.NewReader("a\n"), &stdout, &stderr)
+		require.Equal(t, 1, code)
+		require.Contains(t, stderr.String(), "missing.pem")
+	})
+
+	t.Run("bad flags", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		require.Equal(t, 2, run(nil, nil, &stdout, &stderr))
+		require.Equal(t, 2, run([]string{"-addr", "x", "-format", "xml"}, nil, &stdout, &stderr))
+		require.Equal(t, 2, run([]string{"-header", "x"}, nil, &stdout, &stderr))
+		require.Contains(t, stderr.String(), "Usage: flume-avro-client")
+	})
+}
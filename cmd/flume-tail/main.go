@@ -0,0 +1,140 @@
+// Command flume-tail follows files and ships their lines to a Flume Avro
+// source. Read offsets are kept in a checkpoint file, so lines are not lost
+// when the command is restarted. Files are given as paths or glob patterns:
+//
+//	flume-tail -addr localhost:41414 -checkpoint /var/lib/flume-tail.json '/var/log/app/*.log'
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/myzhan/avroipc"
+	"github.com/myzhan/avroipc/flume"
+	"github.com/myzhan/avroipc/internal/cli"
+	"github.com/myzhan/avroipc/logger"
+	"github.com/myzhan/avroipc/tail"
+)
+
+type options struct {
+	addr        string
+	checkpoint  string
+	poll        time.Duration
+	batchSize   int
+	maxLine     int
+	headers     cli.Headers
+	skipToEnd   bool
+	once        bool
+	timeout     time.Duration
+	sendTimeout time.Duration
+	compression int
+	tls         cli.TLSFlags
+	verbose     bool
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	code := run(ctx, os.Args[1:], os.Stderr)
+	stop()
+	os.Exit(code)
+}
+
+func run(ctx context.Context, args []string, stderr io.Writer) int {
+	opts := options{headers: cli.Headers{}}
+
+	fs := flag.NewFlagSet("flume-tail", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: flume-tail -addr host:port [flags] file...")
+		fs.PrintDefaults()
+	}
+	fs.StringVar(&opts.addr, "addr", "", "address of the Flume Avro source")
+	fs.StringVar(&opts.checkpoint, "checkpoint", "", "file with read offsets, offsets are not persisted if empty")
+	fs.DurationVar(&opts.poll, "poll", 250*time.Millisecond, "interval of checking files for new lines")
+	fs.IntVar(&opts.batchSize, "batch", 100, "maximum number of events in a batch")
+	fs.IntVar(&opts.maxLine, "max-line", 1<<20, "maximum size of a line in bytes, longer lines are split")
+	fs.Var(opts.headers, "header", "header `key=value` of every event, may be repeated")
+	fs.BoolVar(&opts.skipToEnd, "skip-to-end", false, "read files without checkpoints from the end")
+	fs.BoolVar(&opts.once, "once", false, "send available lines and exit instead of following files")
+	fs.DurationVar(&opts.timeout, "timeout", 10*time.Second, "connection timeout")
+	fs.DurationVar(&opts.sendTimeout, "send-timeout", 10*time.Second, "read/write timeout")
+	fs.IntVar(&opts.compression, "compression", 0, "zlib compression level, 0 disables compression")
+	opts.tls.Register(fs)
+	fs.BoolVar(&opts.verbose, "v", false, "log rotated and truncated files")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if opts.addr == "" || fs.NArg() == 0 || opts.batchSize <= 0 || opts.maxLine <= 0 {
+		fs.Usage()
+		return 2
+	}
+
+	config, err := newConfig(&opts)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	client, err := flume.NewClientWithConfig(opts.addr, config, flume.WithStatusErrors())
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	defer client.Close()
+
+	level := slog.LevelWarn
+	if opts.verbose {
+		level = slog.LevelInfo
+	}
+	log := slog.New(slog.NewTextHandler(stderr, &slog.HandlerOptions{Level: level}))
+
+	t, err := tail.New(client, &tail.Config{
+		Files:        fs.Args(),
+		Checkpoint:   opts.checkpoint,
+		SkipToEnd:    opts.skipToEnd,
+		PollInterval: opts.poll,
+		BatchSize:    opts.batchSize,
+		MaxLineSize:  opts.maxLine,
+		Headers:      opts.headers,
+		Logger:       logger.NewSlog(log),
+	})
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	defer t.Close()
+
+	if opts.once {
+		err = t.Poll(ctx)
+	} else {
+		err = t.Run(ctx)
+	}
+	if err != nil && !errors.Is(err, context.Canceled) {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	return 0
+}
+
+func newConfig(opts *options) (*avroipc.Config, error) {
+	tlsConfig, err := opts.tls.Config()
+	if err != nil {
+		return nil, err
+	}
+
+	config := avroipc.NewConfig().
+		WithTimeout(opts.timeout).
+		WithSendTimeout(opts.sendTimeout).
+		WithCompressionLevel(opts.compression).
+		WithTLSConfig(tlsConfig)
+
+	return config, nil
+}
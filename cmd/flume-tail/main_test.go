@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/myzhan/avroipc/flume"
+	"github.com/myzhan/avroipc/flumetest"
+)
+
+func TestRun(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("once", func(t *testing.T) {
+		a := flumetest.NewAgent(t)
+
+		dir := t.TempDir()
+		file := filepath.Join(dir, "a.log")
+		checkpoint := filepath.Join(dir, "checkpoint.json")
+		require.NoError(t, os.WriteFile(file, []byte("a\nb\n"), 0o600))
+
+		args := []string{"-addr", a.Addr(), "-once", "-checkpoint", checkpoint, "-header", "topic=test", filepath.Join(dir, "*.log")}
+
+		var stderr bytes.Buffer
+		require.Equal(t, 0, run(ctx, args, &stderr), stderr.String())
+		a.RequireBodies(t, "a", "b")
+		require.Equal(t, map[string]string{"topic": "test", "file": file, "offset": "2"}, a.Events()[1].Headers)
+
+		// Lines are not sent again after a restart.
+		require.Equal(t, 0, run(ctx, args, &stderr), stderr.String())
+		require.Len(t, a.Calls(), 1)
+	})
+
+	t.Run("follow", func(t *testing.T) {
+		a := flumetest.NewAgent(t)
+		file := filepath.Join(t.TempDir(), "a.log")
+
+		ctx, cancel := context.WithCancel(ctx)
+		done := make(chan int)
+		var stderr bytes.Buffer
+		go func() { done <- run(ctx, []string{"-addr", a.Addr(), "-poll", "1ms", file}, &stderr) }()
+
+		require.NoError(t, os.WriteFile(file, []byte("a\n"), 0o600))
+		a.WaitForEvents(t, 1, time.Second)
+		cancel()
+		require.Equal(t, 0, <-done, stderr.String())
+	})
+
+	t.Run("failed batch", func(t *testing.T) {
+		a := flumetest.NewAgent(t)
+		a.Script(flumetest.Reply{Status: flume.StatusFailed})
+
+		file := filepath.Join(t.TempDir(), "a.log")
+		require.NoError(t, os.WriteFile(file, []byte("a\n"), 0o600))
+
+		var stderr bytes.Buffer
+		require.Equal(t, 1, run(ctx, []string{"-addr", a.Addr(), "-once", file}, &stderr))
+		require.Equal(t, file+": unexpected status: FAILED\n", stderr.String())
+	})
+
+	t.Run("missing CA file", func(t *testing.T) {
+		var stderr bytes.Buffer
+		require.Equal(t, 1, run(ctx, []string{"-addr", "x", "-tls", "-tls-ca", "missing.pem", "a.log"}, &stderr))
+		require.Contains(t, stderr.String(), "missing.pem")
+	})
+
+	t.Run("bad flags", func(t *testing.T) {
+		var stderr bytes.Buffer
+		require.Equal(t, 2, run(ctx, nil, &stderr))
+		require.Equal(t, 2, run(ctx, []string{"-addr", "x"}, &stderr))
+		require.Equal(t, 2, run(ctx, []string{"-addr", "x", "-batch", "0", "a.log"}, &stderr))
+		require.Contains(t, stderr.String(), "Usage: flume-tail")
+	})
+}
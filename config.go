@@ -3,6 +3,12 @@ package avroipc
 import (
 	"crypto/tls"
 	"time"
+
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/myzhan/avroipc/logger"
+	"github.com/myzhan/avroipc/transports"
 )
 
 // Config provides a configuration for the client. Use the NewConfig method
@@ -18,6 +24,32 @@ type Config struct {
 	// Defaults to zero which means disabled connection timeout.
 	Timeout time.Duration
 
+	// A function that establishes connections instead of the built-in socket
+	// transport, e.g. to record sessions with the transports.NewRecording or
+	// to replay them with the transports.NewReplay. It is called for every
+	// connection including reconnections. The Timeout and KeepAlive options
+	// are not used when it is set.
+	//
+	// Defaults to nil which means that the built-in socket transport will be
+	// used.
+	Dialer func(addr string) (transports.Transport, error)
+
+	// A period between TCP keep-alive probes of the built-in socket transport.
+	//
+	// Defaults to zero which means that the default period of the Go net
+	// package will be used. A negative value disables keep-alive probes.
+	KeepAlive time.Duration
+
+	// An interval of application-level pings. The client sends a ping
+	// request (an empty request without a message name that is answered by
+	// the server without calling any message) if there were no other
+	// requests during this interval. A failed ping marks the connection as
+	// broken and the client reconnects to the server immediately or before
+	// sending the next request.
+	//
+	// Defaults to zero which means that pings are disabled.
+	PingInterval time.Duration
+
 	// Used to set read and write deadline of the built-in transports
 	// (actually, affects only the socket transport). It sets both deadlines
 	// together at the same time and there is no way to set them separately.
@@ -31,6 +63,46 @@ type Config struct {
 	// Defaults to zero which means disabled read/write timeouts.
 	SendTimeout time.Duration
 
+	// A policy of retrying failed messages. By default only transport errors
+	// are retried (see the IsRetryable function), the connection is
+	// reestablished before each retry.
+	//
+	// Defaults to nil which means that failed messages are not retried.
+	RetryPolicy *RetryPolicy
+
+	// A collector of client metrics.
+	//
+	// Defaults to nil which means that metrics are not collected.
+	Metrics Metrics
+
+	// A provider of OpenTelemetry tracers. The client creates spans for
+	// messages, handshakes, reconnections and reading and writing of frames.
+	//
+	// Defaults to nil which means that a no-op tracer is used.
+	TracerProvider trace.TracerProvider
+
+	// A propagator that injects a trace context into the call metadata of
+	// messages sent with a context.
+	//
+	// Defaults to nil which means that the W3C trace context format is used.
+	Propagator propagation.TextMapPropagator
+
+	// A logger used by the client and all its components. See the logger
+	// package for adapters of popular logging libraries.
+	//
+	// Defaults to nil which means that all messages are discarded.
+	Logger logger.Logger
+
+	// Enables the debug layer that logs every request and response with its
+	// serial, frame sizes, a hex dump and decoded handshakes, call metadata,
+	// message names and datums. Messages are logged with the info level to
+	// the configured logger or to the standard error if the logger is not
+	// set. The debug layer may be also enabled for all clients by setting
+	// the AVROIPC_DEBUG environment variable to a true value.
+	//
+	// Defaults to false.
+	Debug bool
+
 	// A buffer size of the built-in buffered transport.
 	//
 	// Defaults to zero which means that the buffered transport won't be used.
@@ -44,6 +116,23 @@ type Config struct {
 	//
 	// Defaults to false
 	TLSConfig *tls.Config
+
+	// A maximum size of outgoing frames of the framing layer. Larger requests
+	// are split into several frames of this size.
+	//
+	// Defaults to zero which means that the layers.DefaultFrameSize will be used.
+	FrameSize int
+	// A maximum number of frames in a single response. Responses with more
+	// frames are rejected with a *layers.LimitError before reading them.
+	//
+	// Defaults to zero which means no limit.
+	MaxFrames int
+	// A maximum total size of frames of a single response in bytes. Responses
+	// with larger frames are rejected with a *layers.LimitError before
+	// allocating memory for them.
+	//
+	// Defaults to zero which means no limit.
+	MaxResponseSize int
 }
 
 // NewConfig returns a pointer to a new Config instance that is used to
@@ -69,12 +158,66 @@ func (c *Config) WithTimeout(t time.Duration) *Config {
 	return c
 }
 
+// Sets the function that establishes connections.
+func (c *Config) WithDialer(d func(addr string) (transports.Transport, error)) *Config {
+	c.Dialer = d
+	return c
+}
+
+// Sets the period between TCP keep-alive probes.
+func (c *Config) WithKeepAlive(t time.Duration) *Config {
+	c.KeepAlive = t
+	return c
+}
+
+// Sets the interval of application-level pings.
+func (c *Config) WithPingInterval(t time.Duration) *Config {
+	c.PingInterval = t
+	return c
+}
+
 // Sets the read/write timeouts together.
 func (c *Config) WithSendTimeout(t time.Duration) *Config {
 	c.SendTimeout = t
 	return c
 }
 
+// Sets the policy of retrying failed messages.
+func (c *Config) WithRetryPolicy(p *RetryPolicy) *Config {
+	c.RetryPolicy = p
+	return c
+}
+
+// Sets the collector of client metrics.
+func (c *Config) WithMetrics(m Metrics) *Config {
+	c.Metrics = m
+	return c
+}
+
+// Sets the provider of OpenTelemetry tracers.
+func (c *Config) WithTracerProvider(p trace.TracerProvider) *Config {
+	c.TracerProvider = p
+	return c
+}
+
+// Sets the propagator of trace contexts.
+func (c *Config) WithPropagator(p propagation.TextMapPropagator) *Config {
+	c.Propagator = p
+	return c
+}
+
+// Sets the logger.
+func (c *Config) WithLogger(l logger.Logger) *Config {
+	c.Logger = l
+	return c
+}
+
+// Enables the debug layer.
+func (c *Config) WithDebug(enabled bool) *Config {
+	c.Debug = enabled
+	return c
+}
+
 // Sets size of the internal buffer of the buffered transport.
 func (c *Config) WithBufferSize(s int) *Config {
 	c.BufferSize = s
@@ -91,3 +234,21 @@ func (c *Config) WithTLSConfig(cfg *tls.Config) *Config {
 	c.TLSConfig = cfg
 	return c
 }
+
+// Sets the maximum size of outgoing frames.
+func (c *Config) WithFrameSize(s int) *Config {
+	c.FrameSize = s
+	return c
+}
+
+// Sets the maximum number of frames in a single response.
+func (c *Config) WithMaxFrames(n int) *Config {
+	c.MaxFrames = n
+	return c
+}
+
+// Sets the maximum size of a single response.
+func (c *Config) WithMaxResponseSize(s int) *Config {
+	c.MaxResponseSize = s
+	return c
+}
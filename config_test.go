@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/myzhan/avroipc"
+	"github.com/myzhan/avroipc/transports"
 
 	"github.com/stretchr/testify/require"
 )
@@ -15,9 +16,25 @@ func TestConfig(t *testing.T) {
 	c.WithSendTimeout(2)
 	c.WithBufferSize(3)
 	c.WithCompressionLevel(4)
+	c.WithFrameSize(5)
+	c.WithKeepAlive(8)
+	c.WithPingInterval(9)
+	c.WithRetryPolicy(&avroipc.RetryPolicy{MaxAttempts: 10})
+	c.WithMaxFrames(6)
+	c.WithMaxResponseSize(7)
+	c.WithDebug(true)
+	c.WithDialer(func(string) (transports.Transport, error) { return nil, nil })
 
 	require.Equal(t, time.Duration(1), c.Timeout)
 	require.Equal(t, time.Duration(2), c.SendTimeout)
 	require.Equal(t, 3, c.BufferSize)
 	require.Equal(t, 4, c.CompressionLevel)
+	require.Equal(t, 5, c.FrameSize)
+	require.Equal(t, 6, c.MaxFrames)
+	require.Equal(t, 7, c.MaxResponseSize)
+	require.Equal(t, time.Duration(8), c.KeepAlive)
+	require.Equal(t, time.Duration(9), c.PingInterval)
+	require.Equal(t, 10, c.RetryPolicy.MaxAttempts)
+	require.True(t, c.Debug)
+	require.NotNil(t, c.Dialer)
 }
@@ -0,0 +1,192 @@
+// Package dissector decodes captured Avro RPC traffic for debugging. It
+// splits byte streams of a connection into framed requests and responses and
+// decodes handshakes, call metadata and datums of messages with the same
+// decoder that is used by the debug layer of the client.
+//
+// Streams may be taken from a pcap capture with the ReadPcap function, from
+// a session written by the recording transport or from any other source.
+// Streams encrypted with TLS cannot be decoded.
+package dissector
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"io"
+
+	"github.com/myzhan/avroipc/layers"
+	"github.com/myzhan/avroipc/protocols"
+)
+
+// Config provides a configuration for the dissector.
+type Config struct {
+	// A message protocol that is used to decode datums of requests and
+	// responses.
+	//
+	// Defaults to nil which means that only handshakes, call metadata and
+	// message names are decoded.
+	Protocol protocols.MessageProtocol
+
+	// Whether the streams start after the handshake, e.g. because the
+	// capture was started when the connection had been already established.
+	//
+	// Defaults to false which means that the first request and response are
+	// decoded as a handshake. Requests that cannot be decoded as handshakes
+	// are decoded as calls along with all following requests and responses,
+	// so streams without handshakes and client streams without responses
+	// are decoded as well.
+	SkipHandshake bool
+
+	// Whether the streams are compressed with zlib like connections of
+	// clients with a non-zero compression level.
+	//
+	// Defaults to false which means that the streams are not compressed.
+	Compressed bool
+}
+
+// Record is a single framed request or response.
+type Record struct {
+	// A serial number of the request.
+	Serial uint32
+	// Sizes of all frames.
+	Frames []int
+	// Concatenated content of all frames.
+	Payload []byte
+	// A decoded message. It is nil if the payload cannot be decoded.
+	Message *protocols.Message
+	// An error of decoding the payload.
+	Err error
+}
+
+// Exchange is a request and a response with the same serial number.
+type Exchange struct {
+	// A request sent by the client. It is nil if the request is missing in
+	// the client stream.
+	Request *Record
+	// A response sent by the server. It is nil if the response is missing in
+	// the server stream, e.g. for handshake-only requests of a server that
+	// has not replied yet or the capture has been stopped.
+	Response *Record
+}
+
+// Result is a dissected connection.
+type Result struct {
+	// Requests and responses in the order of requests. Responses without
+	// requests are placed at the end.
+	Exchanges []*Exchange
+	// Numbers of bytes at the end of the streams that do not make complete
+	// requests or responses.
+	ClientRest int
+	ServerRest int
+}
+
+// Dissect decodes requests and responses of a single connection. The client
+// and server streams contain all bytes sent in the respective direction in
+// order, either of them may be empty.
+func Dissect(client, server []byte, config *Config) (*Result, error) {
+	decoder, err := protocols.NewDecoder(config.Protocol)
+	if err != nil {
+		return nil, err
+	}
+	if config.SkipHandshake {
+		decoder.SkipHandshake()
+	}
+
+	if config.Compressed {
+		client, err = inflate(client)
+		if err != nil {
+			return nil, err
+		}
+		server, err = inflate(server)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	requests, clientRest := parseRecords(client)
+	responses, serverRest := parseRecords(server)
+
+	r := &Result{
+		ClientRest: clientRest,
+		ServerRest: serverRest,
+	}
+
+	matched := make([]bool, len(responses))
+	for _, request := range requests {
+		request.Message, request.Err = decoder.DecodeRequest(request.Payload)
+		if request.Err != nil && !config.SkipHandshake {
+			// The decoder still expects a handshake if the capture is
+			// started after it or responses completing it are missing. The
+			// decoder is replaced only if the request is decoded as a call,
+			// so the original error is reported otherwise.
+			callDecoder, err := protocols.NewDecoder(config.Protocol)
+			if err != nil {
+				return nil, err
+			}
+			callDecoder.SkipHandshake()
+			if m, err := callDecoder.DecodeRequest(request.Payload); err == nil {
+				decoder = callDecoder
+				request.Message, request.Err = m, nil
+			}
+		}
+		e := &Exchange{Request: request}
+
+		for i, response := range responses {
+			if !matched[i] && response.Serial == request.Serial {
+				matched[i] = true
+				response.Message, response.Err = decoder.DecodeResponse(response.Payload)
+				e.Response = response
+				break
+			}
+		}
+
+		r.Exchanges = append(r.Exchanges, e)
+	}
+
+	for i, response := range responses {
+		if !matched[i] {
+			response.Message, response.Err = decoder.DecodeResponse(response.Payload)
+			r.Exchanges = append(r.Exchanges, &Exchange{Response: response})
+		}
+	}
+
+	return r, nil
+}
+
+func parseRecords(b []byte) ([]*Record, int) {
+	var records []*Record
+	for {
+		frames, n := layers.ParseFrames(b)
+		if n == 0 {
+			return records, len(b)
+		}
+		b = b[n:]
+
+		records = append(records, &Record{
+			Serial:  frames.Serial,
+			Frames:  frames.Sizes,
+			Payload: frames.Payload,
+		})
+	}
+}
+
+// inflate decompresses as much of the stream as possible because captures
+// usually end in the middle of the stream.
+func inflate(b []byte) ([]byte, error) {
+	if len(b) == 0 {
+		return nil, nil
+	}
+
+	r, err := zlib.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	_, err = io.Copy(&out, r)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, err
+	}
+
+	return out.Bytes(), nil
+}
@@ -0,0 +1,202 @@
+package dissector_test
+
+import (
+	"bytes"
+	"compress/zlib"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/myzhan/avroipc"
+	"github.com/myzhan/avroipc/dissector"
+	"github.com/myzhan/avroipc/flume"
+	"github.com/myzhan/avroipc/flumetest"
+	"github.com/myzhan/avroipc/layers"
+	"github.com/myzhan/avroipc/transports"
+)
+
+// recordStreams sends events to a fake agent and returns raw streams sent
+// by the client and the agent.
+func recordStreams(t *testing.T, bodies ...string) ([]byte, []byte) {
+	a := flumetest.NewAgent(t)
+
+	var session bytes.Buffer
+	config := avroipc.NewConfig().
+		WithDialer(func(addr string) (transports.Transport, error) {
+			conn, err := net.Dial("tcp", addr)
+			if err != nil {
+				return nil, err
+			}
+			return transports.NewRecording(transports.NewConn(conn), &session), nil
+		})
+
+	c, err := flume.NewClientWithConfig(a.Addr(), config)
+	require.NoError(t, err)
+	for _, body := range bodies {
+		_, err = c.Append(&flume.Event{Headers: map[string]string{"k": "v"}, Body: []byte(body)})
+		require.NoError(t, err)
+	}
+	require.NoError(t, c.Close())
+
+	exchanges, err := transports.ReadExchanges(&session)
+	require.NoError(t, err)
+
+	var client, server []byte
+	for _, e := range exchanges {
+		client = append(client, e.Request...)
+		server = append(server, e.Response...)
+	}
+
+	return client, server
+}
+
+// compress compresses the stream like the zlib transport. The stream is
+// flushed but not closed like a stream of an active connection.
+func compress(t *testing.T, b []byte) []byte {
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+	_, err := w.Write(b)
+	require.NoError(t, err)
+	require.NoError(t, w.Flush())
+
+	return buf.Bytes()
+}
+
+func prepareProtocol(t *testing.T) *dissector.Config {
+	proto, err := flume.NewAvroSource()
+	require.NoError(t, err)
+
+	return &dissector.Config{Protocol: proto}
+}
+
+func TestDissect(t *testing.T) {
+	event := func(body string) map[string]interface{} {
+		return map[string]interface{}{
+			"headers": map[string]interface{}{"k": "v"},
+			"body":    []byte(body),
+		}
+	}
+
+	t.Run("handshake and calls", func(t *testing.T) {
+		client, server := recordStreams(t, "a", "b")
+
+		r, err := dissector.Dissect(client, server, prepareProtocol(t))
+		require.NoError(t, err)
+		require.Zero(t, r.ClientRest)
+		require.Zero(t, r.ServerRest)
+		require.Len(t, r.Exchanges, 3)
+
+		handshake := r.Exchanges[0]
+		require.Equal(t, uint32(1), handshake.Request.Serial)
+		require.NotNil(t, handshake.Request.Message.Handshake["clientHash"])
+		require.Equal(t, "BOTH", handshake.Response.Message.Handshake["match"])
+
+		for i, body := range []string{"a", "b"} {
+			e := r.Exchanges[i+1]
+			require.NoError(t, e.Request.Err)
+			require.Equal(t, uint32(i+2), e.Request.Serial)
+			require.Equal(t, e.Request.Serial, e.Response.Serial)
+			require.Len(t, e.Request.Frames, 1)
+			require.Nil(t, e.Request.Message.Handshake)
+			require.Equal(t, "append", e.Request.Message.Method)
+			require.Equal(t, event(body), e.Request.Message.Datum)
+			require.Equal(t, "OK", e.Response.Message.Datum)
+		}
+	})
+
+	t.Run("without protocol", func(t *testing.T) {
+		client, server := recordStreams(t, "a")
+
+		r, err := dissector.Dissect(client, server, &dissector.Config{})
+		require.NoError(t, err)
+		require.Len(t, r.Exchanges, 2)
+
+		e := r.Exchanges[1]
+		require.Equal(t, "append", e.Request.Message.Method)
+		require.Nil(t, e.Request.Message.Datum)
+		require.NotEmpty(t, e.Request.Message.Rest)
+		require.Nil(t, e.Response.Message.Datum)
+	})
+
+	t.Run("compressed", func(t *testing.T) {
+		client, server := recordStreams(t, "a")
+
+		config := prepareProtocol(t)
+		config.Compressed = true
+		r, err := dissector.Dissect(compress(t, client), compress(t, server), config)
+		require.NoError(t, err)
+		require.Len(t, r.Exchanges, 2)
+		require.Equal(t, event("a"), r.Exchanges[1].Request.Message.Datum)
+		require.Equal(t, "OK", r.Exchanges[1].Response.Message.Datum)
+	})
+
+	t.Run("skipped handshake", func(t *testing.T) {
+		client, server := recordStreams(t, "a")
+
+		// Cut the handshake off the streams.
+		_, n := layers.ParseFrames(client)
+		client = client[n:]
+		_, n = layers.ParseFrames(server)
+		server = server[n:]
+
+		config := prepareProtocol(t)
+		config.SkipHandshake = true
+		r, err := dissector.Dissect(client, server, config)
+		require.NoError(t, err)
+		require.Len(t, r.Exchanges, 1)
+		require.Equal(t, event("a"), r.Exchanges[0].Request.Message.Datum)
+		require.Equal(t, "OK", r.Exchanges[0].Response.Message.Datum)
+
+		// The missing handshake is detected without the option.
+		r, err = dissector.Dissect(client, server, prepareProtocol(t))
+		require.NoError(t, err)
+		require.Len(t, r.Exchanges, 1)
+		require.Equal(t, event("a"), r.Exchanges[0].Request.Message.Datum)
+		require.Equal(t, "OK", r.Exchanges[0].Response.Message.Datum)
+
+		// Requests that are neither handshakes nor calls keep the error of
+		// the handshake.
+		r, err = dissector.Dissect([]byte{0, 0, 0, 1, 0, 0, 0, 1, 0, 0, 0, 1, 0xff}, nil, prepareProtocol(t))
+		require.NoError(t, err)
+		require.ErrorContains(t, r.Exchanges[0].Request.Err, "cannot decode handshake request")
+		require.Nil(t, r.Exchanges[0].Request.Message)
+	})
+
+	t.Run("client data only", func(t *testing.T) {
+		client, _ := recordStreams(t, "a", "b")
+
+		r, err := dissector.Dissect(client, nil, prepareProtocol(t))
+		require.NoError(t, err)
+		require.Len(t, r.Exchanges, 3)
+		require.NotNil(t, r.Exchanges[0].Request.Message.Handshake["clientHash"])
+		for i, body := range []string{"a", "b"} {
+			e := r.Exchanges[i+1]
+			require.NoError(t, e.Request.Err)
+			require.Equal(t, "append", e.Request.Message.Method)
+			require.Equal(t, event(body), e.Request.Message.Datum)
+			require.Nil(t, e.Response)
+		}
+	})
+
+	t.Run("truncated streams", func(t *testing.T) {
+		client, server := recordStreams(t, "a")
+
+		r, err := dissector.Dissect(client[:len(client)-1], server[:len(server)-1], prepareProtocol(t))
+		require.NoError(t, err)
+		require.Len(t, r.Exchanges, 1)
+		require.NotZero(t, r.ClientRest)
+		require.NotZero(t, r.ServerRest)
+	})
+
+	t.Run("responses without requests", func(t *testing.T) {
+		_, server := recordStreams(t, "a")
+
+		r, err := dissector.Dissect(nil, server, prepareProtocol(t))
+		require.NoError(t, err)
+		require.Len(t, r.Exchanges, 2)
+		require.Nil(t, r.Exchanges[0].Request)
+		require.Equal(t, "BOTH", r.Exchanges[0].Response.Message.Handshake["match"])
+		require.Equal(t, uint32(2), r.Exchanges[1].Response.Serial)
+	})
+}
@@ -0,0 +1,375 @@
+package dissector
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"sort"
+)
+
+// Link types of pcap files supported by the reader.
+const (
+	linkNull      = 0
+	linkEthernet  = 1
+	linkRawAlt    = 12
+	linkRaw       = 101
+	linkLoop      = 108
+	linkLinuxSLL  = 113
+	linkIPv4      = 228
+	linkIPv6      = 229
+	linkLinuxSLL2 = 276
+)
+
+const (
+	etherTypeIPv4 = 0x0800
+	etherTypeIPv6 = 0x86dd
+	etherTypeVLAN = 0x8100
+	etherTypeQinQ = 0x88a8
+
+	protocolTCP = 6
+
+	flagSYN = 0x02
+	flagACK = 0x10
+
+	// A limit of a packet size that protects from allocating huge buffers
+	// for corrupted files.
+	maxPacketSize = 1 << 24
+)
+
+// Connection is a TCP connection reassembled from a capture.
+type Connection struct {
+	// Addresses of the client and the server.
+	Client netip.AddrPort
+	Server netip.AddrPort
+	// All bytes sent by the client and the server in order.
+	ClientData []byte
+	ServerData []byte
+	// Whether some segments of the connection are missing in the capture.
+	// Data after the first missing segment is dropped.
+	Incomplete bool
+}
+
+// ReadPcap reads TCP connections from a capture in the pcap format as it is
+// written by tcpdump. The pcapng format is not supported, such files may be
+// converted with "editcap -F pcap". Packets are expected to be captured with
+// a snapshot length that is enough for whole packets.
+//
+// The port is used to tell servers from clients and to filter connections.
+// If it is zero, clients are detected by SYN packets or, if connections are
+// captured after establishing, by the first sent packets.
+func ReadPcap(r io.Reader, port uint16) ([]*Connection, error) {
+	var header [24]byte
+	_, err := io.ReadFull(r, header[:])
+	if err != nil {
+		return nil, fmt.Errorf("cannot read pcap header: %w", err)
+	}
+
+	var order binary.ByteOrder
+	switch binary.LittleEndian.Uint32(header[0:4]) {
+	case 0xa1b2c3d4, 0xa1b23c4d:
+		order = binary.LittleEndian
+	case 0xd4c3b2a1, 0x4d3cb2a1:
+		order = binary.BigEndian
+	case 0x0a0d0d0a:
+		return nil, errors.New("pcapng files are not supported, convert the file with editcap -F pcap")
+	default:
+		return nil, errors.New("not a pcap file")
+	}
+	// The upper bits may contain information about frame check sequences.
+	link := order.Uint32(header[20:24]) & 0x0fffffff
+
+	t := &tracker{
+		conns: make(map[connKey]*conn),
+	}
+
+	var packetHeader [16]byte
+	for {
+		_, err = io.ReadFull(r, packetHeader[:])
+		if err == io.EOF || errors.Is(err, io.ErrUnexpectedEOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		size := order.Uint32(packetHeader[8:12])
+		if size > maxPacketSize {
+			return nil, fmt.Errorf("bad packet size: %d", size)
+		}
+		packet := make([]byte, size)
+		_, err = io.ReadFull(r, packet)
+		// Captures that are stopped abruptly may end with a partial packet.
+		if err == io.EOF || errors.Is(err, io.ErrUnexpectedEOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		ip, ok := decodeLink(link, packet)
+		if !ok {
+			continue
+		}
+		s, ok := decodeIP(ip)
+		if !ok {
+			continue
+		}
+		t.add(s)
+	}
+
+	return t.connections(port), nil
+}
+
+// decodeLink returns an IP packet of the link layer frame.
+func decodeLink(link uint32, b []byte) ([]byte, bool) {
+	switch link {
+	case linkEthernet:
+		if len(b) < 14 {
+			return nil, false
+		}
+		etherType := binary.BigEndian.Uint16(b[12:14])
+		b = b[14:]
+		for etherType == etherTypeVLAN || etherType == etherTypeQinQ {
+			if len(b) < 4 {
+				return nil, false
+			}
+			etherType = binary.BigEndian.Uint16(b[2:4])
+			b = b[4:]
+		}
+		return b, etherType == etherTypeIPv4 || etherType == etherTypeIPv6
+	case linkLinuxSLL:
+		if len(b) < 16 {
+			return nil, false
+		}
+		etherType := binary.BigEndian.Uint16(b[14:16])
+		return b[16:], etherType == etherTypeIPv4 || etherType == etherTypeIPv6
+	case linkLinuxSLL2:
+		if len(b) < 20 {
+			return nil, false
+		}
+		etherType := binary.BigEndian.Uint16(b[0:2])
+		return b[20:], etherType == etherTypeIPv4 || etherType == etherTypeIPv6
+	case linkNull, linkLoop:
+		// The address family is in the byte order of the capturing host, so
+		// the payload is checked by the IP version instead.
+		if len(b) < 4 {
+			return nil, false
+		}
+		return b[4:], true
+	case linkRaw, linkRawAlt, linkIPv4, linkIPv6:
+		return b, true
+	default:
+		return nil, false
+	}
+}
+
+type segment struct {
+	src, dst netip.AddrPort
+	seq      uint32
+	flags    byte
+	data     []byte
+}
+
+// decodeIP decodes a TCP segment of the IP packet. Fragmented packets and
+// IPv6 extension headers are not supported.
+func decodeIP(b []byte) (*segment, bool) {
+	if len(b) < 1 {
+		return nil, false
+	}
+
+	var s segment
+	switch b[0] >> 4 {
+	case 4:
+		if len(b) < 20 {
+			return nil, false
+		}
+		headerSize := int(b[0]&0x0f) * 4
+		totalSize := int(binary.BigEndian.Uint16(b[2:4]))
+		// More fragments flag or a fragment offset.
+		fragmented := binary.BigEndian.Uint16(b[6:8])&0x3fff != 0
+		if b[9] != protocolTCP || fragmented || headerSize < 20 || totalSize < headerSize || totalSize > len(b) {
+			return nil, false
+		}
+		src := netip.AddrFrom4([4]byte(b[12:16]))
+		dst := netip.AddrFrom4([4]byte(b[16:20]))
+		return decodeTCP(&s, src, dst, b[headerSize:totalSize])
+	case 6:
+		if len(b) < 40 {
+			return nil, false
+		}
+		payloadSize := int(binary.BigEndian.Uint16(b[4:6]))
+		if b[6] != protocolTCP || 40+payloadSize > len(b) {
+			return nil, false
+		}
+		src := netip.AddrFrom16([16]byte(b[8:24]))
+		dst := netip.AddrFrom16([16]byte(b[24:40]))
+		return decodeTCP(&s, src, dst, b[40:40+payloadSize])
+	default:
+		return nil, false
+	}
+}
+
+func decodeTCP(s *segment, src, dst netip.Addr, b []byte) (*segment, bool) {
+	if len(b) < 20 {
+		return nil, false
+	}
+	headerSize := int(b[12]>>4) * 4
+	if headerSize < 20 || headerSize > len(b) {
+		return nil, false
+	}
+
+	s.src = netip.AddrPortFrom(src, binary.BigEndian.Uint16(b[0:2]))
+	s.dst = netip.AddrPortFrom(dst, binary.BigEndian.Uint16(b[2:4]))
+	s.seq = binary.BigEndian.Uint32(b[4:8])
+	s.flags = b[13]
+	s.data = b[headerSize:]
+
+	return s, true
+}
+
+type connKey struct {
+	a, b netip.AddrPort
+}
+
+// stream collects segments of a single direction of a connection.
+type stream struct {
+	isn      uint32
+	hasISN   bool
+	segments []segment
+}
+
+func (s *stream) reassemble() ([]byte, bool) {
+	if len(s.segments) == 0 {
+		return nil, false
+	}
+
+	// Offsets are relative to the first byte after the SYN or to the first
+	// captured segment, so sequence numbers may wrap around.
+	base := s.segments[0].seq
+	if s.hasISN {
+		base = s.isn + 1
+	}
+	offset := func(seq uint32) int64 {
+		return int64(int32(seq - base))
+	}
+
+	sort.SliceStable(s.segments, func(i, j int) bool {
+		return offset(s.segments[i].seq) < offset(s.segments[j].seq)
+	})
+
+	next := offset(s.segments[0].seq)
+	if s.hasISN {
+		next = 0
+	}
+
+	var data []byte
+	for _, seg := range s.segments {
+		start := offset(seg.seq)
+		end := start + int64(len(seg.data))
+		if end <= next {
+			// A retransmitted segment.
+			continue
+		}
+		if start > next {
+			return data, true
+		}
+		data = append(data, seg.data[next-start:]...)
+		next = end
+	}
+
+	return data, false
+}
+
+type conn struct {
+	// The address that sent the first captured packet and its peer.
+	first netip.AddrPort
+	other netip.AddrPort
+	// Streams sent from the first address and to it.
+	streams [2]stream
+	// An index of the stream of the client if it is detected by a SYN.
+	client int
+}
+
+type tracker struct {
+	conns map[connKey]*conn
+	order []*conn
+}
+
+func (t *tracker) add(s *segment) {
+	key := connKey{a: s.src, b: s.dst}
+	if key.b.Addr().Less(key.a.Addr()) || (key.a.Addr() == key.b.Addr() && key.b.Port() < key.a.Port()) {
+		key.a, key.b = key.b, key.a
+	}
+
+	c := t.conns[key]
+	syn := s.flags&flagSYN != 0 && s.flags&flagACK == 0
+	// A new connection reusing the same addresses and ports.
+	if c != nil && syn && (len(c.streams[0].segments) > 0 || len(c.streams[1].segments) > 0) {
+		c = nil
+	}
+	if c == nil {
+		c = &conn{first: s.src, other: s.dst, client: -1}
+		t.conns[key] = c
+		t.order = append(t.order, c)
+	}
+
+	i := 0
+	if s.src != c.first {
+		i = 1
+	}
+	st := &c.streams[i]
+
+	if s.flags&flagSYN != 0 {
+		st.isn = s.seq
+		st.hasISN = true
+		if syn {
+			c.client = i
+		}
+	}
+	if len(s.data) > 0 {
+		seg := *s
+		seg.data = append([]byte(nil), s.data...)
+		st.segments = append(st.segments, seg)
+	}
+}
+
+func (t *tracker) connections(port uint16) []*Connection {
+	var result []*Connection
+	for _, c := range t.order {
+		if len(c.streams[0].segments) == 0 && len(c.streams[1].segments) == 0 {
+			continue
+		}
+
+		client := c.client
+		if port != 0 {
+			switch {
+			case c.other.Port() == port:
+				client = 0
+			case c.first.Port() == port:
+				client = 1
+			default:
+				continue
+			}
+		}
+		if client < 0 {
+			client = 0
+		}
+
+		x := &Connection{}
+		var incomplete [2]bool
+		x.ClientData, incomplete[0] = c.streams[client].reassemble()
+		x.ServerData, incomplete[1] = c.streams[1-client].reassemble()
+		x.Incomplete = incomplete[0] || incomplete[1]
+		if client == 0 {
+			x.Client, x.Server = c.first, c.other
+		} else {
+			x.Client, x.Server = c.other, c.first
+		}
+
+		result = append(result, x)
+	}
+
+	return result
+}
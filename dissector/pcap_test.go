@@ -0,0 +1,246 @@
+package dissector_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/myzhan/avroipc/dissector"
+)
+
+const (
+	flagSYN = 0x02
+	flagACK = 0x10
+	flagPSH = 0x08
+)
+
+const (
+	clientAddr = "10.0.0.1:50000"
+	serverAddr = "10.0.0.2:41414"
+)
+
+// tcpPacket builds an IPv4 or IPv6 packet with a TCP segment.
+func tcpPacket(src, dst string, seq uint32, flags byte, data string) []byte {
+	s := netip.MustParseAddrPort(src)
+	d := netip.MustParseAddrPort(dst)
+
+	tcp := make([]byte, 20, 20+len(data))
+	binary.BigEndian.PutUint16(tcp[0:2], s.Port())
+	binary.BigEndian.PutUint16(tcp[2:4], d.Port())
+	binary.BigEndian.PutUint32(tcp[4:8], seq)
+	tcp[12] = 5 << 4
+	tcp[13] = flags
+	binary.BigEndian.PutUint16(tcp[14:16], 65535)
+	tcp = append(tcp, data...)
+
+	if s.Addr().Is4() {
+		ip := make([]byte, 20, 20+len(tcp))
+		ip[0] = 0x45
+		binary.BigEndian.PutUint16(ip[2:4], uint16(20+len(tcp)))
+		// Don't fragment.
+		ip[6] = 0x40
+		ip[8] = 64
+		ip[9] = 6
+		copy(ip[12:16], s.Addr().AsSlice())
+		copy(ip[16:20], d.Addr().AsSlice())
+		return append(ip, tcp...)
+	}
+
+	ip := make([]byte, 40, 40+len(tcp))
+	ip[0] = 0x60
+	binary.BigEndian.PutUint16(ip[4:6], uint16(len(tcp)))
+	ip[6] = 6
+	ip[7] = 64
+	copy(ip[8:24], s.Addr().AsSlice())
+	copy(ip[24:40], d.Addr().AsSlice())
+	return append(ip, tcp...)
+}
+
+func ethernet(ip []byte) []byte {
+	frame := make([]byte, 14, 14+len(ip))
+	binary.BigEndian.PutUint16(frame[12:14], 0x0800)
+	if ip[0]>>4 == 6 {
+		binary.BigEndian.PutUint16(frame[12:14], 0x86dd)
+	}
+	return append(frame, ip...)
+}
+
+// writePcap builds a pcap file with the passed link layer frames.
+func writePcap(link uint32, order binary.ByteOrder, frames ...[]byte) []byte {
+	var buf bytes.Buffer
+
+	header := make([]byte, 24)
+	order.PutUint32(header[0:4], 0xa1b2c3d4)
+	order.PutUint16(header[4:6], 2)
+	order.PutUint16(header[6:8], 4)
+	order.PutUint32(header[16:20], 262144)
+	order.PutUint32(header[20:24], link)
+	buf.Write(header)
+
+	for i, frame := range frames {
+		packetHeader := make([]byte, 16)
+		order.PutUint32(packetHeader[0:4], uint32(i))
+		order.PutUint32(packetHeader[8:12], uint32(len(frame)))
+		order.PutUint32(packetHeader[12:16], uint32(len(frame)))
+		buf.Write(packetHeader)
+		buf.Write(frame)
+	}
+
+	return buf.Bytes()
+}
+
+func TestReadPcap(t *testing.T) {
+	t.Run("reassembly", func(t *testing.T) {
+		// Sequence numbers of the client wrap around.
+		capture := writePcap(1, binary.LittleEndian,
+			ethernet(tcpPacket(clientAddr, serverAddr, 0xfffffffd, flagSYN, "")),
+			ethernet(tcpPacket(serverAddr, clientAddr, 4999, flagSYN|flagACK, "")),
+			ethernet(tcpPacket(clientAddr, serverAddr, 0xfffffffe, flagACK|flagPSH, "hel")),
+			ethernet(tcpPacket(clientAddr, serverAddr, 0x4, flagACK|flagPSH, "wor")),
+			ethernet(tcpPacket(clientAddr, serverAddr, 0x1, flagACK|flagPSH, "lo ")),
+			// A retransmitted segment overlapping with the received data.
+			ethernet(tcpPacket(clientAddr, serverAddr, 0x0, flagACK|flagPSH, "llo")),
+			ethernet(tcpPacket(serverAddr, clientAddr, 5000, flagACK|flagPSH, "ok")),
+		)
+
+		conns, err := dissector.ReadPcap(bytes.NewReader(capture), 0)
+		require.NoError(t, err)
+		require.Equal(t, []*dissector.Connection{{
+			Client:     netip.MustParseAddrPort(clientAddr),
+			Server:     netip.MustParseAddrPort(serverAddr),
+			ClientData: []byte("hello wor"),
+			ServerData: []byte("ok"),
+		}}, conns)
+	})
+
+	t.Run("missing segments", func(t *testing.T) {
+		capture := writePcap(1, binary.LittleEndian,
+			ethernet(tcpPacket(clientAddr, serverAddr, 99, flagSYN, "")),
+			ethernet(tcpPacket(clientAddr, serverAddr, 100, flagACK, "ab")),
+			ethernet(tcpPacket(clientAddr, serverAddr, 104, flagACK, "ef")),
+		)
+
+		conns, err := dissector.ReadPcap(bytes.NewReader(capture), 0)
+		require.NoError(t, err)
+		require.Len(t, conns, 1)
+		require.True(t, conns[0].Incomplete)
+		require.Equal(t, []byte("ab"), conns[0].ClientData)
+		require.Nil(t, conns[0].ServerData)
+	})
+
+	t.Run("established connections", func(t *testing.T) {
+		capture := writePcap(1, binary.LittleEndian,
+			// The capture starts with a response of the server.
+			ethernet(tcpPacket(serverAddr, clientAddr, 7, flagACK, "ok")),
+			ethernet(tcpPacket(clientAddr, serverAddr, 3, flagACK, "req")),
+			ethernet(tcpPacket("10.0.0.1:50001", "10.0.0.3:80", 3, flagACK, "GET")),
+		)
+
+		conns, err := dissector.ReadPcap(bytes.NewReader(capture), 41414)
+		require.NoError(t, err)
+		require.Len(t, conns, 1)
+		require.Equal(t, netip.MustParseAddrPort(clientAddr), conns[0].Client)
+		require.Equal(t, []byte("req"), conns[0].ClientData)
+		require.Equal(t, []byte("ok"), conns[0].ServerData)
+
+		// Without the port the first sender is taken as the client.
+		conns, err = dissector.ReadPcap(bytes.NewReader(capture), 0)
+		require.NoError(t, err)
+		require.Len(t, conns, 2)
+		require.Equal(t, netip.MustParseAddrPort(serverAddr), conns[0].Client)
+		require.Equal(t, []byte("ok"), conns[0].ClientData)
+	})
+
+	t.Run("reused ports", func(t *testing.T) {
+		capture := writePcap(1, binary.LittleEndian,
+			ethernet(tcpPacket(clientAddr, serverAddr, 0, flagSYN, "")),
+			ethernet(tcpPacket(clientAddr, serverAddr, 1, flagACK, "a")),
+			ethernet(tcpPacket(clientAddr, serverAddr, 100, flagSYN, "")),
+			ethernet(tcpPacket(clientAddr, serverAddr, 101, flagACK, "b")),
+		)
+
+		conns, err := dissector.ReadPcap(bytes.NewReader(capture), 0)
+		require.NoError(t, err)
+		require.Len(t, conns, 2)
+		require.Equal(t, []byte("a"), conns[0].ClientData)
+		require.Equal(t, []byte("b"), conns[1].ClientData)
+	})
+
+	t.Run("link types", func(t *testing.T) {
+		v4 := tcpPacket(clientAddr, serverAddr, 1, flagACK, "a")
+		v6 := tcpPacket("[fd00::1]:50000", "[fd00::2]:41414", 1, flagACK, "a")
+
+		vlan := ethernet(v4)
+		vlan = append(append(append([]byte(nil), vlan[:12]...), 0x81, 0x00, 0x00, 0x01), vlan[12:]...)
+		sll := append(make([]byte, 16), v4...)
+		binary.BigEndian.PutUint16(sll[14:16], 0x0800)
+		sll2 := append(make([]byte, 20), v6...)
+		binary.BigEndian.PutUint16(sll2[0:2], 0x86dd)
+		null := append([]byte{2, 0, 0, 0}, v4...)
+
+		for name, capture := range map[string][]byte{
+			"ethernet ipv6": writePcap(1, binary.LittleEndian, ethernet(v6)),
+			"vlan":          writePcap(1, binary.LittleEndian, vlan),
+			"raw":           writePcap(101, binary.BigEndian, v6),
+			"linux sll":     writePcap(113, binary.LittleEndian, sll),
+			"linux sll2":    writePcap(276, binary.LittleEndian, sll2),
+			"null":          writePcap(0, binary.LittleEndian, null),
+		} {
+			t.Run(name, func(t *testing.T) {
+				conns, err := dissector.ReadPcap(bytes.NewReader(capture), 41414)
+				require.NoError(t, err)
+				require.Len(t, conns, 1)
+				require.Equal(t, []byte("a"), conns[0].ClientData)
+			})
+		}
+	})
+
+	t.Run("truncated file", func(t *testing.T) {
+		capture := writePcap(1, binary.LittleEndian,
+			ethernet(tcpPacket(clientAddr, serverAddr, 1, flagACK, "a")),
+			ethernet(tcpPacket(clientAddr, serverAddr, 2, flagACK, "b")),
+		)
+
+		conns, err := dissector.ReadPcap(bytes.NewReader(capture[:len(capture)-1]), 0)
+		require.NoError(t, err)
+		require.Len(t, conns, 1)
+		require.Equal(t, []byte("a"), conns[0].ClientData)
+	})
+
+	t.Run("bad files", func(t *testing.T) {
+		_, err := dissector.ReadPcap(bytes.NewReader([]byte{0xa1}), 0)
+		require.EqualError(t, err, "cannot read pcap header: unexpected EOF")
+
+		_, err = dissector.ReadPcap(bytes.NewReader(make([]byte, 24)), 0)
+		require.EqualError(t, err, "not a pcap file")
+
+		pcapng := append([]byte{0x0a, 0x0d, 0x0d, 0x0a}, make([]byte, 20)...)
+		_, err = dissector.ReadPcap(bytes.NewReader(pcapng), 0)
+		require.EqualError(t, err, "pcapng files are not supported, convert the file with editcap -F pcap")
+	})
+}
+
+func TestDissectPcap(t *testing.T) {
+	requests, responses := recordStreams(t, "a")
+
+	// Split streams into small segments.
+	var frames [][]byte
+	for i := 0; i < len(requests); i += 10 {
+		end := min(i+10, len(requests))
+		frames = append(frames, ethernet(tcpPacket(clientAddr, serverAddr, uint32(i), flagACK, string(requests[i:end]))))
+	}
+	frames = append(frames, ethernet(tcpPacket(serverAddr, clientAddr, 0, flagACK, string(responses))))
+
+	conns, err := dissector.ReadPcap(bytes.NewReader(writePcap(1, binary.LittleEndian, frames...)), 41414)
+	require.NoError(t, err)
+	require.Len(t, conns, 1)
+
+	r, err := dissector.Dissect(conns[0].ClientData, conns[0].ServerData, prepareProtocol(t))
+	require.NoError(t, err)
+	require.Len(t, r.Exchanges, 2)
+	require.Equal(t, "append", r.Exchanges[1].Request.Message.Method)
+	require.Equal(t, "OK", r.Exchanges[1].Response.Message.Datum)
+}
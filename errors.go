@@ -0,0 +1,60 @@
+package avroipc
+
+import (
+	"errors"
+	"net"
+
+	"github.com/myzhan/avroipc/layers"
+	"github.com/myzhan/avroipc/protocols"
+)
+
+// ErrClosed is returned by clients for requests sent after closing them.
+var ErrClosed = errors.New("client is closed")
+
+// TransportError wraps errors of the underlying transports and the framing
+// layer that occurred while sending a request or receiving a response. The
+// state of the connection is unknown after such errors so the client
+// reconnects before sending the next request.
+type TransportError struct {
+	Err error
+}
+
+func (e *TransportError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *TransportError) Unwrap() error {
+	return e.Err
+}
+
+// ErrorType returns a short name of a class of the error that is suitable
+// for metric labels and logs. It is one of "timeout", "limit", "transport",
+// "remote" or "protocol" for all other errors. An empty string is returned
+// for the nil error.
+func ErrorType(err error) string {
+	if err == nil {
+		return ""
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return "timeout"
+	}
+
+	var limitErr *layers.LimitError
+	if errors.As(err, &limitErr) {
+		return "limit"
+	}
+
+	var transportErr *TransportError
+	if errors.As(err, &transportErr) {
+		return "transport"
+	}
+
+	var remoteErr *protocols.RemoteError
+	if errors.As(err, &remoteErr) {
+		return "remote"
+	}
+
+	return "protocol"
+}
@@ -0,0 +1,62 @@
+package flume
+
+import (
+	"context"
+
+	"github.com/myzhan/avroipc"
+)
+
+type breakerClient struct {
+	client  Client
+	breaker *avroipc.CircuitBreaker
+}
+
+// NewBreakerClient wraps the passed client with the circuit breaker. The
+// wrapped client returns the avroipc.ErrCircuitOpen error without sending
+// events while the circuit is open.
+func NewBreakerClient(client Client, breaker *avroipc.CircuitBreaker) Client {
+	return &breakerClient{
+		client:  client,
+		breaker: breaker,
+	}
+}
+
+func (c *breakerClient) Close() error {
+	return c.client.Close()
+}
+
+func (c *breakerClient) Append(event *Event) (status string, err error) {
+	err = c.breaker.Do(func() error {
+		status, err = c.client.Append(event)
+		return err
+	})
+
+	return
+}
+
+func (c *breakerClient) AppendBatch(events []*Event) (status string, err error) {
+	err = c.breaker.Do(func() error {
+		status, err = c.client.AppendBatch(events)
+		return err
+	})
+
+	return
+}
+
+func (c *breakerClient) AppendContext(ctx context.Context, event *Event) (status string, err error) {
+	err = c.breaker.Do(func() error {
+		status, err = AppendContext(ctx, c.client, event)
+		return err
+	})
+
+	return
+}
+
+func (c *breakerClient) AppendBatchContext(ctx context.Context, events []*Event) (status string, err error) {
+	err = c.breaker.Do(func() error {
+		status, err = AppendBatchContext(ctx, c.client, events)
+		return err
+	})
+
+	return
+}
@@ -0,0 +1,40 @@
+package flume
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/myzhan/avroipc"
+)
+
+func TestBreakerClient(t *testing.T) {
+	event := &Event{Headers: map[string]string{}, Body: []byte("test body")}
+	events := []*Event{event}
+
+	c, x := prepare()
+	b := avroipc.NewCircuitBreaker(&avroipc.BreakerConfig{MinRequests: 2})
+	bc := NewBreakerClient(c, b)
+
+	x.On("SendMessage", "append", event.toMap()).Return("", errors.New("test error")).Once()
+	x.On("SendMessage", "appendBatch", []map[string]interface{}{event.toMap()}).Return("", errors.New("test error")).Once()
+
+	status, err := bc.Append(event)
+	require.EqualError(t, err, "test error")
+	require.Equal(t, "", status)
+
+	status, err = bc.AppendBatch(events)
+	require.EqualError(t, err, "test error")
+	require.Equal(t, "", status)
+
+	status, err = bc.Append(event)
+	require.Equal(t, avroipc.ErrCircuitOpen, err)
+	require.Equal(t, "", status)
+
+	status, err = bc.AppendBatch(events)
+	require.Equal(t, avroipc.ErrCircuitOpen, err)
+	require.Equal(t, "", status)
+
+	x.AssertExpectations(t)
+}
@@ -1,6 +1,11 @@
 package flume
 
 import (
+	"context"
+
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
 	"github.com/myzhan/avroipc"
 )
 
@@ -11,8 +16,56 @@ type Client interface {
 	AppendBatch(events []*Event) (string, error)
 }
 
+// ContextClient is an optional interface of clients that are able to send
+// events with a context. Clients created by this package implement it.
+type ContextClient interface {
+	// AppendContext sends an event in the same way as Append but propagates
+	// the context to the underlying avroipc client.
+	AppendContext(ctx context.Context, event *Event) (string, error)
+	// AppendBatchContext sends events in the same way as AppendBatch but
+	// propagates the context to the underlying avroipc client.
+	AppendBatchContext(ctx context.Context, events []*Event) (string, error)
+}
+
+// AppendContext sends an event with the passed context if the client
+// implements the ContextClient interface. Otherwise, it checks the context
+// only before sending the event with the Append method.
+func AppendContext(ctx context.Context, c Client, event *Event) (string, error) {
+	if cc, ok := c.(ContextClient); ok {
+		return cc.AppendContext(ctx, event)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	return c.Append(event)
+}
+
+// AppendBatchContext sends events with the passed context if the client
+// implements the ContextClient interface. Otherwise, it checks the context
+// only before sending events with the AppendBatch method.
+func AppendBatchContext(ctx context.Context, c Client, events []*Event) (string, error) {
+	if cc, ok := c.(ContextClient); ok {
+		return cc.AppendBatchContext(ctx, events)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	return c.AppendBatch(events)
+}
+
 type client struct {
 	client avroipc.Client
+
+	// Used to inject trace contexts into event headers if it is enabled.
+	propagator propagation.TextMapPropagator
+
+	// Whether statuses other than OK are returned as errors.
+	statusErrors bool
+	// Used instead of the policy of the underlying client if status errors
+	// are enabled to retry FAILED statuses as well.
+	retryPolicy *avroipc.RetryPolicy
 }
 
 // NewClient creates an avro client with default option values and
@@ -27,25 +80,63 @@ func NewClient(addr string) (Client, error) {
 // the passed configuration object and connects to the specified remote Flume
 // endpoint immediately.
 //
+// Flume-specific behaviour of the client may be changed with options.
+//
 // This constructor supposed to be used in production environments.
-func NewClientWithConfig(addr string, config *avroipc.Config) (Client, error) {
+func NewClientWithConfig(addr string, config *avroipc.Config, opts ...Option) (Client, error) {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+
 	// All errors here are only related to compilations of Avro schemas
 	// and are not possible at runtime because they will be caught by unit tests.
 	proto, _ := NewAvroSource()
 
+	var retryPolicy *avroipc.RetryPolicy
+	if o.statusErrors && config.RetryPolicy != nil {
+		// Messages are retried by the Flume client to retry FAILED statuses,
+		// so the underlying client must not retry them by itself.
+		policy := *config.RetryPolicy
+		policy.Retryable = retryable(policy.Retryable)
+		retryPolicy = &policy
+
+		inner := *config
+		inner.RetryPolicy = nil
+		config = &inner
+	}
+
 	c, err := avroipc.NewClientWithConfig(addr, proto, config)
 	if err != nil {
 		return nil, err
 	}
 
-	return &client{c}, nil
+	x := &client{
+		client:       c,
+		statusErrors: o.statusErrors,
+		retryPolicy:  retryPolicy,
+	}
+	if o.traceEventHeaders {
+		x.propagator = config.Propagator
+		if x.propagator == nil {
+			x.propagator = propagation.TraceContext{}
+		}
+	}
+
+	if len(o.interceptors) > 0 {
+		return NewInterceptedClient(x, o.interceptors...), nil
+	}
+
+	return x, nil
 }
 
 // Append sends event to flume
 func (c *client) Append(event *Event) (string, error) {
 	datum := event.toMap()
 
-	return c.client.SendMessage("append", datum)
+	return c.send(context.Background(), func() (string, error) {
+		return c.client.SendMessage("append", datum)
+	})
 }
 
 // Append sends events to flume
@@ -55,7 +146,74 @@ func (c *client) AppendBatch(events []*Event) (string, error) {
 		datum = append(datum, event.toMap())
 	}
 
-	return c.client.SendMessage("appendBatch", datum)
+	return c.send(context.Background(), func() (string, error) {
+		return c.client.SendMessage("appendBatch", datum)
+	})
+}
+
+func (c *client) AppendContext(ctx context.Context, event *Event) (string, error) {
+	datum := c.injectHeaders(ctx, event).toMap()
+
+	return c.send(ctx, func() (string, error) {
+		return avroipc.SendMessageContext(ctx, c.client, "append", datum)
+	})
+}
+
+func (c *client) AppendBatchContext(ctx context.Context, events []*Event) (string, error) {
+	datum := make([]map[string]interface{}, 0)
+	for _, event := range events {
+		datum = append(datum, c.injectHeaders(ctx, event).toMap())
+	}
+
+	return c.send(ctx, func() (string, error) {
+		return avroipc.SendMessageContext(ctx, c.client, "appendBatch", datum)
+	})
+}
+
+// send calls the passed function and converts the returned status to an error
+// if status errors are enabled. The function is called again according to the
+// retry policy if it is set.
+func (c *client) send(ctx context.Context, fn func() (string, error)) (status string, err error) {
+	call := func() (string, error) {
+		status, err := fn()
+		if c.statusErrors {
+			return checkStatus(status, err)
+		}
+		return status, err
+	}
+
+	if c.retryPolicy == nil {
+		return call()
+	}
+
+	err = c.retryPolicy.DoContext(ctx, func() error {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		status, err = call()
+		return err
+	})
+	return status, err
+}
+
+// injectHeaders returns a copy of the event with the trace context of the
+// passed context in headers. The original event is returned if there is
+// nothing to inject.
+func (c *client) injectHeaders(ctx context.Context, event *Event) *Event {
+	if c.propagator == nil || !trace.SpanContextFromContext(ctx).IsValid() {
+		return event
+	}
+
+	headers := make(map[string]string, len(event.Headers)+2)
+	for k, v := range event.Headers {
+		headers[k] = v
+	}
+	c.propagator.Inject(ctx, propagation.MapCarrier(headers))
+
+	return &Event{
+		Headers: headers,
+		Body:    event.Body,
+	}
 }
 
 func (c *client) Close() error {
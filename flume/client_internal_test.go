@@ -1,10 +1,13 @@
 package flume
 
 import (
+	"context"
 	"errors"
 	"testing"
 
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 
 	"github.com/myzhan/avroipc/flume/mocks"
 )
@@ -84,3 +87,71 @@ func TestClient_AppendBatch(t *testing.T) {
 		x.AssertExpectations(t)
 	})
 }
+
+func TestClient_AppendContext(t *testing.T) {
+	method := "append"
+
+	ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{0x1},
+		SpanID:     trace.SpanID{0x2},
+		TraceFlags: trace.FlagsSampled,
+	}))
+
+	origEvent := &Event{Headers: map[string]string{"k": "v"}, Body: []byte("test body")}
+
+	t.Run("without headers", func(t *testing.T) {
+		c, x := prepare()
+
+		x.On("SendMessageContext", ctx, method, origEvent.toMap()).Return("SOME", nil).Once()
+
+		status, err := c.AppendContext(ctx, origEvent)
+		require.NoError(t, err)
+		require.Equal(t, "SOME", status)
+		x.AssertExpectations(t)
+	})
+
+	t.Run("with headers", func(t *testing.T) {
+		c, x := prepare()
+		c.propagator = propagation.TraceContext{}
+
+		prepEvent := (&Event{
+			Headers: map[string]string{
+				"k":           "v",
+				"traceparent": "00-01000000000000000000000000000000-0200000000000000-01",
+			},
+			Body: origEvent.Body,
+		}).toMap()
+
+		x.On("SendMessageContext", ctx, method, prepEvent).Return("SOME", nil).Once()
+
+		status, err := c.AppendContext(ctx, origEvent)
+		require.NoError(t, err)
+		require.Equal(t, "SOME", status)
+		require.Equal(t, map[string]string{"k": "v"}, origEvent.Headers)
+		x.AssertExpectations(t)
+	})
+}
+
+func TestClient_AppendBatchContext(t *testing.T) {
+	method := "appendBatch"
+	ctx := context.Background()
+
+	origEvents := []*Event{
+		{Headers: map[string]string{}, Body: []byte("test body 1")},
+		{Headers: map[string]string{}, Body: []byte("test body 2")},
+	}
+	prepEvents := []map[string]interface{}{
+		origEvents[0].toMap(),
+		origEvents[1].toMap(),
+	}
+
+	c, x := prepare()
+	c.propagator = propagation.TraceContext{}
+
+	x.On("SendMessageContext", ctx, method, prepEvents).Return("SOME", nil).Once()
+
+	status, err := c.AppendBatchContext(ctx, origEvents)
+	require.NoError(t, err)
+	require.Equal(t, "SOME", status)
+	x.AssertExpectations(t)
+}
@@ -2,16 +2,23 @@ package flume_test
 
 import (
 	"bytes"
+	"context"
+	"fmt"
 	"io"
 	"net"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/require"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 
 	"github.com/myzhan/avroipc"
 	"github.com/myzhan/avroipc/flume"
+	"github.com/myzhan/avroipc/flumetest"
 	"github.com/myzhan/avroipc/internal"
+	"github.com/myzhan/avroipc/layers"
+	"github.com/myzhan/avroipc/transports"
 )
 
 type pair struct {
@@ -172,7 +179,7 @@ func TestClient(t *testing.T) {
 	}
 	for n, d := range data {
 		t.Run(n, func(t *testing.T) {
-			addr, clean := internal.RunServer(t, getHandler(t, d.pairs))
+			addr, clean := flumetest.RunServer(t, getHandler(t, d.pairs))
 
 			config := avroipc.NewConfig()
 			config.WithTimeout(time.Second)
@@ -194,6 +201,125 @@ func TestClient(t *testing.T) {
 		})
 	}
 
+	t.Run("recorded session", func(t *testing.T) {
+		addr, clean := flumetest.RunServer(t, getHandler(t, data["plain data"].pairs))
+
+		session := &bytes.Buffer{}
+		config := avroipc.NewConfig()
+		config.WithDialer(func(addr string) (transports.Transport, error) {
+			trans, err := transports.NewSocket(addr, time.Second)
+			if err != nil {
+				return nil, err
+			}
+			return transports.NewRecording(trans, session), nil
+		})
+		client, err := flume.NewClientWithConfig(addr, config)
+		require.NoError(t, err)
+
+		event := &flume.Event{
+			Body: []byte("tttt"),
+		}
+		status, err := client.Append(event)
+		require.NoError(t, err)
+		require.Equal(t, "OK", status)
+
+		require.NoError(t, client.Close())
+		require.NoError(t, clean())
+
+		// Replay the recorded session without any server.
+		config.WithDialer(func(addr string) (transports.Transport, error) {
+			return transports.NewReplay(bytes.NewReader(session.Bytes()))
+		})
+		client, err = flume.NewClientWithConfig(addr, config)
+		require.NoError(t, err)
+
+		status, err = client.Append(event)
+		require.NoError(t, err)
+		require.Equal(t, "OK", status)
+
+		require.NoError(t, client.Close())
+	})
+
+	t.Run("recorded session with headers", func(t *testing.T) {
+		a := flumetest.NewAgent(t)
+
+		session := &bytes.Buffer{}
+		config := avroipc.NewConfig()
+		config.WithDialer(func(addr string) (transports.Transport, error) {
+			trans, err := transports.NewSocket(addr, time.Second)
+			if err != nil {
+				return nil, err
+			}
+			return transports.NewRecording(trans, session), nil
+		})
+		client, err := flume.NewClientWithConfig(a.Addr(), config)
+		require.NoError(t, err)
+
+		// Headers are encoded in random order, so the replayed requests
+		// differ from the recorded ones byte by byte.
+		event := &flume.Event{
+			Headers: map[string]string{"a": "1", "b": "2", "c": "3", "d": "4", "e": "5"},
+			Body:    []byte("tttt"),
+		}
+		for i := 0; i < 10; i++ {
+			status, err := client.Append(event)
+			require.NoError(t, err)
+			require.Equal(t, "OK", status)
+		}
+		require.NoError(t, client.Close())
+
+		proto, err := flume.NewAvroSource()
+		require.NoError(t, err)
+		config.WithDialer(func(addr string) (transports.Transport, error) {
+			return transports.NewReplayWithConfig(bytes.NewReader(session.Bytes()), &transports.ReplayConfig{
+				Equal: layers.NewRequestComparer(proto),
+			})
+		})
+		client, err = flume.NewClientWithConfig(a.Addr(), config)
+		require.NoError(t, err)
+
+		for i := 0; i < 10; i++ {
+			status, err := client.Append(event)
+			require.NoError(t, err)
+			require.Equal(t, "OK", status)
+		}
+		require.NoError(t, client.Close())
+	})
+
+	t.Run("dropped connection", func(t *testing.T) {
+		addr, clean := flumetest.RunServer(t, getHandler(t, data["plain data"].pairs))
+
+		dials := 0
+		config := avroipc.NewConfig()
+		config.WithRetryPolicy(&avroipc.RetryPolicy{MaxAttempts: 2, BaseBackoff: time.Millisecond})
+		config.WithDialer(func(addr string) (transports.Transport, error) {
+			trans, err := transports.NewSocket(addr, time.Second)
+			if err != nil {
+				return nil, err
+			}
+			dials++
+			if dials > 1 {
+				return trans, nil
+			}
+			// Drop the first connection in the middle of the append request
+			// right after the handshake request of 48 bytes.
+			return transports.NewFaulty(trans, &transports.FaultConfig{DropAfter: 60}), nil
+		})
+		client, err := flume.NewClientWithConfig(addr, config)
+		require.NoError(t, err)
+
+		event := &flume.Event{
+			Body: []byte("tttt"),
+		}
+		status, err := client.Append(event)
+		require.NoError(t, err)
+		require.Equal(t, "OK", status)
+		require.Equal(t, 2, dials)
+
+		require.NoError(t, client.Close())
+		require.NoError(t, clean())
+	})
+
 	t.Run("bad address", func(t *testing.T) {
 		_, err := flume.NewClient("1:2:3")
 		require.Error(t, err)
@@ -201,7 +327,7 @@ func TestClient(t *testing.T) {
 	})
 
 	t.Run("bad compression level", func(t *testing.T) {
-		addr, clean := internal.RunServer(t, func(conn net.Conn) error {
+		addr, clean := flumetest.RunServer(t, func(conn net.Conn) error {
 			return nil
 		})
 		_, err := flume.NewClientWithConfig(addr, avroipc.NewConfig().WithCompressionLevel(10))
@@ -211,3 +337,86 @@ func TestClient(t *testing.T) {
 		require.NoError(t, clean())
 	})
 }
+
+func TestClient_interceptors(t *testing.T) {
+	a := flumetest.NewAgent(t)
+	c := a.NewClient(t, nil,
+		flume.WithInterceptors(&flume.StaticInterceptor{Key: "env", Value: "test"}),
+		flume.WithInterceptors(flume.InterceptorFunc(func(e *flume.Event) {
+			e.Headers["env"] += "!"
+		})),
+	)
+
+	event := &flume.Event{Headers: map[string]string{"k": "v"}, Body: []byte("a")}
+	status, err := c.Append(event)
+	require.NoError(t, err)
+	require.Equal(t, "OK", status)
+
+	status, err = flume.AppendBatchContext(context.Background(), c, []*flume.Event{event})
+	require.NoError(t, err)
+	require.Equal(t, "OK", status)
+
+	events := a.Events()
+	require.Len(t, events, 2)
+	for _, e := range events {
+		require.Equal(t, map[string]string{"k": "v", "env": "test!"}, e.Headers)
+	}
+	require.Equal(t, map[string]string{"k": "v"}, event.Headers)
+}
+
+func TestClient_tracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	a := flumetest.NewAgent(t)
+	c := a.NewClient(t, avroipc.NewConfig().WithTracerProvider(provider), flume.WithTraceEventHeaders())
+
+	ctx, parent := provider.Tracer("test").Start(context.Background(), "parent")
+	event := &flume.Event{Headers: map[string]string{"k": "v"}, Body: []byte("a")}
+	status, err := flume.AppendBatchContext(ctx, c, []*flume.Event{event})
+	parent.End()
+	require.NoError(t, err)
+	require.Equal(t, "OK", status)
+
+	var send sdktrace.ReadOnlySpan
+	for _, span := range recorder.Ended() {
+		if span.Name() == "avroipc.SendMessage" {
+			send = span
+		}
+	}
+	require.NotNil(t, send)
+	require.Equal(t, parent.SpanContext().SpanID(), send.Parent().SpanID())
+
+	// Event headers carry the trace context of the caller.
+	traceparent := fmt.Sprintf("00-%s-%s-01", parent.SpanContext().TraceID(), parent.SpanContext().SpanID())
+	require.Equal(t, map[string]string{"k": "v", "traceparent": traceparent}, a.Events()[0].Headers)
+	require.Equal(t, map[string]string{"k": "v"}, event.Headers)
+}
+
+// plainClient implements only the Client interface.
+type plainClient struct {
+	flume.Client
+}
+
+func TestAppendContext(t *testing.T) {
+	a := flumetest.NewAgent(t)
+	c := plainClient{a.NewClient(t, nil)}
+	event := &flume.Event{Body: []byte("a")}
+
+	status, err := flume.AppendContext(context.Background(), c, event)
+	require.NoError(t, err)
+	require.Equal(t, "OK", status)
+
+	status, err = flume.AppendBatchContext(context.Background(), c, []*flume.Event{event})
+	require.NoError(t, err)
+	require.Equal(t, "OK", status)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = flume.AppendContext(ctx, c, event)
+	require.Equal(t, context.Canceled, err)
+	_, err = flume.AppendBatchContext(ctx, c, []*flume.Event{event})
+	require.Equal(t, context.Canceled, err)
+
+	a.RequireBodies(t, "a", "a")
+}
@@ -0,0 +1,219 @@
+package flume
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/linkedin/goavro/v2"
+)
+
+// Headers set by body encoders to let consumers decode event bodies.
+const (
+	// A MIME type of the body, e.g. application/json.
+	HeaderContentType = "content-type"
+	// A hexadecimal 64-bit Rabin fingerprint of the canonical form of the
+	// Avro schema of the body.
+	HeaderAvroFingerprint = "avro.schema.fingerprint"
+	// A literal Avro schema of the body as expected by Flume Avro serializers.
+	HeaderAvroSchema = "flume.avro.schema.literal"
+)
+
+// Content types set by body encoders.
+const (
+	ContentTypeJSON = "application/json"
+	ContentTypeAvro = "avro/binary"
+	ContentTypeText = "text/plain"
+)
+
+// Encoder encodes values into event bodies and sets headers describing the
+// encoding. Encoders of formats with third-party dependencies are provided by
+// subpackages, e.g. flumeproto.
+type Encoder interface {
+	Encode(v interface{}, headers map[string]string) ([]byte, error)
+}
+
+// JSONEncoder encodes values with the encoding/json package.
+type JSONEncoder struct{}
+
+func (JSONEncoder) Encode(v interface{}, headers map[string]string) ([]byte, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	headers[HeaderContentType] = ContentTypeJSON
+	return b, nil
+}
+
+// AvroEncoder encodes values in the Avro binary format. Values must be native
+// Go forms of Avro data as described by the goavro package.
+type AvroEncoder struct {
+	// Whether the literal schema should be also set into the
+	// HeaderAvroSchema header of each event.
+	//
+	// Defaults to false which means that only the schema fingerprint is set.
+	IncludeSchema bool
+
+	codec       *goavro.Codec
+	fingerprint string
+}
+
+// NewAvroEncoder creates an Avro encoder for the passed schema.
+func NewAvroEncoder(schema string) (*AvroEncoder, error) {
+	codec, err := goavro.NewCodec(schema)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AvroEncoder{
+		codec:       codec,
+		fingerprint: fmt.Sprintf("%016x", codec.Rabin),
+	}, nil
+}
+
+func (e *AvroEncoder) Encode(v interface{}, headers map[string]string) ([]byte, error) {
+	b, err := e.codec.BinaryFromNative(nil, v)
+	if err != nil {
+		return nil, err
+	}
+
+	headers[HeaderContentType] = ContentTypeAvro
+	headers[HeaderAvroFingerprint] = e.fingerprint
+	if e.IncludeSchema {
+		headers[HeaderAvroSchema] = e.codec.Schema()
+	}
+	return b, nil
+}
+
+// TextEncoder encodes strings, byte slices and fmt.Stringer values as plain
+// text in the specified charset. Supported charsets are utf-8, us-ascii and
+// iso-8859-1.
+type TextEncoder struct {
+	// A charset of the body.
+	//
+	// Defaults to empty which means utf-8.
+	Charset string
+}
+
+func (e TextEncoder) Encode(v interface{}, headers map[string]string) ([]byte, error) {
+	var s string
+	switch x := v.(type) {
+	case string:
+		s = x
+	case []byte:
+		s = string(x)
+	case fmt.Stringer:
+		s = x.String()
+	default:
+		return nil, fmt.Errorf("cannot encode %T as text", v)
+	}
+	if !utf8.ValidString(s) {
+		return nil, errors.New("text is not valid utf-8")
+	}
+
+	charset := strings.ToLower(e.Charset)
+	if charset == "" {
+		charset = "utf-8"
+	}
+
+	var b []byte
+	switch charset {
+	case "utf-8":
+		b = []byte(s)
+	case "us-ascii", "iso-8859-1":
+		limit := rune(0x7f)
+		if charset == "iso-8859-1" {
+			limit = 0xff
+		}
+		b = make([]byte, 0, len(s))
+		for _, r := range s {
+			if r > limit {
+				return nil, fmt.Errorf("character %q is not representable in %s", r, charset)
+			}
+			b = append(b, byte(r))
+		}
+	default:
+		return nil, fmt.Errorf("unsupported charset: %s", e.Charset)
+	}
+
+	headers[HeaderContentType] = ContentTypeText + "; charset=" + charset
+	return b, nil
+}
+
+// EventBuilder builds events step by step. The first error of encoding is
+// kept and returned by the Build method.
+//
+//	event, err := flume.NewEventBuilder().
+//		Header("source", "billing").
+//		Encode(flume.JSONEncoder{}, payment).
+//		Build()
+type EventBuilder struct {
+	headers map[string]string
+	body    []byte
+	err     error
+}
+
+// NewEventBuilder creates a builder of an event without headers and body.
+func NewEventBuilder() *EventBuilder {
+	return &EventBuilder{
+		headers: make(map[string]string),
+	}
+}
+
+// Header sets the header.
+func (b *EventBuilder) Header(key, value string) *EventBuilder {
+	b.headers[key] = value
+	return b
+}
+
+// Headers sets all passed headers.
+func (b *EventBuilder) Headers(headers map[string]string) *EventBuilder {
+	for k, v := range headers {
+		b.headers[k] = v
+	}
+	return b
+}
+
+// Body sets the raw body.
+func (b *EventBuilder) Body(body []byte) *EventBuilder {
+	b.body = body
+	return b
+}
+
+// Encode sets the body to the value encoded with the passed encoder along
+// with headers of the encoder.
+func (b *EventBuilder) Encode(enc Encoder, v interface{}) *EventBuilder {
+	if b.err != nil {
+		return b
+	}
+
+	body, err := enc.Encode(v, b.headers)
+	if err != nil {
+		b.err = err
+		return b
+	}
+
+	b.body = body
+	return b
+}
+
+// Build returns the event or the first encoding error. The builder may be
+// reused after building, built events don't share headers with it.
+func (b *EventBuilder) Build() (*Event, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+
+	headers := make(map[string]string, len(b.headers))
+	for k, v := range b.headers {
+		headers[k] = v
+	}
+
+	return &Event{
+		Headers: headers,
+		Body:    b.body,
+	}, nil
+}
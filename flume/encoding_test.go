@@ -0,0 +1,126 @@
+package flume_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/linkedin/goavro/v2"
+	"github.com/stretchr/testify/require"
+
+	"github.com/myzhan/avroipc/flume"
+)
+
+type stringer struct{}
+
+func (stringer) String() string { return "stringer" }
+
+type failingEncoder struct{}
+
+func (failingEncoder) Encode(interface{}, map[string]string) ([]byte, error) {
+	return nil, errors.New("test error")
+}
+
+func TestJSONEncoder(t *testing.T) {
+	headers := map[string]string{}
+	b, err := flume.JSONEncoder{}.Encode(map[string]int{"a": 1}, headers)
+	require.NoError(t, err)
+	require.Equal(t, `{"a":1}`, string(b))
+	require.Equal(t, map[string]string{"content-type": "application/json"}, headers)
+
+	_, err = flume.JSONEncoder{}.Encode(make(chan int), headers)
+	require.Error(t, err)
+}
+
+func TestAvroEncoder(t *testing.T) {
+	schema := `{"type":"record","name":"R","fields":[{"name":"a","type":"long"}]}`
+
+	e, err := flume.NewAvroEncoder(schema)
+	require.NoError(t, err)
+
+	headers := map[string]string{}
+	b, err := e.Encode(map[string]interface{}{"a": 1}, headers)
+	require.NoError(t, err)
+	require.Equal(t, []byte{0x02}, b)
+
+	codec, err := goavro.NewCodec(schema)
+	require.NoError(t, err)
+	require.Equal(t, "avro/binary", headers["content-type"])
+	require.Equal(t, fmt.Sprintf("%016x", codec.Rabin), headers["avro.schema.fingerprint"])
+	require.NotContains(t, headers, "flume.avro.schema.literal")
+
+	e.IncludeSchema = true
+	_, err = e.Encode(map[string]interface{}{"a": 1}, headers)
+	require.NoError(t, err)
+	require.Equal(t, codec.Schema(), headers["flume.avro.schema.literal"])
+
+	_, err = e.Encode(map[string]interface{}{"b": 1}, headers)
+	require.Error(t, err)
+
+	_, err = flume.NewAvroEncoder("{")
+	require.Error(t, err)
+}
+
+func TestTextEncoder(t *testing.T) {
+	tests := []struct {
+		charset     string
+		value       interface{}
+		body        []byte
+		contentType string
+		err         string
+	}{
+		{"", "héllo", []byte("héllo"), "text/plain; charset=utf-8", ""},
+		{"UTF-8", []byte("b"), []byte("b"), "text/plain; charset=utf-8", ""},
+		{"", stringer{}, []byte("stringer"), "text/plain; charset=utf-8", ""},
+		{"us-ascii", "abc", []byte("abc"), "text/plain; charset=us-ascii", ""},
+		{"us-ascii", "é", nil, "", "character 'é' is not representable in us-ascii"},
+		{"iso-8859-1", "é", []byte{0xe9}, "text/plain; charset=iso-8859-1", ""},
+		{"koi8-r", "a", nil, "", "unsupported charset: koi8-r"},
+		{"", 1, nil, "", "cannot encode int as text"},
+		{"", "\xff", nil, "", "text is not valid utf-8"},
+	}
+	for _, tt := range tests {
+		headers := map[string]string{}
+		b, err := flume.TextEncoder{Charset: tt.charset}.Encode(tt.value, headers)
+		if tt.err != "" {
+			require.EqualError(t, err, tt.err)
+			continue
+		}
+		require.NoError(t, err)
+		require.Equal(t, tt.body, b)
+		require.Equal(t, tt.contentType, headers["content-type"])
+	}
+}
+
+func TestEventBuilder(t *testing.T) {
+	t.Run("succeed", func(t *testing.T) {
+		b := flume.NewEventBuilder().
+			Headers(map[string]string{"a": "1", "b": "2"}).
+			Header("b", "3")
+
+		event, err := b.Body([]byte("raw")).Build()
+		require.NoError(t, err)
+		require.Equal(t, &flume.Event{
+			Headers: map[string]string{"a": "1", "b": "3"},
+			Body:    []byte("raw"),
+		}, event)
+
+		event, err = b.Encode(flume.JSONEncoder{}, "x").Build()
+		require.NoError(t, err)
+		require.Equal(t, &flume.Event{
+			Headers: map[string]string{"a": "1", "b": "3", "content-type": "application/json"},
+			Body:    []byte(`"x"`),
+		}, event)
+
+		b.Header("c", "4")
+		require.NotContains(t, event.Headers, "c")
+	})
+
+	t.Run("encoding error", func(t *testing.T) {
+		_, err := flume.NewEventBuilder().
+			Encode(failingEncoder{}, "x").
+			Encode(flume.JSONEncoder{}, "y").
+			Build()
+		require.EqualError(t, err, "test error")
+	})
+}
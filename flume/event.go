@@ -13,3 +13,19 @@ func (e *Event) toMap() map[string]interface{} {
 
 	return m
 }
+
+func eventFromMap(datum interface{}) *Event {
+	m, _ := datum.(map[string]interface{})
+	headers, _ := m["headers"].(map[string]interface{})
+	body, _ := m["body"].([]byte)
+
+	e := &Event{
+		Headers: make(map[string]string, len(headers)),
+		Body:    body,
+	}
+	for k, v := range headers {
+		e.Headers[k], _ = v.(string)
+	}
+
+	return e
+}
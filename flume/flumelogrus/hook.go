@@ -0,0 +1,117 @@
+// Package flumelogrus provides a logrus hook that ships log entries to Flume.
+package flumelogrus
+
+import (
+	"bytes"
+	"context"
+	"strconv"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/myzhan/avroipc/flume"
+)
+
+// Headers of events created from log entries.
+const (
+	HeaderLevel     = "level"
+	HeaderLogger    = "logger"
+	HeaderTimestamp = "timestamp"
+)
+
+// Options provides a configuration for the hook.
+type Options struct {
+	// Levels of shipped entries.
+	//
+	// Defaults to nil which means all levels.
+	Levels []logrus.Level
+
+	// A name of the logger set into the logger header of each event.
+	//
+	// Defaults to empty which means that the header is not set.
+	Logger string
+
+	// A formatter of event bodies.
+	//
+	// Defaults to nil which means the logrus.JSONFormatter.
+	Formatter logrus.Formatter
+
+	// A configuration of the producer that batches and sends events.
+	//
+	// Defaults to nil which means default values of the flume.ProducerConfig
+	// except the overflow policy which is flume.DropNewest to never block
+	// logging calls.
+	Producer *flume.ProducerConfig
+}
+
+// Hook converts log entries to Flume events and sends them asynchronously in
+// batches.
+type Hook struct {
+	levels    []logrus.Level
+	logger    string
+	formatter logrus.Formatter
+	producer  *flume.Producer
+}
+
+// NewHook creates a hook that sends events through the passed client. The
+// hook doesn't close the client, call the Close method of the hook to
+// deliver buffered entries before closing the client.
+func NewHook(client flume.Client, opts *Options) *Hook {
+	if opts == nil {
+		opts = &Options{}
+	}
+
+	config := opts.Producer
+	if config == nil {
+		config = &flume.ProducerConfig{Overflow: flume.DropNewest}
+	}
+
+	h := &Hook{
+		levels:    opts.Levels,
+		logger:    opts.Logger,
+		formatter: opts.Formatter,
+		producer:  flume.NewProducer(client, config),
+	}
+	if h.levels == nil {
+		h.levels = logrus.AllLevels
+	}
+	if h.formatter == nil {
+		h.formatter = &logrus.JSONFormatter{}
+	}
+
+	return h
+}
+
+func (h *Hook) Levels() []logrus.Level {
+	return h.levels
+}
+
+func (h *Hook) Fire(entry *logrus.Entry) error {
+	body, err := h.formatter.Format(entry)
+	if err != nil {
+		return err
+	}
+	// Formatters may reuse the buffer of the entry.
+	body = append([]byte(nil), bytes.TrimSuffix(body, []byte("\n"))...)
+
+	headers := map[string]string{
+		HeaderLevel:     entry.Level.String(),
+		HeaderTimestamp: strconv.FormatInt(entry.Time.UnixMilli(), 10),
+	}
+	if h.logger != "" {
+		headers[HeaderLogger] = h.logger
+	}
+
+	return h.producer.Send(&flume.Event{Headers: headers, Body: body}, nil)
+}
+
+// Flush sends all buffered entries and waits until they are delivered or the
+// context is done.
+func (h *Hook) Flush(ctx context.Context) error {
+	return h.producer.Flush(ctx)
+}
+
+// Close sends all buffered entries and stops the hook. It doesn't close the
+// client.
+func (h *Hook) Close() error {
+	return h.producer.Close()
+}
@@ -0,0 +1,61 @@
+package flumelogrus_test
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+
+	"github.com/myzhan/avroipc/flume/flumelogrus"
+	"github.com/myzhan/avroipc/flumetest"
+)
+
+func TestHook(t *testing.T) {
+	t.Run("entries", func(t *testing.T) {
+		a := flumetest.NewAgent(t)
+		h := flumelogrus.NewHook(a.NewClient(t, nil), &flumelogrus.Options{Logger: "test"})
+
+		l := logrus.New()
+		l.SetLevel(logrus.DebugLevel)
+		l.AddHook(h)
+		l.WithField("a", 1).Warn("first")
+		l.Debug("second")
+		require.NoError(t, h.Close())
+
+		events := a.Events()
+		require.Len(t, events, 2)
+
+		var body map[string]interface{}
+		require.NoError(t, json.Unmarshal(events[0].Body, &body))
+		require.Equal(t, "first", body["msg"])
+		require.Equal(t, "warning", body["level"])
+		require.Equal(t, float64(1), body["a"])
+
+		require.Equal(t, "warning", events[0].Headers["level"])
+		require.Equal(t, "test", events[0].Headers["logger"])
+		_, err := strconv.ParseInt(events[0].Headers["timestamp"], 10, 64)
+		require.NoError(t, err)
+		require.Equal(t, "debug", events[1].Headers["level"])
+	})
+
+	t.Run("levels and formatter", func(t *testing.T) {
+		a := flumetest.NewAgent(t)
+		h := flumelogrus.NewHook(a.NewClient(t, nil), &flumelogrus.Options{
+			Levels:    []logrus.Level{logrus.ErrorLevel},
+			Formatter: &logrus.TextFormatter{DisableTimestamp: true},
+		})
+
+		l := logrus.New()
+		l.AddHook(h)
+		l.Info("skipped")
+		l.Error("shipped")
+		require.NoError(t, h.Flush(context.Background()))
+
+		a.RequireBodies(t, `level=error msg=shipped`)
+		require.NotContains(t, a.Events()[0].Headers, "logger")
+		require.NoError(t, h.Close())
+	})
+}
@@ -0,0 +1,44 @@
+// Package flumeproto provides an encoder of Protobuf messages into bodies of
+// Flume events.
+package flumeproto
+
+import (
+	"fmt"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/myzhan/avroipc/flume"
+)
+
+// A header and a content type set by the encoder.
+const (
+	// A full name of the Protobuf message of the body.
+	HeaderMessage = "protobuf.message"
+	// A content type of encoded bodies.
+	ContentType = "application/x-protobuf"
+)
+
+// Encoder encodes Protobuf messages in the binary wire format.
+//
+//	event, err := flume.NewEventBuilder().
+//		Encode(flumeproto.Encoder{}, message).
+//		Build()
+type Encoder struct{}
+
+func (Encoder) Encode(v interface{}, headers map[string]string) ([]byte, error) {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("cannot encode %T: not a protobuf message", v)
+	}
+
+	b, err := proto.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+
+	headers[flume.HeaderContentType] = ContentType
+	headers[HeaderMessage] = string(m.ProtoReflect().Descriptor().FullName())
+	return b, nil
+}
+
+var _ flume.Encoder = Encoder{}
@@ -0,0 +1,35 @@
+package flumeproto_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/myzhan/avroipc/flume"
+	"github.com/myzhan/avroipc/flume/flumeproto"
+)
+
+func TestEncoder(t *testing.T) {
+	m := wrapperspb.String("test")
+
+	headers := map[string]string{}
+	b, err := flumeproto.Encoder{}.Encode(m, headers)
+	require.NoError(t, err)
+
+	decoded := &wrapperspb.StringValue{}
+	require.NoError(t, proto.Unmarshal(b, decoded))
+	require.Equal(t, "test", decoded.GetValue())
+	require.Equal(t, map[string]string{
+		"content-type":     "application/x-protobuf",
+		"protobuf.message": "google.protobuf.StringValue",
+	}, headers)
+
+	_, err = flumeproto.Encoder{}.Encode("test", headers)
+	require.EqualError(t, err, "cannot encode string: not a protobuf message")
+
+	event, err := flume.NewEventBuilder().Encode(flumeproto.Encoder{}, m).Build()
+	require.NoError(t, err)
+	require.Equal(t, b, event.Body)
+}
@@ -0,0 +1,144 @@
+// Package flumeslog provides a log/slog handler that ships log records to
+// Flume.
+package flumeslog
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strconv"
+	"sync"
+
+	"github.com/myzhan/avroipc/flume"
+)
+
+// Headers of events created from log records.
+const (
+	HeaderLevel     = "level"
+	HeaderLogger    = "logger"
+	HeaderTimestamp = "timestamp"
+)
+
+// Options provides a configuration for the handler.
+type Options struct {
+	// A minimum level of shipped records.
+	//
+	// Defaults to nil which means slog.LevelInfo.
+	Level slog.Leveler
+
+	// A name of the logger set into the logger header of each event.
+	//
+	// Defaults to empty which means that the header is not set.
+	Logger string
+
+	// Whether the source code position of the log statement should be added
+	// to bodies.
+	//
+	// Defaults to false.
+	AddSource bool
+
+	// A configuration of the producer that batches and sends events.
+	//
+	// Defaults to nil which means default values of the flume.ProducerConfig
+	// except the overflow policy which is flume.DropNewest to never block
+	// logging calls.
+	Producer *flume.ProducerConfig
+}
+
+// sink collects a JSON body written by the inner handler. The mutex is held
+// during formatting of a single record.
+type sink struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (s *sink) Write(p []byte) (int, error) {
+	return s.buf.Write(p)
+}
+
+// Handler converts log records to Flume events with JSON bodies and sends
+// them asynchronously in batches.
+type Handler struct {
+	inner    slog.Handler
+	sink     *sink
+	producer *flume.Producer
+	logger   string
+}
+
+// NewHandler creates a handler that sends events through the passed client.
+// The handler doesn't close the client, call the Close method of the handler
+// to deliver buffered records before closing the client.
+func NewHandler(client flume.Client, opts *Options) *Handler {
+	if opts == nil {
+		opts = &Options{}
+	}
+
+	config := opts.Producer
+	if config == nil {
+		config = &flume.ProducerConfig{Overflow: flume.DropNewest}
+	}
+
+	s := &sink{}
+	return &Handler{
+		inner: slog.NewJSONHandler(s, &slog.HandlerOptions{
+			Level:     opts.Level,
+			AddSource: opts.AddSource,
+		}),
+		sink:     s,
+		producer: flume.NewProducer(client, config),
+		logger:   opts.Logger,
+	}
+}
+
+func (h *Handler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.inner.Enabled(ctx, level)
+}
+
+func (h *Handler) Handle(ctx context.Context, r slog.Record) error {
+	h.sink.mu.Lock()
+	h.sink.buf.Reset()
+	err := h.inner.Handle(ctx, r)
+	body := bytes.TrimSuffix(h.sink.buf.Bytes(), []byte("\n"))
+	body = append([]byte(nil), body...)
+	h.sink.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	headers := map[string]string{
+		HeaderLevel: r.Level.String(),
+	}
+	if h.logger != "" {
+		headers[HeaderLogger] = h.logger
+	}
+	if !r.Time.IsZero() {
+		headers[HeaderTimestamp] = strconv.FormatInt(r.Time.UnixMilli(), 10)
+	}
+
+	return h.producer.Send(&flume.Event{Headers: headers, Body: body}, nil)
+}
+
+func (h *Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	x := *h
+	x.inner = h.inner.WithAttrs(attrs)
+	return &x
+}
+
+func (h *Handler) WithGroup(name string) slog.Handler {
+	x := *h
+	x.inner = h.inner.WithGroup(name)
+	return &x
+}
+
+// Flush sends all buffered records and waits until they are delivered or the
+// context is done.
+func (h *Handler) Flush(ctx context.Context) error {
+	return h.producer.Flush(ctx)
+}
+
+// Close sends all buffered records and stops the handler. It doesn't close
+// the client. Handlers created with the WithAttrs and WithGroup methods are
+// stopped as well.
+func (h *Handler) Close() error {
+	return h.producer.Close()
+}
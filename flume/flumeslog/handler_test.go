@@ -0,0 +1,87 @@
+package flumeslog_test
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/myzhan/avroipc/flume"
+	"github.com/myzhan/avroipc/flume/flumeslog"
+	"github.com/myzhan/avroipc/flumetest"
+)
+
+func TestHandler(t *testing.T) {
+	t.Run("records", func(t *testing.T) {
+		a := flumetest.NewAgent(t)
+		h := flumeslog.NewHandler(a.NewClient(t, nil), &flumeslog.Options{
+			Level:  slog.LevelDebug,
+			Logger: "test",
+		})
+
+		l := slog.New(h)
+		l.Debug("first", "a", 1)
+		l.With("b", "x").WithGroup("g").Error("second", "c", true)
+		require.NoError(t, h.Close())
+
+		events := a.Events()
+		require.Len(t, events, 2)
+
+		var body map[string]interface{}
+		require.NoError(t, json.Unmarshal(events[0].Body, &body))
+		require.Equal(t, "first", body["msg"])
+		require.Equal(t, "DEBUG", body["level"])
+		require.Equal(t, float64(1), body["a"])
+
+		require.Equal(t, "DEBUG", events[0].Headers["level"])
+		require.Equal(t, "test", events[0].Headers["logger"])
+		ts, err := strconv.ParseInt(events[0].Headers["timestamp"], 10, 64)
+		require.NoError(t, err)
+		require.InDelta(t, time.Now().UnixMilli(), ts, float64(time.Minute.Milliseconds()))
+
+		body = nil
+		require.NoError(t, json.Unmarshal(events[1].Body, &body))
+		require.Equal(t, "second", body["msg"])
+		require.Equal(t, "x", body["b"])
+		require.Equal(t, map[string]interface{}{"c": true}, body["g"])
+		require.Equal(t, "ERROR", events[1].Headers["level"])
+	})
+
+	t.Run("level", func(t *testing.T) {
+		a := flumetest.NewAgent(t)
+		h := flumeslog.NewHandler(a.NewClient(t, nil), nil)
+
+		l := slog.New(h)
+		l.Debug("skipped")
+		l.Info("shipped")
+		require.NoError(t, h.Flush(context.Background()))
+
+		require.Len(t, a.Events(), 1)
+		require.Contains(t, string(a.Events()[0].Body), `"msg":"shipped"`)
+		require.NotContains(t, a.Events()[0].Headers, "logger")
+		require.NoError(t, h.Close())
+	})
+
+	t.Run("bounded buffer", func(t *testing.T) {
+		a := flumetest.NewAgent(t)
+		a.Script(flumetest.Reply{Delay: 100 * time.Millisecond})
+		h := flumeslog.NewHandler(a.NewClient(t, nil), &flumeslog.Options{
+			Producer: &flume.ProducerConfig{
+				BatchSize: 1,
+				QueueSize: 1,
+				Overflow:  flume.DropNewest,
+			},
+		})
+
+		var err error
+		for i := 0; i < 10 && err == nil; i++ {
+			err = h.Handle(context.Background(), slog.NewRecord(time.Now(), slog.LevelInfo, "msg", 0))
+		}
+		require.Equal(t, flume.ErrQueueFull, err)
+		require.NoError(t, h.Close())
+	})
+}
@@ -0,0 +1,247 @@
+package flume
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Interceptor modifies events before sending them. Interceptors receive
+// copies of original events with copied headers, so they may change headers
+// freely but must not modify bodies in place.
+type Interceptor interface {
+	Intercept(event *Event)
+}
+
+// InterceptorFunc is an adapter to use ordinary functions as interceptors.
+type InterceptorFunc func(event *Event)
+
+func (f InterceptorFunc) Intercept(event *Event) {
+	f(event)
+}
+
+// TimestampInterceptor sets a header to the current time in milliseconds
+// since the Unix epoch like the TimestampInterceptor of Flume.
+type TimestampInterceptor struct {
+	// A name of the header.
+	//
+	// Defaults to empty which means "timestamp".
+	Header string
+	// Keep the existing header if it is already set.
+	//
+	// Defaults to false.
+	PreserveExisting bool
+}
+
+func (i *TimestampInterceptor) Intercept(event *Event) {
+	setHeader(event, headerOr(i.Header, "timestamp"), i.PreserveExisting, func() string {
+		return strconv.FormatInt(time.Now().UnixMilli(), 10)
+	})
+}
+
+// HostInterceptor sets a header to the host name or the IP address of the
+// local host like the HostInterceptor of Flume. The host is resolved once on
+// the first call. The header is not set if the host cannot be resolved.
+type HostInterceptor struct {
+	// A name of the header.
+	//
+	// Defaults to empty which means "host".
+	Header string
+	// Use the IP address of the host instead of its name.
+	//
+	// Defaults to false.
+	UseIP bool
+	// Keep the existing header if it is already set.
+	//
+	// Defaults to false.
+	PreserveExisting bool
+
+	once sync.Once
+	host string
+}
+
+func (i *HostInterceptor) Intercept(event *Event) {
+	i.once.Do(func() {
+		i.host = localHost(i.UseIP)
+	})
+	if i.host == "" {
+		return
+	}
+
+	setHeader(event, headerOr(i.Header, "host"), i.PreserveExisting, func() string {
+		return i.host
+	})
+}
+
+// UUIDInterceptor sets a header to a random UUID like the UUIDInterceptor of
+// Flume. It may be used to deduplicate events delivered more than once.
+type UUIDInterceptor struct {
+	// A name of the header.
+	//
+	// Defaults to empty which means "id".
+	Header string
+	// A prefix prepended to each UUID.
+	//
+	// Defaults to empty.
+	Prefix string
+	// Keep the existing header if it is already set.
+	//
+	// Defaults to false.
+	PreserveExisting bool
+}
+
+func (i *UUIDInterceptor) Intercept(event *Event) {
+	setHeader(event, headerOr(i.Header, "id"), i.PreserveExisting, func() string {
+		return i.Prefix + newUUID()
+	})
+}
+
+// StaticInterceptor sets a header to a fixed value like the StaticInterceptor
+// of Flume.
+type StaticInterceptor struct {
+	Key   string
+	Value string
+	// Keep the existing header if it is already set.
+	//
+	// Defaults to false.
+	PreserveExisting bool
+}
+
+func (i *StaticInterceptor) Intercept(event *Event) {
+	setHeader(event, i.Key, i.PreserveExisting, func() string {
+		return i.Value
+	})
+}
+
+type interceptedClient struct {
+	client       Client
+	interceptors []Interceptor
+}
+
+// NewInterceptedClient wraps the passed client with the chain of interceptors.
+// The wrapped client applies interceptors in the passed order to copies of
+// events before sending them, so original events are never modified.
+//
+// Interceptors are implemented as a decorator to be usable with any Client
+// implementation, e.g. with mocks or with other wrappers. Clients created by
+// the NewClientWithConfig function are wrapped with interceptors passed with
+// the WithInterceptors option.
+func NewInterceptedClient(client Client, interceptors ...Interceptor) Client {
+	return &interceptedClient{
+		client:       client,
+		interceptors: interceptors,
+	}
+}
+
+func (c *interceptedClient) Close() error {
+	return c.client.Close()
+}
+
+func (c *interceptedClient) Append(event *Event) (string, error) {
+	return c.client.Append(c.intercept(event))
+}
+
+func (c *interceptedClient) AppendBatch(events []*Event) (string, error) {
+	return c.client.AppendBatch(c.interceptAll(events))
+}
+
+func (c *interceptedClient) AppendContext(ctx context.Context, event *Event) (string, error) {
+	return AppendContext(ctx, c.client, c.intercept(event))
+}
+
+func (c *interceptedClient) AppendBatchContext(ctx context.Context, events []*Event) (string, error) {
+	return AppendBatchContext(ctx, c.client, c.interceptAll(events))
+}
+
+// intercept returns a copy of the event modified by all interceptors.
+func (c *interceptedClient) intercept(event *Event) *Event {
+	headers := make(map[string]string, len(event.Headers)+len(c.interceptors))
+	for k, v := range event.Headers {
+		headers[k] = v
+	}
+
+	e := &Event{
+		Headers: headers,
+		Body:    event.Body,
+	}
+	for _, i := range c.interceptors {
+		i.Intercept(e)
+	}
+
+	return e
+}
+
+func (c *interceptedClient) interceptAll(events []*Event) []*Event {
+	intercepted := make([]*Event, len(events))
+	for i, event := range events {
+		intercepted[i] = c.intercept(event)
+	}
+
+	return intercepted
+}
+
+func headerOr(header, def string) string {
+	if header == "" {
+		return def
+	}
+	return header
+}
+
+func setHeader(event *Event, key string, preserve bool, value func() string) {
+	if event.Headers == nil {
+		event.Headers = make(map[string]string)
+	}
+	if _, ok := event.Headers[key]; ok && preserve {
+		return
+	}
+	event.Headers[key] = value()
+}
+
+// localHost returns the name or the first non-loopback IP address of the
+// local host or an empty string if it cannot be resolved.
+func localHost(useIP bool) string {
+	name, err := os.Hostname()
+	if err != nil {
+		return ""
+	}
+	if !useIP {
+		return name
+	}
+
+	addrs, err := net.LookupIP(name)
+	if err == nil {
+		for _, addr := range addrs {
+			if !addr.IsLoopback() {
+				return addr.String()
+			}
+		}
+	}
+
+	ifaces, err := net.InterfaceAddrs()
+	if err != nil {
+		return ""
+	}
+	for _, addr := range ifaces {
+		if ipNet, ok := addr.(*net.IPNet); ok && !ipNet.IP.IsLoopback() {
+			return ipNet.IP.String()
+		}
+	}
+
+	return ""
+}
+
+// newUUID returns a random (version 4) UUID.
+func newUUID() string {
+	var b [16]byte
+	// The crypto/rand reader never returns errors on supported platforms.
+	_, _ = rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
@@ -0,0 +1,128 @@
+package flume
+
+import (
+	"context"
+	"os"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInterceptors(t *testing.T) {
+	t.Run("timestamp", func(t *testing.T) {
+		e := &Event{}
+		before := time.Now().UnixMilli()
+		(&TimestampInterceptor{}).Intercept(e)
+
+		ts, err := strconv.ParseInt(e.Headers["timestamp"], 10, 64)
+		require.NoError(t, err)
+		require.GreaterOrEqual(t, ts, before)
+		require.LessOrEqual(t, ts, time.Now().UnixMilli())
+
+		e = &Event{Headers: map[string]string{"ts": "1"}}
+		(&TimestampInterceptor{Header: "ts", PreserveExisting: true}).Intercept(e)
+		require.Equal(t, map[string]string{"ts": "1"}, e.Headers)
+	})
+
+	t.Run("host", func(t *testing.T) {
+		name, err := os.Hostname()
+		require.NoError(t, err)
+
+		e := &Event{}
+		(&HostInterceptor{}).Intercept(e)
+		require.Equal(t, map[string]string{"host": name}, e.Headers)
+
+		e = &Event{Headers: map[string]string{"h": "x"}}
+		(&HostInterceptor{Header: "h", PreserveExisting: true}).Intercept(e)
+		require.Equal(t, map[string]string{"h": "x"}, e.Headers)
+	})
+
+	t.Run("uuid", func(t *testing.T) {
+		re := regexp.MustCompile(`^p-[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+		i := &UUIDInterceptor{Prefix: "p-"}
+
+		e1, e2 := &Event{}, &Event{}
+		i.Intercept(e1)
+		i.Intercept(e2)
+		require.Regexp(t, re, e1.Headers["id"])
+		require.Regexp(t, re, e2.Headers["id"])
+		require.NotEqual(t, e1.Headers["id"], e2.Headers["id"])
+	})
+
+	t.Run("static", func(t *testing.T) {
+		e := &Event{Headers: map[string]string{"k": "old"}}
+		(&StaticInterceptor{Key: "k", Value: "new"}).Intercept(e)
+		require.Equal(t, map[string]string{"k": "new"}, e.Headers)
+
+		(&StaticInterceptor{Key: "k", Value: "newer", PreserveExisting: true}).Intercept(e)
+		require.Equal(t, map[string]string{"k": "new"}, e.Headers)
+	})
+}
+
+func TestInterceptedClient(t *testing.T) {
+	interceptors := []Interceptor{
+		&StaticInterceptor{Key: "env", Value: "test"},
+		InterceptorFunc(func(e *Event) {
+			e.Headers["env"] += "!"
+		}),
+	}
+	event := &Event{Headers: map[string]string{"k": "v"}, Body: []byte("test body")}
+	prepEvent := (&Event{
+		Headers: map[string]string{"k": "v", "env": "test!"},
+		Body:    event.Body,
+	}).toMap()
+
+	t.Run("append", func(t *testing.T) {
+		c, x := prepare()
+		ic := NewInterceptedClient(c, interceptors...)
+
+		x.On("SendMessage", "append", prepEvent).Return("OK", nil).Once()
+		x.On("SendMessageContext", mock.Anything, "append", prepEvent).Return("OK", nil).Once()
+
+		status, err := ic.Append(event)
+		require.NoError(t, err)
+		require.Equal(t, "OK", status)
+
+		status, err = AppendContext(context.Background(), ic, event)
+		require.NoError(t, err)
+		require.Equal(t, "OK", status)
+
+		require.Equal(t, map[string]string{"k": "v"}, event.Headers)
+		x.AssertExpectations(t)
+	})
+
+	t.Run("append batch", func(t *testing.T) {
+		c, x := prepare()
+		ic := NewInterceptedClient(c, interceptors...)
+
+		prepEvents := []map[string]interface{}{prepEvent, prepEvent}
+		x.On("SendMessage", "appendBatch", prepEvents).Return("OK", nil).Once()
+		x.On("SendMessageContext", mock.Anything, "appendBatch", prepEvents).Return("OK", nil).Once()
+
+		status, err := ic.AppendBatch([]*Event{event, event})
+		require.NoError(t, err)
+		require.Equal(t, "OK", status)
+
+		status, err = AppendBatchContext(context.Background(), ic, []*Event{event, event})
+		require.NoError(t, err)
+		require.Equal(t, "OK", status)
+
+		require.Equal(t, map[string]string{"k": "v"}, event.Headers)
+		x.AssertExpectations(t)
+	})
+
+	t.Run("nil headers", func(t *testing.T) {
+		c, x := prepare()
+		ic := NewInterceptedClient(c, &StaticInterceptor{Key: "env", Value: "test"})
+
+		x.On("SendMessage", "append", (&Event{Headers: map[string]string{"env": "test"}}).toMap()).Return("OK", nil).Once()
+
+		_, err := ic.Append(&Event{})
+		require.NoError(t, err)
+		x.AssertExpectations(t)
+	})
+}
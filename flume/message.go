@@ -68,6 +68,39 @@ func (p *AvroSourceProtocol) PrepareMessage(method string, datum interface{}) ([
 	return message.request.BinaryFromNative(nil, datum)
 }
 
+// ParseRequest decodes request parameters of the method. It is used by the
+// server side of the protocol and to decode requests for debugging purposes.
+func (p *AvroSourceProtocol) ParseRequest(method string, requestBytes []byte) (interface{}, []byte, error) {
+	message, ok := p.messages[method]
+	if !ok {
+		return nil, requestBytes, fmt.Errorf("unknown method name: %s", method)
+	}
+
+	return message.request.NativeFromBinary(requestBytes)
+}
+
+// PrepareResponse encodes a response of the method. It is used by the server
+// side of the protocol.
+func (p *AvroSourceProtocol) PrepareResponse(method string, datum interface{}) ([]byte, error) {
+	message, ok := p.messages[method]
+	if !ok {
+		return nil, fmt.Errorf("unknown method name: %s", method)
+	}
+
+	return message.response.BinaryFromNative(nil, datum)
+}
+
+// PrepareError encodes an error of the method as the system string error. It
+// is used by the server side of the protocol.
+func (p *AvroSourceProtocol) PrepareError(method string, err error) ([]byte, error) {
+	message, ok := p.messages[method]
+	if !ok {
+		return nil, fmt.Errorf("unknown method name: %s", method)
+	}
+
+	return message.errors.BinaryFromNative(nil, map[string]interface{}{"string": err.Error()})
+}
+
 func (p *AvroSourceProtocol) ParseMessage(method string, responseBytes []byte) (interface{}, []byte, error) {
 	message, ok := p.messages[method]
 	if !ok {
@@ -103,7 +136,7 @@ func (p *AvroSourceProtocol) ParseError(method string, responseBytes []byte) ([]
 		return responseBytes, fmt.Errorf("cannot convert string error to string: %v", responseInt)
 	}
 
-	return responseBytes, fmt.Errorf(responseStr)
+	return responseBytes, &protocols.RemoteError{Message: responseStr}
 }
 
 func (p *AvroSourceProtocol) GetSchema() string {
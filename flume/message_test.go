@@ -1,9 +1,11 @@
 package flume_test
 
 import (
+	"errors"
 	"testing"
 
 	"github.com/myzhan/avroipc/flume"
+	"github.com/myzhan/avroipc/protocols"
 
 	"github.com/stretchr/testify/require"
 )
@@ -72,6 +74,58 @@ func TestAvroSourceProtocol_PrepareMessage(t *testing.T) {
 	})
 }
 
+func TestAvroSourceProtocol_ParseRequest(t *testing.T) {
+	p, err := flume.NewAvroSource()
+	require.NoError(t, err)
+
+	parser, ok := p.(protocols.RequestParser)
+	require.True(t, ok)
+
+	t.Run("bad method", func(t *testing.T) {
+		_, _, err := parser.ParseRequest("bad method", []byte{0x0, 0x0})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "unknown method name: bad method")
+	})
+	t.Run("append", func(t *testing.T) {
+		actual, bytes, err := parser.ParseRequest("append", []byte{0x0, 0x12, 0x6e, 0x6f, 0x74, 0x20, 0x65, 0x6d, 0x70, 0x74, 0x79, 0x7})
+		require.NoError(t, err)
+		require.Equal(t, []byte{0x7}, bytes)
+		require.Equal(t, map[string]interface{}{"headers": map[string]interface{}{}, "body": []byte("not empty")}, actual)
+	})
+	t.Run("appendBatch", func(t *testing.T) {
+		actual, bytes, err := parser.ParseRequest("appendBatch", []byte{0x2, 0x0, 0x2, 0x61, 0x0})
+		require.NoError(t, err)
+		require.Equal(t, []byte{}, bytes)
+		require.Len(t, actual, 1)
+	})
+}
+
+func TestAvroSourceProtocol_PrepareResponse(t *testing.T) {
+	p, err := flume.NewAvroSource()
+	require.NoError(t, err)
+
+	server, ok := p.(protocols.ServerProtocol)
+	require.True(t, ok)
+
+	t.Run("bad method", func(t *testing.T) {
+		_, err := server.PrepareResponse("bad method", "OK")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "unknown method name: bad method")
+	})
+	for _, method := range []string{"append", "appendBatch"} {
+		t.Run(method+" ok", func(t *testing.T) {
+			actual, err := server.PrepareResponse(method, "FAILED")
+			require.NoError(t, err)
+			require.Equal(t, []byte{0x2}, actual)
+		})
+		t.Run(method+" error", func(t *testing.T) {
+			actual, err := server.PrepareError(method, errors.New("not empty"))
+			require.NoError(t, err)
+			require.Equal(t, []byte{0x0, 0x12, 0x6e, 0x6f, 0x74, 0x20, 0x65, 0x6d, 0x70, 0x74, 0x79}, actual)
+		})
+	}
+}
+
 func TestAvroSourceProtocol_ParseMessage(t *testing.T) {
 	p, err := flume.NewAvroSource()
 	require.NoError(t, err)
@@ -116,6 +170,7 @@ func TestAvroSourceProtocol_ParseError(t *testing.T) {
 			bytes, err := p.ParseError(method, []byte{0x0, 0x12, 0x6e, 0x6f, 0x74, 0x20, 0x65, 0x6d, 0x70, 0x74, 0x79})
 			require.Error(t, err)
 			require.Contains(t, err.Error(), "not empty")
+			require.IsType(t, &protocols.RemoteError{}, err)
 			require.Equal(t, []byte{}, bytes)
 		})
 		t.Run(method+" short buffer", func(t *testing.T) {
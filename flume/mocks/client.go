@@ -1,6 +1,8 @@
 package mocks
 
 import (
+	"context"
+
 	"github.com/stretchr/testify/mock"
 )
 
@@ -17,3 +19,8 @@ func (c *MockClient) SendMessage(method string, datum interface{}) (string, erro
 	args := c.Called(method, datum)
 	return args.String(0), args.Error(1)
 }
+
+func (c *MockClient) SendMessageContext(ctx context.Context, method string, datum interface{}) (string, error) {
+	args := c.Called(ctx, method, datum)
+	return args.String(0), args.Error(1)
+}
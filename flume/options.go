@@ -0,0 +1,40 @@
+package flume
+
+// Option configures Flume-specific behaviour of clients created by the
+// NewClientWithConfig function. Options of the underlying connection are
+// set with the avroipc.Config instead.
+type Option func(o *options)
+
+type options struct {
+	traceEventHeaders bool
+	statusErrors      bool
+	interceptors      []Interceptor
+}
+
+// WithTraceEventHeaders enables injection of the trace context into headers
+// of each event sent with a context. The propagator of the avroipc.Config is
+// used if it is set, otherwise the W3C trace context format is used.
+func WithTraceEventHeaders() Option {
+	return func(o *options) {
+		o.traceEventHeaders = true
+	}
+}
+
+// WithStatusErrors enables returning of FAILED and UNKNOWN statuses of Flume
+// agents as *StatusError errors. FAILED statuses are also retried with the
+// retry policy of the avroipc.Config if it is set while UNKNOWN statuses are
+// never retried because events may have been already accepted.
+func WithStatusErrors() Option {
+	return func(o *options) {
+		o.statusErrors = true
+	}
+}
+
+// WithInterceptors installs the chain of interceptors that modify copies of
+// events before sending them, see the NewInterceptedClient function. Several
+// options append their interceptors to the same chain.
+func WithInterceptors(interceptors ...Interceptor) Option {
+	return func(o *options) {
+		o.interceptors = append(o.interceptors, interceptors...)
+	}
+}
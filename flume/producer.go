@@ -0,0 +1,525 @@
+package flume
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/linkedin/goavro/v2"
+
+	"github.com/myzhan/avroipc/logger"
+	"github.com/myzhan/avroipc/protocols"
+	"github.com/myzhan/avroipc/spool"
+)
+
+// ErrQueueFull is returned by the Producer.Send method and passed to delivery
+// callbacks of dropped events when the queue of the producer is full.
+var ErrQueueFull = errors.New("producer queue is full")
+
+// ErrProducerClosed is returned by the Producer.Send method after closing
+// the producer.
+var ErrProducerClosed = errors.New("producer is closed")
+
+// ErrSpooled is passed to delivery callbacks of events that are not delivered
+// but written to the spool of the producer. They will be delivered later
+// without calling callbacks again. It is also returned by the Producer.Flush
+// method if the spool is not empty.
+var ErrSpooled = errors.New("event is spooled")
+
+// OverflowPolicy defines a behaviour of the producer when its queue is full.
+type OverflowPolicy int
+
+const (
+	// Block the Send method until there is room in the queue.
+	Block OverflowPolicy = iota
+	// Reject new events with the ErrQueueFull error.
+	DropNewest
+	// Drop the oldest queued event to make room for a new one. The delivery
+	// callback of the dropped event is called with the ErrQueueFull error
+	// from the goroutine of the producer.
+	DropOldest
+)
+
+// DeliveryCallback is called when an event is delivered or cannot be
+// delivered. Callbacks are called from the goroutine of the producer and
+// must not block.
+type DeliveryCallback func(event *Event, err error)
+
+// ProducerConfig provides a configuration for the producer.
+type ProducerConfig struct {
+	// A maximum number of events in a single batch.
+	//
+	// Defaults to zero which means that 100 events will be used.
+	BatchSize int
+	// A maximum total size of headers and bodies of events in a single batch
+	// in bytes. Events larger than this size are sent in separate batches.
+	//
+	// Defaults to zero which means no limit.
+	BatchBytes int
+	// A maximum time an event waits in an incomplete batch before sending.
+	//
+	// Defaults to zero which means that 10 milliseconds will be used.
+	Linger time.Duration
+
+	// A maximum number of events waiting for sending.
+	//
+	// Defaults to zero which means that 10000 events will be used.
+	QueueSize int
+	// A behaviour of the producer when its queue is full.
+	//
+	// Defaults to Block.
+	Overflow OverflowPolicy
+
+	// A spool for events that cannot be delivered. Events of failed batches
+	// are written to the spool and delivered later. All new events are
+	// written to the spool as well until it is empty to keep the original
+	// order. Events rejected with remote errors are not spooled because they
+	// would be rejected again. The producer doesn't close the spool.
+	//
+	// Defaults to nil which means that failed events are lost.
+	Spool *spool.Spool
+	// An interval between attempts to deliver spooled events.
+	//
+	// Defaults to zero which means that one second will be used.
+	SpoolRetryInterval time.Duration
+	// A maximum number of attempts to deliver a spooled batch rejected by the
+	// agent with a status other than OK. The batch is dropped after the last
+	// attempt. Spooled batches rejected with remote errors are dropped
+	// immediately, batches that are not delivered because of other errors,
+	// e.g. connection errors, are retried without a limit.
+	//
+	// Defaults to zero which means that 10 attempts will be used.
+	SpoolMaxAttempts int
+
+	// A logger for failed batches.
+	//
+	// Defaults to nil which means that messages are discarded.
+	Logger logger.Logger
+}
+
+type queued struct {
+	event    *Event
+	callback DeliveryCallback
+}
+
+// Producer sends events asynchronously accumulating them into batches.
+type Producer struct {
+	client Client
+
+	batchSize  int
+	batchBytes int
+	linger     time.Duration
+	overflow   OverflowPolicy
+	logger     logger.Logger
+
+	spool         *spool.Spool
+	retryInterval time.Duration
+	maxAttempts   int
+	codec         *goavro.Codec
+	// Events are written to the spool while it is not empty.
+	spooling bool
+	// Spooled events are delivered by a separate goroutine, so new events
+	// are spooled without waiting for the agent.
+	replayed chan bool
+	// Attempts to deliver the first spooled batch rejected by the agent.
+	attempts int
+
+	mu      sync.RWMutex
+	closed  bool
+	queue   chan queued
+	flushes chan chan error
+	done    chan struct{}
+
+	// Events dropped by the DropOldest policy are passed to the goroutine of
+	// the producer to call their callbacks.
+	droppedMu sync.Mutex
+	dropped   []queued
+	drops     chan struct{}
+}
+
+// NewProducer creates a producer that sends events through the passed
+// client and starts its goroutine. The producer doesn't close the client.
+func NewProducer(client Client, config *ProducerConfig) *Producer {
+	p := &Producer{
+		client:     client,
+		batchSize:  100,
+		batchBytes: config.BatchBytes,
+		linger:     10 * time.Millisecond,
+		overflow:   config.Overflow,
+		logger:     logger.OrNop(config.Logger),
+		flushes:    make(chan chan error),
+		done:       make(chan struct{}),
+		drops:      make(chan struct{}, 1),
+
+		spool:         config.Spool,
+		retryInterval: time.Second,
+		maxAttempts:   10,
+		replayed:      make(chan bool),
+	}
+	if config.BatchSize > 0 {
+		p.batchSize = config.BatchSize
+	}
+	if config.Linger > 0 {
+		p.linger = config.Linger
+	}
+	if config.SpoolRetryInterval > 0 {
+		p.retryInterval = config.SpoolRetryInterval
+	}
+	if config.SpoolMaxAttempts > 0 {
+		p.maxAttempts = config.SpoolMaxAttempts
+	}
+	// The error is only related to compilations of Avro schemas and is not
+	// possible at runtime because it will be caught by unit tests.
+	p.codec, _ = goavro.NewCodec(eventSchema)
+	queueSize := 10000
+	if config.QueueSize > 0 {
+		queueSize = config.QueueSize
+	}
+	p.queue = make(chan queued, queueSize)
+
+	go p.run()
+
+	return p
+}
+
+// Send queues the event for sending. The callback is called after the event
+// is delivered or cannot be delivered and may be nil. Send returns
+// immediately unless the queue is full and the overflow policy is Block.
+func (p *Producer) Send(event *Event, callback DeliveryCallback) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.closed {
+		return ErrProducerClosed
+	}
+
+	m := queued{event: event, callback: callback}
+	switch p.overflow {
+	case DropNewest:
+		select {
+		case p.queue <- m:
+			return nil
+		default:
+			return ErrQueueFull
+		}
+	case DropOldest:
+		for {
+			select {
+			case p.queue <- m:
+				return nil
+			default:
+			}
+
+			select {
+			case old := <-p.queue:
+				p.drop(old)
+			default:
+			}
+		}
+	default:
+		p.queue <- m
+		return nil
+	}
+}
+
+// Flush sends all events queued before the call and waits until they are
+// delivered or the context is done. It returns the ErrSpooled error if some
+// events are written to the spool and not delivered yet.
+func (p *Producer) Flush(ctx context.Context) error {
+	flushed := make(chan error, 1)
+	select {
+	case p.flushes <- flushed:
+	case <-p.done:
+		return ErrProducerClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	select {
+	case err := <-flushed:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close sends all queued events and stops the producer. Delivering of
+// spooled events is interrupted, they are delivered by the next producer
+// with the same spool. It doesn't close the client.
+func (p *Producer) Close() error {
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.queue)
+	}
+	p.mu.Unlock()
+
+	<-p.done
+	return nil
+}
+
+func (p *Producer) run() {
+	defer close(p.done)
+
+	var batch []queued
+	size := 0
+
+	timer := time.NewTimer(p.linger)
+	if !timer.Stop() {
+		<-timer.C
+	}
+
+	retry := time.NewTimer(p.retryInterval)
+	if !retry.Stop() {
+		<-retry.C
+	}
+	defer retry.Stop()
+
+	// Spooled events of the previous run are delivered immediately.
+	p.spooling = p.spool != nil && !p.spool.Empty()
+	if p.spooling {
+		retry.Reset(0)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	replaying := false
+
+	send := func() {
+		if len(batch) > 0 {
+			if p.send(batch) {
+				retry.Reset(p.retryInterval)
+			}
+			batch = nil
+			size = 0
+		}
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+	}
+	add := func(m queued) {
+		s := eventSize(m.event)
+		if p.batchBytes > 0 && size+s > p.batchBytes {
+			send()
+		}
+		if len(batch) == 0 {
+			timer.Reset(p.linger)
+		}
+		batch = append(batch, m)
+		size += s
+		if len(batch) >= p.batchSize {
+			send()
+		}
+	}
+
+	for {
+		select {
+		case m, ok := <-p.queue:
+			if !ok {
+				send()
+				p.notifyDropped()
+				if replaying {
+					cancel()
+					<-p.replayed
+				}
+				return
+			}
+			add(m)
+		case <-p.drops:
+			p.notifyDropped()
+		case flushed := <-p.flushes:
+			// Events queued before the flush request may be still in the
+			// queue because select chooses ready cases randomly.
+			for n := len(p.queue); n > 0; n-- {
+				m, ok := <-p.queue
+				if !ok {
+					break
+				}
+				add(m)
+			}
+			send()
+			p.notifyDropped()
+			if p.spooling {
+				flushed <- ErrSpooled
+			}
+			close(flushed)
+		case <-timer.C:
+			send()
+		case <-retry.C:
+			replaying = true
+			go func() {
+				p.replayed <- p.replay(ctx)
+			}()
+		case empty := <-p.replayed:
+			replaying = false
+			switch {
+			case !empty:
+				retry.Reset(p.retryInterval)
+			case !p.spool.Empty():
+				// Events are spooled after the last batch is replayed.
+				retry.Reset(0)
+			default:
+				p.spooling = false
+			}
+		}
+	}
+}
+
+// drop passes the dropped event to the goroutine of the producer.
+func (p *Producer) drop(m queued) {
+	if m.callback == nil {
+		return
+	}
+
+	p.droppedMu.Lock()
+	p.dropped = append(p.dropped, m)
+	p.droppedMu.Unlock()
+
+	select {
+	case p.drops <- struct{}{}:
+	default:
+	}
+}
+
+// notifyDropped calls callbacks of dropped events.
+func (p *Producer) notifyDropped() {
+	p.droppedMu.Lock()
+	dropped := p.dropped
+	p.dropped = nil
+	p.droppedMu.Unlock()
+
+	for _, m := range dropped {
+		m.callback(m.event, ErrQueueFull)
+	}
+}
+
+// send sends the batch or writes it to the spool. It returns true if the
+// spooling is started by this batch.
+func (p *Producer) send(batch []queued) bool {
+	if p.spooling {
+		p.spoolBatch(batch)
+		return false
+	}
+
+	events := make([]*Event, len(batch))
+	for i, m := range batch {
+		events[i] = m.event
+	}
+
+	err := p.appendBatch(context.Background(), events)
+	if err != nil {
+		p.logger.Warn("batch is not delivered", "events", len(events), "error", err)
+
+		var remoteErr *protocols.RemoteError
+		if p.spool != nil && !errors.As(err, &remoteErr) {
+			p.spooling = true
+			p.spoolBatch(batch)
+			return true
+		}
+	}
+
+	for _, m := range batch {
+		if m.callback != nil {
+			m.callback(m.event, err)
+		}
+	}
+
+	return false
+}
+
+func (p *Producer) appendBatch(ctx context.Context, events []*Event) error {
+	_, err := checkStatus(AppendBatchContext(ctx, p.client, events))
+	return err
+}
+
+func (p *Producer) spoolBatch(batch []queued) {
+	for _, m := range batch {
+		record, err := p.codec.BinaryFromNative(nil, m.event.toMap())
+		if err == nil {
+			err = p.spool.Write(record)
+		}
+		if err != nil {
+			p.logger.Error("event is not spooled", "error", err)
+		} else {
+			err = ErrSpooled
+		}
+
+		if m.callback != nil {
+			m.callback(m.event, err)
+		}
+	}
+}
+
+// replay delivers spooled events in batches until the spool is empty or the
+// context is done. It returns false if a batch is not delivered.
+func (p *Producer) replay(ctx context.Context) bool {
+	for {
+		records, err := p.spool.Peek(p.batchSize)
+		if err != nil {
+			p.logger.Error("cannot read spooled events", "error", err)
+			return false
+		}
+		if len(records) == 0 {
+			return true
+		}
+
+		events := make([]*Event, 0, len(records))
+		for _, record := range records {
+			datum, _, err := p.codec.NativeFromBinary(record)
+			if err != nil {
+				p.logger.Error("dropping corrupted spooled event", "error", err)
+				continue
+			}
+			events = append(events, eventFromMap(datum))
+		}
+
+		if len(events) > 0 {
+			err = p.appendBatch(ctx, events)
+			if ctx.Err() != nil {
+				return false
+			}
+			if err != nil && !p.undeliverable(err) {
+				p.logger.Warn("spooled batch is not delivered", "events", len(events), "error", err)
+				return false
+			}
+			if err != nil {
+				p.logger.Error("dropping spooled batch", "events", len(events), "attempts", p.attempts, "error", err)
+			}
+			p.attempts = 0
+		}
+
+		err = p.spool.Commit()
+		if err != nil {
+			p.logger.Error("cannot commit spooled events", "error", err)
+			return false
+		}
+	}
+}
+
+// undeliverable counts a failed attempt to deliver the first spooled batch
+// and reports whether the batch must be dropped.
+func (p *Producer) undeliverable(err error) bool {
+	var remoteErr *protocols.RemoteError
+	if errors.As(err, &remoteErr) {
+		return true
+	}
+
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) {
+		return false
+	}
+	p.attempts++
+	return p.attempts >= p.maxAttempts
+}
+
+func eventSize(e *Event) int {
+	size := len(e.Body)
+	for k, v := range e.Headers {
+		size += len(k) + len(v)
+	}
+	return size
+}
@@ -0,0 +1,372 @@
+package flume_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/myzhan/avroipc/flume"
+	"github.com/myzhan/avroipc/flumetest"
+	"github.com/myzhan/avroipc/spool"
+)
+
+// A client that blocks batches until they are released.
+type blockingClient struct {
+	flume.Client
+
+	batches chan []*flume.Event
+	release chan struct{}
+}
+
+func newBlockingClient() *blockingClient {
+	return &blockingClient{
+		batches: make(chan []*flume.Event, 100),
+		release: make(chan struct{}),
+	}
+}
+
+func (c *blockingClient) AppendBatch(events []*flume.Event) (string, error) {
+	c.batches <- events
+	<-c.release
+	return "OK", nil
+}
+
+// A client that fails the first batch and blocks the rest until they are
+// released.
+type flakyClient struct {
+	*blockingClient
+
+	failed bool
+}
+
+func (c *flakyClient) AppendBatch(events []*flume.Event) (string, error) {
+	if !c.failed {
+		c.failed = true
+		return "", errors.New("test error")
+	}
+	return c.blockingClient.AppendBatch(events)
+}
+
+// A client that fails all batches.
+type failingClient struct {
+	flume.Client
+}
+
+func (c *failingClient) AppendBatch(events []*flume.Event) (string, error) {
+	return "", errors.New("test error")
+}
+
+type deliveries struct {
+	mu     sync.Mutex
+	errors map[string]error
+}
+
+func (d *deliveries) callback(event *flume.Event, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.errors == nil {
+		d.errors = make(map[string]error)
+	}
+	d.errors[string(event.Body)] = err
+}
+
+func (d *deliveries) get() map[string]error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.errors
+}
+
+func makeEvent(body string) *flume.Event {
+	return &flume.Event{Body: []byte(body)}
+}
+
+func TestProducer(t *testing.T) {
+	t.Run("batch size", func(t *testing.T) {
+		a := flumetest.NewAgent(t)
+		p := flume.NewProducer(a.NewClient(t, nil), &flume.ProducerConfig{
+			BatchSize: 2,
+			Linger:    time.Hour,
+		})
+
+		d := &deliveries{}
+		for i := 0; i < 5; i++ {
+			require.NoError(t, p.Send(makeEvent(fmt.Sprint(i)), d.callback))
+		}
+		a.WaitForEvents(t, 4, time.Second)
+		require.NoError(t, p.Close())
+
+		a.RequireBodies(t, "0", "1", "2", "3", "4")
+		require.Len(t, a.Calls(), 3)
+		require.Equal(t, map[string]error{"0": nil, "1": nil, "2": nil, "3": nil, "4": nil}, d.get())
+
+		require.Equal(t, flume.ErrProducerClosed, p.Send(makeEvent("5"), nil))
+		require.Equal(t, flume.ErrProducerClosed, p.Flush(context.Background()))
+	})
+
+	t.Run("batch bytes", func(t *testing.T) {
+		a := flumetest.NewAgent(t)
+		p := flume.NewProducer(a.NewClient(t, nil), &flume.ProducerConfig{
+			BatchBytes: 4,
+			Linger:     time.Hour,
+		})
+
+		for _, body := range []string{"aa", "bb", "ccccc", "d"} {
+			require.NoError(t, p.Send(makeEvent(body), nil))
+		}
+		require.NoError(t, p.Flush(context.Background()))
+
+		calls := a.Calls()
+		require.Len(t, calls, 3)
+		require.Len(t, calls[0].Events, 2)
+		require.Len(t, calls[1].Events, 1)
+		require.Len(t, calls[2].Events, 1)
+		require.NoError(t, p.Close())
+	})
+
+	t.Run("linger", func(t *testing.T) {
+		a := flumetest.NewAgent(t)
+		p := flume.NewProducer(a.NewClient(t, nil), &flume.ProducerConfig{
+			Linger: time.Millisecond,
+		})
+		defer p.Close()
+
+		require.NoError(t, p.Send(makeEvent("a"), nil))
+		a.WaitForEvents(t, 1, time.Second)
+	})
+
+	t.Run("failed delivery", func(t *testing.T) {
+		a := flumetest.NewAgent(t)
+		a.Script(flumetest.Reply{Status: "FAILED"}, flumetest.Reply{Error: "test error"})
+		p := flume.NewProducer(a.NewClient(t, nil), &flume.ProducerConfig{})
+
+		d := &deliveries{}
+		require.NoError(t, p.Send(makeEvent("a"), d.callback))
+		require.NoError(t, p.Flush(context.Background()))
+		require.NoError(t, p.Send(makeEvent("b"), d.callback))
+		require.NoError(t, p.Close())
+
+		require.EqualError(t, d.get()["a"], "unexpected status: FAILED")
+		require.EqualError(t, d.get()["b"], "test error")
+	})
+
+	t.Run("drop newest", func(t *testing.T) {
+		c := newBlockingClient()
+		p := flume.NewProducer(c, &flume.ProducerConfig{
+			BatchSize: 1,
+			QueueSize: 1,
+			Overflow:  flume.DropNewest,
+		})
+
+		require.NoError(t, p.Send(makeEvent("a"), nil))
+		// Wait until the producer is blocked by the first batch.
+		<-c.batches
+		require.NoError(t, p.Send(makeEvent("b"), nil))
+		require.Equal(t, flume.ErrQueueFull, p.Send(makeEvent("c"), nil))
+
+		close(c.release)
+		require.NoError(t, p.Close())
+		require.Equal(t, "b", string((<-c.batches)[0].Body))
+	})
+
+	t.Run("drop oldest", func(t *testing.T) {
+		c := newBlockingClient()
+		p := flume.NewProducer(c, &flume.ProducerConfig{
+			BatchSize: 1,
+			QueueSize: 1,
+			Overflow:  flume.DropOldest,
+		})
+
+		d := &deliveries{}
+		require.NoError(t, p.Send(makeEvent("a"), d.callback))
+		<-c.batches
+		require.NoError(t, p.Send(makeEvent("b"), d.callback))
+		require.NoError(t, p.Send(makeEvent("c"), d.callback))
+		// The callback of the dropped event is not called by Send but by
+		// the goroutine of the producer that is blocked by the client.
+		require.Empty(t, d.get())
+
+		close(c.release)
+		require.NoError(t, p.Flush(context.Background()))
+		require.Equal(t, map[string]error{"a": nil, "b": flume.ErrQueueFull, "c": nil}, d.get())
+		require.NoError(t, p.Close())
+		require.Equal(t, "c", string((<-c.batches)[0].Body))
+	})
+
+	t.Run("block", func(t *testing.T) {
+		c := newBlockingClient()
+		p := flume.NewProducer(c, &flume.ProducerConfig{
+			BatchSize: 1,
+			QueueSize: 1,
+		})
+
+		require.NoError(t, p.Send(makeEvent("a"), nil))
+		<-c.batches
+		require.NoError(t, p.Send(makeEvent("b"), nil))
+
+		sent := make(chan error)
+		go func() {
+			sent <- p.Send(makeEvent("c"), nil)
+		}()
+		select {
+		case <-sent:
+			t.Fatal("send is not blocked")
+		case <-time.After(10 * time.Millisecond):
+		}
+
+		close(c.release)
+		require.NoError(t, <-sent)
+		require.NoError(t, p.Close())
+	})
+
+	t.Run("flush timeout", func(t *testing.T) {
+		c := newBlockingClient()
+		p := flume.NewProducer(c, &flume.ProducerConfig{})
+
+		require.NoError(t, p.Send(makeEvent("a"), nil))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		require.Equal(t, context.DeadlineExceeded, p.Flush(ctx))
+
+		close(c.release)
+		require.NoError(t, p.Close())
+	})
+}
+
+func TestProducer_Spool(t *testing.T) {
+	prepareSpool := func(t *testing.T, dir string) *spool.Spool {
+		s, err := spool.Open(dir, &spool.Config{})
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			_ = s.Close()
+		})
+		return s
+	}
+
+	t.Run("failed batch", func(t *testing.T) {
+		a := flumetest.NewAgent(t)
+		a.Script(flumetest.Reply{Status: "FAILED"}, flumetest.Reply{Drop: true})
+		s := prepareSpool(t, t.TempDir())
+		p := flume.NewProducer(a.NewClient(t, nil), &flume.ProducerConfig{
+			Spool:              s,
+			SpoolRetryInterval: 10 * time.Millisecond,
+		})
+
+		d := &deliveries{}
+		require.NoError(t, p.Send(&flume.Event{Headers: map[string]string{"k": "v"}, Body: []byte("a")}, d.callback))
+		require.Equal(t, flume.ErrSpooled, p.Flush(context.Background()))
+		// New events are spooled to keep the order.
+		require.NoError(t, p.Send(makeEvent("b"), d.callback))
+		require.Equal(t, flume.ErrSpooled, p.Flush(context.Background()))
+		require.Equal(t, map[string]error{"a": flume.ErrSpooled, "b": flume.ErrSpooled}, d.get())
+
+		// The first replay fails because of the dropped connection.
+		a.WaitForEvents(t, 2, time.Second)
+		a.RequireBodies(t, "a", "b")
+		require.Equal(t, map[string]string{"k": "v"}, a.Events()[0].Headers)
+		require.Len(t, a.Calls(), 3)
+
+		require.Eventually(t, s.Empty, time.Second, time.Millisecond)
+		require.NoError(t, p.Send(makeEvent("c"), d.callback))
+		require.NoError(t, p.Close())
+		require.Nil(t, d.get()["c"])
+		a.RequireBodies(t, "a", "b", "c")
+	})
+
+	t.Run("recovery", func(t *testing.T) {
+		dir := t.TempDir()
+
+		s := prepareSpool(t, dir)
+		p := flume.NewProducer(&failingClient{}, &flume.ProducerConfig{Spool: s})
+		require.NoError(t, p.Send(makeEvent("a"), nil))
+		require.NoError(t, p.Send(makeEvent("b"), nil))
+		require.NoError(t, p.Close())
+		require.NoError(t, s.Close())
+
+		a := flumetest.NewAgent(t)
+		p = flume.NewProducer(a.NewClient(t, nil), &flume.ProducerConfig{Spool: prepareSpool(t, dir)})
+		a.WaitForEvents(t, 2, time.Second)
+		require.NoError(t, p.Close())
+		a.RequireBodies(t, "a", "b")
+	})
+
+	t.Run("remote error", func(t *testing.T) {
+		a := flumetest.NewAgent(t)
+		a.Script(flumetest.Reply{Error: "bad event"})
+		s := prepareSpool(t, t.TempDir())
+		p := flume.NewProducer(a.NewClient(t, nil), &flume.ProducerConfig{Spool: s})
+
+		d := &deliveries{}
+		require.NoError(t, p.Send(makeEvent("a"), d.callback))
+		require.NoError(t, p.Close())
+
+		require.EqualError(t, d.get()["a"], "bad event")
+		require.True(t, s.Empty())
+	})
+
+	t.Run("background replay", func(t *testing.T) {
+		c := &flakyClient{blockingClient: newBlockingClient()}
+		s := prepareSpool(t, t.TempDir())
+		p := flume.NewProducer(c, &flume.ProducerConfig{
+			Spool:              s,
+			SpoolRetryInterval: time.Millisecond,
+		})
+
+		require.NoError(t, p.Send(makeEvent("a"), nil))
+		require.Equal(t, flume.ErrSpooled, p.Flush(context.Background()))
+		require.Equal(t, "a", string((<-c.batches)[0].Body))
+
+		// The producer is not blocked by the replayed batch.
+		require.NoError(t, p.Send(makeEvent("b"), nil))
+		require.Equal(t, flume.ErrSpooled, p.Flush(context.Background()))
+
+		close(c.release)
+		require.Eventually(t, func() bool {
+			return p.Flush(context.Background()) == nil
+		}, time.Second, time.Millisecond)
+		require.True(t, s.Empty())
+		require.NoError(t, p.Close())
+		require.Equal(t, "b", string((<-c.batches)[0].Body))
+	})
+
+	t.Run("undeliverable spooled batches", func(t *testing.T) {
+		a := flumetest.NewAgent(t)
+		a.Script(
+			// The first batch is rejected on every attempt.
+			flumetest.Reply{Status: flume.StatusFailed},
+			flumetest.Reply{Status: flume.StatusFailed},
+			flumetest.Reply{Status: flume.StatusFailed},
+			// The second batch is rejected with a remote error after
+			// spooling.
+			flumetest.Reply{Drop: true},
+			flumetest.Reply{Error: "bad event"},
+		)
+		s := prepareSpool(t, t.TempDir())
+		p := flume.NewProducer(a.NewClient(t, nil), &flume.ProducerConfig{
+			Spool:              s,
+			SpoolRetryInterval: time.Millisecond,
+			SpoolMaxAttempts:   2,
+		})
+
+		for _, body := range []string{"a", "b"} {
+			require.NoError(t, p.Send(makeEvent(body), nil))
+			require.Equal(t, flume.ErrSpooled, p.Flush(context.Background()))
+			require.Eventually(t, func() bool {
+				return p.Flush(context.Background()) == nil
+			}, time.Second, time.Millisecond)
+		}
+		require.True(t, s.Empty())
+		require.Len(t, a.Calls(), 5)
+
+		require.NoError(t, p.Send(makeEvent("c"), nil))
+		require.NoError(t, p.Close())
+		a.RequireBodies(t, "c")
+	})
+}
@@ -0,0 +1,71 @@
+package flume
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/myzhan/avroipc"
+)
+
+// Status is a result of appending events returned by a Flume agent.
+type Status string
+
+const (
+	// Events are accepted by the agent.
+	StatusOK Status = "OK"
+	// Events are not accepted by the agent, e.g. because its channel is full.
+	// Sending them again may succeed.
+	StatusFailed Status = "FAILED"
+	// The agent doesn't know whether events are accepted. Sending them again
+	// may duplicate them.
+	StatusUnknown Status = "UNKNOWN"
+)
+
+// StatusError is returned by clients instead of statuses other than OK if
+// status errors are enabled by the WithStatusErrors option.
+type StatusError struct {
+	Status Status
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected status: %s", e.Status)
+}
+
+// IsRetryable reports whether a failed request to a Flume agent may be
+// retried. Errors with the FAILED status are retryable, errors with the
+// UNKNOWN status are not. Other errors are checked with the
+// avroipc.IsRetryable function.
+func IsRetryable(err error) bool {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.Status == StatusFailed
+	}
+
+	return avroipc.IsRetryable(err)
+}
+
+// checkStatus converts statuses other than OK to errors.
+func checkStatus(status string, err error) (string, error) {
+	if err == nil && Status(status) != StatusOK {
+		err = &StatusError{Status: Status(status)}
+	}
+	return status, err
+}
+
+// retryable returns a function that retries FAILED statuses and passes all
+// other errors to the passed function or to the avroipc.IsRetryable function
+// if it is nil.
+func retryable(fn func(err error) bool) func(err error) bool {
+	if fn == nil {
+		return IsRetryable
+	}
+
+	return func(err error) bool {
+		var statusErr *StatusError
+		if errors.As(err, &statusErr) {
+			return statusErr.Status == StatusFailed
+		}
+
+		return fn(err)
+	}
+}
@@ -0,0 +1,122 @@
+package flume_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/myzhan/avroipc"
+	"github.com/myzhan/avroipc/flume"
+	"github.com/myzhan/avroipc/flumetest"
+)
+
+func TestIsRetryable(t *testing.T) {
+	require.True(t, flume.IsRetryable(&flume.StatusError{Status: flume.StatusFailed}))
+	require.False(t, flume.IsRetryable(&flume.StatusError{Status: flume.StatusUnknown}))
+	require.True(t, flume.IsRetryable(&avroipc.TransportError{Err: errors.New("test error")}))
+	require.False(t, flume.IsRetryable(errors.New("test error")))
+}
+
+func TestClient_StatusErrors(t *testing.T) {
+	event := &flume.Event{Body: []byte("a")}
+	policy := &avroipc.RetryPolicy{MaxAttempts: 3, BaseBackoff: time.Millisecond}
+
+	t.Run("disabled", func(t *testing.T) {
+		a := flumetest.NewAgent(t)
+		a.Script(flumetest.Reply{Status: flume.StatusFailed})
+		c := a.NewClient(t, avroipc.NewConfig().WithRetryPolicy(policy))
+
+		status, err := c.Append(event)
+		require.NoError(t, err)
+		require.Equal(t, "FAILED", status)
+		require.Len(t, a.Calls(), 1)
+	})
+
+	t.Run("without retries", func(t *testing.T) {
+		a := flumetest.NewAgent(t)
+		a.Script(flumetest.Reply{Status: flume.StatusFailed})
+		c := a.NewClient(t, nil, flume.WithStatusErrors())
+
+		status, err := c.Append(event)
+		require.EqualError(t, err, "unexpected status: FAILED")
+		require.Equal(t, &flume.StatusError{Status: flume.StatusFailed}, err)
+		require.Equal(t, "FAILED", status)
+
+		status, err = c.Append(event)
+		require.NoError(t, err)
+		require.Equal(t, "OK", status)
+	})
+
+	t.Run("failed status retried", func(t *testing.T) {
+		a := flumetest.NewAgent(t)
+		a.Script(
+			flumetest.Reply{Status: flume.StatusFailed},
+			flumetest.Reply{Status: flume.StatusFailed},
+		)
+		c := a.NewClient(t, avroipc.NewConfig().WithRetryPolicy(policy), flume.WithStatusErrors())
+
+		status, err := flume.AppendBatchContext(context.Background(), c, []*flume.Event{event})
+		require.NoError(t, err)
+		require.Equal(t, "OK", status)
+		require.Len(t, a.Calls(), 3)
+		a.RequireBodies(t, "a")
+	})
+
+	t.Run("failed status exhausted", func(t *testing.T) {
+		a := flumetest.NewAgent(t)
+		a.Script(
+			flumetest.Reply{Status: flume.StatusFailed},
+			flumetest.Reply{Status: flume.StatusFailed},
+			flumetest.Reply{Status: flume.StatusFailed},
+		)
+		c := a.NewClient(t, avroipc.NewConfig().WithRetryPolicy(policy), flume.WithStatusErrors())
+
+		status, err := c.Append(event)
+		require.Equal(t, &flume.StatusError{Status: flume.StatusFailed}, err)
+		require.Equal(t, "FAILED", status)
+		require.Len(t, a.Calls(), 3)
+	})
+
+	t.Run("unknown status not retried", func(t *testing.T) {
+		a := flumetest.NewAgent(t)
+		a.Script(flumetest.Reply{Status: flume.StatusUnknown})
+		c := a.NewClient(t, avroipc.NewConfig().WithRetryPolicy(policy), flume.WithStatusErrors())
+
+		status, err := c.Append(event)
+		require.Equal(t, &flume.StatusError{Status: flume.StatusUnknown}, err)
+		require.Equal(t, "UNKNOWN", status)
+		require.Len(t, a.Calls(), 1)
+	})
+
+	t.Run("custom retryable function", func(t *testing.T) {
+		a := flumetest.NewAgent(t)
+		a.Script(
+			flumetest.Reply{Error: "test error"},
+			flumetest.Reply{Status: flume.StatusFailed},
+		)
+		custom := *policy
+		custom.Retryable = func(err error) bool { return true }
+		c := a.NewClient(t, avroipc.NewConfig().WithRetryPolicy(&custom), flume.WithStatusErrors())
+
+		status, err := c.Append(event)
+		require.NoError(t, err)
+		require.Equal(t, "OK", status)
+		require.Len(t, a.Calls(), 3)
+	})
+
+	t.Run("canceled context", func(t *testing.T) {
+		a := flumetest.NewAgent(t)
+		a.Script(flumetest.Reply{Status: flume.StatusFailed})
+		c := a.NewClient(t, avroipc.NewConfig().WithRetryPolicy(policy), flume.WithStatusErrors())
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err := flume.AppendContext(ctx, c, event)
+		require.ErrorIs(t, err, context.Canceled)
+		require.Empty(t, a.Calls())
+	})
+}
@@ -0,0 +1,170 @@
+package flume
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+)
+
+// ErrWriterClosed is returned by the Writer after closing it.
+var ErrWriterClosed = errors.New("writer is closed")
+
+// WriterConfig provides a configuration for the writer.
+type WriterConfig struct {
+	// A delimiter of events in the input stream. Delimiters are not included
+	// into event bodies.
+	//
+	// Defaults to nil which means a newline.
+	Delimiter []byte
+	// A maximum size of a single event body in bytes. Longer chunks of the
+	// input stream are split into several events.
+	//
+	// Defaults to zero which means no limit.
+	MaxSize int
+	// Headers attached to every event.
+	//
+	// Defaults to nil which means events without headers.
+	Headers map[string]string
+	// A maximum number of events in a single batch.
+	//
+	// Defaults to zero which means that 100 events will be used.
+	BatchSize int
+}
+
+// Writer splits a byte stream into events and sends them in batches. Events
+// are sent when the batch is full and on the Flush and Close calls. Empty
+// events are skipped.
+//
+// Like the bufio.Writer, if an error occurs sending a batch, no more data
+// will be accepted and all subsequent calls will return the error.
+type Writer struct {
+	client    Client
+	delimiter []byte
+	maxSize   int
+	headers   map[string]string
+	batchSize int
+
+	mu     sync.Mutex
+	buf    []byte
+	batch  []*Event
+	err    error
+	closed bool
+}
+
+// NewWriter creates a writer that sends events through the passed client.
+// The writer doesn't close the client.
+func NewWriter(client Client, config *WriterConfig) *Writer {
+	w := &Writer{
+		client:    client,
+		delimiter: []byte("\n"),
+		maxSize:   config.MaxSize,
+		headers:   make(map[string]string, len(config.Headers)),
+		batchSize: 100,
+	}
+	if len(config.Delimiter) > 0 {
+		w.delimiter = config.Delimiter
+	}
+	for k, v := range config.Headers {
+		w.headers[k] = v
+	}
+	if config.BatchSize > 0 {
+		w.batchSize = config.BatchSize
+	}
+
+	return w
+}
+
+// Write splits the input into events. An incomplete tail of the input is
+// kept until the next delimiter, the maximum size or closing the writer.
+func (w *Writer) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return 0, ErrWriterClosed
+	}
+	if w.err != nil {
+		return 0, w.err
+	}
+
+	w.buf = append(w.buf, p...)
+
+	start := 0
+	for w.err == nil {
+		rest := w.buf[start:]
+		i := bytes.Index(rest, w.delimiter)
+		if i >= 0 && (w.maxSize == 0 || i <= w.maxSize) {
+			w.add(rest[:i])
+			start += i + len(w.delimiter)
+		} else if w.maxSize > 0 && len(rest) >= w.maxSize {
+			w.add(rest[:w.maxSize])
+			start += w.maxSize
+		} else {
+			break
+		}
+	}
+	w.buf = append(w.buf[:0], w.buf[start:]...)
+
+	return len(p), w.err
+}
+
+// Flush sends all complete events. The incomplete tail of the input is not
+// sent.
+func (w *Writer) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return ErrWriterClosed
+	}
+	if w.err == nil {
+		w.send()
+	}
+	return w.err
+}
+
+// Close sends the incomplete tail of the input as the last event along with
+// all other events and closes the writer. It doesn't close the client.
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return ErrWriterClosed
+	}
+	w.closed = true
+
+	if w.err == nil {
+		w.add(w.buf)
+		w.buf = nil
+	}
+	if w.err == nil {
+		w.send()
+	}
+	return w.err
+}
+
+// add appends an event with a copy of the body to the batch and sends the
+// batch if it is full.
+func (w *Writer) add(body []byte) {
+	if len(body) == 0 {
+		return
+	}
+
+	w.batch = append(w.batch, &Event{
+		Headers: w.headers,
+		Body:    append([]byte(nil), body...),
+	})
+	if len(w.batch) >= w.batchSize {
+		w.send()
+	}
+}
+
+func (w *Writer) send() {
+	if len(w.batch) == 0 {
+		return
+	}
+
+	_, w.err = checkStatus(w.client.AppendBatch(w.batch))
+	w.batch = nil
+}
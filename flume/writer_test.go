@@ -0,0 +1,78 @@
+package flume_test
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/myzhan/avroipc/flume"
+	"github.com/myzhan/avroipc/flumetest"
+)
+
+func TestWriter(t *testing.T) {
+	t.Run("lines", func(t *testing.T) {
+		a := flumetest.NewAgent(t)
+		w := flume.NewWriter(a.NewClient(t, nil), &flume.WriterConfig{
+			Headers:   map[string]string{"source": "test"},
+			BatchSize: 2,
+		})
+
+		n, err := io.Copy(w, strings.NewReader("a\nb\n\nc\nd"))
+		require.NoError(t, err)
+		require.Equal(t, int64(8), n)
+		// The first batch is sent as soon as it is full.
+		a.RequireBodies(t, "a", "b")
+
+		require.NoError(t, w.Flush())
+		a.RequireBodies(t, "a", "b", "c")
+
+		require.NoError(t, w.Close())
+		a.RequireBodies(t, "a", "b", "c", "d")
+		require.Len(t, a.Calls(), 3)
+		require.Equal(t, map[string]string{"source": "test"}, a.Events()[0].Headers)
+
+		_, err = w.Write([]byte("e"))
+		require.Equal(t, flume.ErrWriterClosed, err)
+		require.Equal(t, flume.ErrWriterClosed, w.Close())
+	})
+
+	t.Run("split writes", func(t *testing.T) {
+		a := flumetest.NewAgent(t)
+		w := flume.NewWriter(a.NewClient(t, nil), &flume.WriterConfig{Delimiter: []byte("||")})
+
+		for _, s := range []string{"ab|", "|c", "d|", "|e|"} {
+			_, err := w.Write([]byte(s))
+			require.NoError(t, err)
+		}
+		require.NoError(t, w.Close())
+		a.RequireBodies(t, "ab", "cd", "e|")
+	})
+
+	t.Run("max size", func(t *testing.T) {
+		a := flumetest.NewAgent(t)
+		w := flume.NewWriter(a.NewClient(t, nil), &flume.WriterConfig{MaxSize: 3})
+
+		_, err := fmt.Fprint(w, "abcdefg\nhij\nk")
+		require.NoError(t, err)
+		require.NoError(t, w.Close())
+		a.RequireBodies(t, "abc", "def", "g", "hij", "k")
+	})
+
+	t.Run("sticky error", func(t *testing.T) {
+		a := flumetest.NewAgent(t)
+		a.Script(flumetest.Reply{Status: flume.StatusFailed})
+		w := flume.NewWriter(a.NewClient(t, nil), &flume.WriterConfig{BatchSize: 1})
+
+		_, err := w.Write([]byte("a\n"))
+		require.Equal(t, &flume.StatusError{Status: flume.StatusFailed}, err)
+
+		_, err = w.Write([]byte("b\n"))
+		require.Equal(t, &flume.StatusError{Status: flume.StatusFailed}, err)
+		require.Equal(t, &flume.StatusError{Status: flume.StatusFailed}, w.Flush())
+		require.Equal(t, &flume.StatusError{Status: flume.StatusFailed}, w.Close())
+		require.Len(t, a.Calls(), 1)
+	})
+}
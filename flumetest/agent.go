@@ -0,0 +1,289 @@
+// Package flumetest provides a fake Flume agent and helpers for testing code
+// that sends events to Flume through the flume package.
+package flumetest
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/myzhan/avroipc"
+	"github.com/myzhan/avroipc/flume"
+	"github.com/myzhan/avroipc/protocols"
+	"github.com/myzhan/avroipc/transports"
+)
+
+var errDropped = errors.New("connection dropped")
+
+// Reply is a scripted reaction of the agent to a single call.
+type Reply struct {
+	// A status returned to the client: OK, FAILED or UNKNOWN.
+	//
+	// Defaults to empty which means OK.
+	Status flume.Status
+	// A remote error returned to the client instead of the status.
+	//
+	// Defaults to empty which means no error.
+	Error string
+	// A delay before replying to the client.
+	Delay time.Duration
+	// Drop the connection instead of replying to the client.
+	Drop bool
+}
+
+func (r Reply) accepted() bool {
+	return (r.Status == "" || r.Status == flume.StatusOK) && r.Error == "" && !r.Drop
+}
+
+// Call is a call received by the agent.
+type Call struct {
+	// A name of the called message: append or appendBatch.
+	Method string
+	// Events received with the call.
+	Events []*flume.Event
+	// A reply to the call.
+	Reply Reply
+}
+
+// Agent is a fake Flume agent with an Avro source. It performs real
+// handshakes, records received events and replies to calls according to a
+// script. Calls that are not scripted are accepted with the OK status.
+type Agent struct {
+	proto protocols.ServerProtocol
+	ln    net.Listener
+
+	mu     sync.Mutex
+	script []Reply
+	calls  []Call
+	events []*flume.Event
+	conns  map[net.Conn]struct{}
+
+	wg sync.WaitGroup
+}
+
+// NewAgent starts a fake agent listening on a random local port. The agent
+// is closed when the test finishes.
+func NewAgent(t testing.TB) *Agent {
+	proto, err := flume.NewAvroSource()
+	require.NoError(t, err)
+
+	a := &Agent{
+		proto: proto.(protocols.ServerProtocol),
+		conns: make(map[net.Conn]struct{}),
+	}
+
+	a.ln, err = net.Listen("tcp4", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	a.wg.Add(1)
+	go a.accept()
+
+	t.Cleanup(func() {
+		_ = a.Close()
+	})
+
+	return a
+}
+
+// Addr returns an address the agent listens on.
+func (a *Agent) Addr() string {
+	return a.ln.Addr().String()
+}
+
+// Dialer returns a dialer for the avroipc.Config that connects clients to
+// the agent through in-memory pipes instead of sockets.
+func (a *Agent) Dialer() func(addr string) (transports.Transport, error) {
+	return func(addr string) (transports.Transport, error) {
+		client, server := net.Pipe()
+		a.serve(server)
+		return transports.NewConn(client), nil
+	}
+}
+
+// NewClient creates a flume client connected to the agent through a socket.
+// The client is closed when the test finishes.
+func (a *Agent) NewClient(t testing.TB, config *avroipc.Config, opts ...flume.Option) flume.Client {
+	if config == nil {
+		config = avroipc.NewConfig()
+	}
+
+	c, err := flume.NewClientWithConfig(a.Addr(), config, opts...)
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		_ = c.Close()
+	})
+
+	return c
+}
+
+// Script appends replies to the script. Every call takes the first reply of
+// the script.
+func (a *Agent) Script(replies ...Reply) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.script = append(a.script, replies...)
+}
+
+// Calls returns all calls received by the agent.
+func (a *Agent) Calls() []Call {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return append([]Call(nil), a.calls...)
+}
+
+// Events returns events of calls accepted by the agent with the OK status.
+func (a *Agent) Events() []*flume.Event {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return append([]*flume.Event(nil), a.events...)
+}
+
+// Reset forgets all received calls and events and clears the script.
+func (a *Agent) Reset() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.script = nil
+	a.calls = nil
+	a.events = nil
+}
+
+// WaitForEvents waits until the agent accepts at least n events and returns
+// all accepted events. The test fails if there are not enough events before
+// the timeout.
+func (a *Agent) WaitForEvents(t testing.TB, n int, timeout time.Duration) []*flume.Event {
+	var events []*flume.Event
+	require.Eventually(t, func() bool {
+		events = a.Events()
+		return len(events) >= n
+	}, timeout, time.Millisecond, "expected at least %d events", n)
+
+	return events
+}
+
+// RequireBodies checks that bodies of accepted events are equal to the
+// passed ones in the same order.
+func (a *Agent) RequireBodies(t testing.TB, bodies ...string) {
+	actual := make([]string, 0)
+	for _, e := range a.Events() {
+		actual = append(actual, string(e.Body))
+	}
+
+	require.Equal(t, append(make([]string, 0), bodies...), actual)
+}
+
+// Close stops the agent and closes all its connections.
+func (a *Agent) Close() error {
+	err := a.ln.Close()
+
+	a.mu.Lock()
+	for conn := range a.conns {
+		_ = conn.Close()
+	}
+	a.mu.Unlock()
+
+	a.wg.Wait()
+
+	return err
+}
+
+func (a *Agent) accept() {
+	defer a.wg.Done()
+
+	for {
+		conn, err := a.ln.Accept()
+		if err != nil {
+			return
+		}
+		a.serve(conn)
+	}
+}
+
+func (a *Agent) serve(conn net.Conn) {
+	a.mu.Lock()
+	a.conns[conn] = struct{}{}
+	a.mu.Unlock()
+
+	a.wg.Add(1)
+	go func() {
+		defer a.wg.Done()
+
+		// Errors are seen by clients as closed connections.
+		_ = avroipc.Serve(transports.NewConn(conn), a.proto, func(method string, datum interface{}) (interface{}, error) {
+			return a.handle(conn, method, datum)
+		})
+
+		a.mu.Lock()
+		delete(a.conns, conn)
+		a.mu.Unlock()
+	}()
+}
+
+func (a *Agent) handle(conn net.Conn, method string, datum interface{}) (interface{}, error) {
+	call := Call{
+		Method: method,
+	}
+	switch method {
+	case "append":
+		call.Events = []*flume.Event{toEvent(datum)}
+	case "appendBatch":
+		items, _ := datum.([]interface{})
+		for _, item := range items {
+			call.Events = append(call.Events, toEvent(item))
+		}
+	}
+
+	a.mu.Lock()
+	if len(a.script) > 0 {
+		call.Reply = a.script[0]
+		a.script = a.script[1:]
+	}
+	a.calls = append(a.calls, call)
+	if call.Reply.accepted() {
+		a.events = append(a.events, call.Events...)
+	}
+	a.mu.Unlock()
+
+	reply := call.Reply
+	if reply.Delay > 0 {
+		time.Sleep(reply.Delay)
+	}
+	if reply.Drop {
+		_ = conn.Close()
+		return nil, errDropped
+	}
+	if reply.Error != "" {
+		return nil, errors.New(reply.Error)
+	}
+	if reply.Status == "" {
+		return string(flume.StatusOK), nil
+	}
+
+	return string(reply.Status), nil
+}
+
+func toEvent(datum interface{}) *flume.Event {
+	m, _ := datum.(map[string]interface{})
+	headers, _ := m["headers"].(map[string]interface{})
+	body, _ := m["body"].([]byte)
+
+	// The body refers to the buffer of the framing layer that is reused for
+	// the next request.
+	e := &flume.Event{
+		Headers: make(map[string]string, len(headers)),
+		Body:    append([]byte(nil), body...),
+	}
+	for k, v := range headers {
+		e.Headers[k], _ = v.(string)
+	}
+
+	return e
+}
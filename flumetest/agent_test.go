@@ -0,0 +1,112 @@
+package flumetest_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/myzhan/avroipc"
+	"github.com/myzhan/avroipc/flume"
+	"github.com/myzhan/avroipc/flumetest"
+	"github.com/myzhan/avroipc/protocols"
+)
+
+func TestAgent(t *testing.T) {
+	event := &flume.Event{
+		Headers: map[string]string{"key": "value"},
+		Body:    []byte("a"),
+	}
+
+	t.Run("accepted events", func(t *testing.T) {
+		a := flumetest.NewAgent(t)
+		c := a.NewClient(t, nil)
+
+		status, err := c.Append(event)
+		require.NoError(t, err)
+		require.Equal(t, "OK", status)
+
+		status, err = c.AppendBatch([]*flume.Event{{Body: []byte("b")}, {Body: []byte("c")}})
+		require.NoError(t, err)
+		require.Equal(t, "OK", status)
+
+		a.RequireBodies(t, "a", "b", "c")
+		require.Equal(t, event.Headers, a.Events()[0].Headers)
+		require.Len(t, a.Calls(), 2)
+		require.Equal(t, "appendBatch", a.Calls()[1].Method)
+
+		a.Reset()
+		a.RequireBodies(t)
+		require.Empty(t, a.Calls())
+	})
+
+	t.Run("scripted replies", func(t *testing.T) {
+		a := flumetest.NewAgent(t)
+		a.Script(
+			flumetest.Reply{Status: "FAILED"},
+			flumetest.Reply{Status: "UNKNOWN"},
+			flumetest.Reply{Error: "test error"},
+		)
+		c := a.NewClient(t, nil)
+
+		status, err := c.Append(event)
+		require.NoError(t, err)
+		require.Equal(t, "FAILED", status)
+
+		status, err = c.Append(event)
+		require.NoError(t, err)
+		require.Equal(t, "UNKNOWN", status)
+
+		_, err = c.Append(event)
+		require.EqualError(t, err, "test error")
+		require.IsType(t, &protocols.RemoteError{}, err)
+
+		// The script is over.
+		status, err = c.Append(event)
+		require.NoError(t, err)
+		require.Equal(t, "OK", status)
+
+		require.Len(t, a.Calls(), 4)
+		require.Len(t, a.Events(), 1)
+	})
+
+	t.Run("delay", func(t *testing.T) {
+		a := flumetest.NewAgent(t)
+		a.Script(flumetest.Reply{Delay: 100 * time.Millisecond})
+		c := a.NewClient(t, avroipc.NewConfig().WithSendTimeout(10*time.Millisecond))
+
+		_, err := c.Append(event)
+		require.Error(t, err)
+		require.Equal(t, "timeout", avroipc.ErrorType(err))
+	})
+
+	t.Run("dropped connection", func(t *testing.T) {
+		a := flumetest.NewAgent(t)
+		a.Script(flumetest.Reply{Drop: true})
+		c := a.NewClient(t, nil)
+
+		_, err := c.Append(event)
+		require.Error(t, err)
+		require.IsType(t, &avroipc.TransportError{}, err)
+
+		// The client reconnects to the agent.
+		status, err := c.Append(event)
+		require.NoError(t, err)
+		require.Equal(t, "OK", status)
+		a.RequireBodies(t, "a")
+	})
+
+	t.Run("dialer", func(t *testing.T) {
+		a := flumetest.NewAgent(t)
+		c, err := flume.NewClientWithConfig("in-memory", avroipc.NewConfig().WithDialer(a.Dialer()))
+		require.NoError(t, err)
+
+		go func() {
+			_, _ = c.Append(event)
+		}()
+
+		events := a.WaitForEvents(t, 1, time.Second)
+		require.Equal(t, []byte("a"), events[0].Body)
+		require.NoError(t, c.Close())
+	})
+}
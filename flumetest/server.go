@@ -0,0 +1,85 @@
+package flumetest
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// RunServer runs a TCP server on a random local port that serves accepted
+// connections one by one with the handler. It is a low-level helper for tests
+// that check raw bytes on the wire, see the Agent for a fake Flume agent.
+//
+// It returns an address of the server and a function that stops it. The
+// function closes the current connection, waits for the handler and returns
+// the first error returned by the handler. Errors caused by closing the
+// connection are ignored.
+func RunServer(t *testing.T, handler func(net.Conn) error) (string, func() error) {
+	ln, err := net.Listen("tcp4", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	var (
+		mu      sync.Mutex
+		current net.Conn
+		stopped bool
+		first   error
+	)
+	serve := func(conn net.Conn) {
+		defer conn.Close()
+
+		mu.Lock()
+		if stopped {
+			mu.Unlock()
+			return
+		}
+		current = conn
+		mu.Unlock()
+
+		err := handler(conn)
+
+		mu.Lock()
+		current = nil
+		if err != nil && !errors.Is(err, net.ErrClosed) && first == nil {
+			first = err
+		}
+		mu.Unlock()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			// The listener is closed by the returned function.
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			serve(conn)
+		}
+	}()
+
+	stop := func() error {
+		err := ln.Close()
+
+		mu.Lock()
+		stopped = true
+		if current != nil {
+			_ = current.Close()
+		}
+		mu.Unlock()
+
+		<-done
+
+		mu.Lock()
+		defer mu.Unlock()
+		if first != nil {
+			return first
+		}
+		return err
+	}
+
+	return ln.Addr().String(), stop
+}
@@ -0,0 +1,44 @@
+package flumetest_test
+
+import (
+	"errors"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/myzhan/avroipc/flumetest"
+)
+
+func TestRunServer(t *testing.T) {
+	t.Run("handler error", func(t *testing.T) {
+		addr, stop := flumetest.RunServer(t, func(conn net.Conn) error {
+			return errors.New("test error")
+		})
+
+		conn, err := net.Dial("tcp4", addr)
+		require.NoError(t, err)
+		// Wait for the handler to close the connection.
+		_, err = io.ReadAll(conn)
+		require.NoError(t, err)
+		require.NoError(t, conn.Close())
+
+		require.EqualError(t, stop(), "test error")
+	})
+
+	t.Run("open connection", func(t *testing.T) {
+		addr, stop := flumetest.RunServer(t, func(conn net.Conn) error {
+			_, err := io.ReadAll(conn)
+			return err
+		})
+
+		conn, err := net.Dial("tcp4", addr)
+		require.NoError(t, err)
+		_, err = conn.Write([]byte("a"))
+		require.NoError(t, err)
+
+		require.NoError(t, stop())
+		require.NoError(t, conn.Close())
+	})
+}
@@ -0,0 +1,71 @@
+// Package cli implements flags shared by the commands of the repository.
+package cli
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// TLSFlags are flags of TLS connections to servers.
+type TLSFlags struct {
+	Enabled  bool
+	CAFile   string
+	Insecure bool
+}
+
+// Register defines the -tls, -tls-ca and -tls-insecure flags in the flag set.
+func (f *TLSFlags) Register(fs *flag.FlagSet) {
+	fs.BoolVar(&f.Enabled, "tls", false, "connect with TLS")
+	fs.StringVar(&f.CAFile, "tls-ca", "", "PEM file with CA certificates to verify the server")
+	fs.BoolVar(&f.Insecure, "tls-insecure", false, "skip verification of the server certificate")
+}
+
+// Config returns a TLS configuration built from the flags or nil if TLS is
+// disabled. CA certificates are loaded from the file if it is set, otherwise
+// the system pool is used.
+func (f *TLSFlags) Config() (*tls.Config, error) {
+	if !f.Enabled {
+		return nil, nil
+	}
+
+	config := &tls.Config{InsecureSkipVerify: f.Insecure}
+	if f.CAFile != "" {
+		pem, err := os.ReadFile(f.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", f.CAFile)
+		}
+	}
+
+	return config, nil
+}
+
+// Headers is a flag of event headers in the key=value format that may be
+// repeated to set several headers.
+type Headers map[string]string
+
+func (h Headers) String() string {
+	pairs := make([]string, 0, len(h))
+	for k, v := range h {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (h Headers) Set(s string) error {
+	k, v, ok := strings.Cut(s, "=")
+	if !ok {
+		return fmt.Errorf("header %q is not in the key=value format", s)
+	}
+	h[k] = v
+	return nil
+}
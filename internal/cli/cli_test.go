@@ -0,0 +1,97 @@
+package cli
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"flag"
+	"io"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func writeCA(t *testing.T, file string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	b := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	require.NoError(t, os.WriteFile(file, b, 0o600))
+}
+
+func TestTLSFlags(t *testing.T) {
+	parse := func(t *testing.T, args ...string) *TLSFlags {
+		var f TLSFlags
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		f.Register(fs)
+		require.NoError(t, fs.Parse(args))
+		return &f
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		config, err := parse(t, "-tls-insecure").Config()
+		require.NoError(t, err)
+		require.Nil(t, config)
+	})
+
+	t.Run("insecure", func(t *testing.T) {
+		config, err := parse(t, "-tls", "-tls-insecure").Config()
+		require.NoError(t, err)
+		require.True(t, config.InsecureSkipVerify)
+		require.Nil(t, config.RootCAs)
+	})
+
+	t.Run("CA file", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "ca.pem")
+		writeCA(t, file)
+
+		config, err := parse(t, "-tls", "-tls-ca", file).Config()
+		require.NoError(t, err)
+		require.False(t, config.InsecureSkipVerify)
+		require.NotNil(t, config.RootCAs)
+	})
+
+	t.Run("missing CA file", func(t *testing.T) {
+		_, err := parse(t, "-tls", "-tls-ca", "missing.pem").Config()
+		require.ErrorIs(t, err, os.ErrNotExist)
+	})
+
+	t.Run("no certificates", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "ca.pem")
+		require.NoError(t, os.WriteFile(file, []byte("test"), 0o600))
+
+		_, err := parse(t, "-tls", "-tls-ca", file).Config()
+		require.EqualError(t, err, "no certificates found in "+file)
+	})
+}
+
+func TestHeaders(t *testing.T) {
+	h := Headers{}
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.Var(h, "header", "")
+
+	require.NoError(t, fs.Parse([]string{"-header", "b=2", "-header", "a=1=x"}))
+	require.Equal(t, Headers{"a": "1=x", "b": "2"}, h)
+	require.Equal(t, "a=1=x,b=2", h.String())
+
+	fs.SetOutput(io.Discard)
+	require.Error(t, fs.Parse([]string{"-header", "x"}))
+}
@@ -0,0 +1,65 @@
+package layers
+
+import (
+	"bytes"
+	"reflect"
+
+	"github.com/myzhan/avroipc/protocols"
+)
+
+// NewRequestComparer returns a function that compares framed requests by
+// their decoded content instead of bytes. It is supposed to be used with the
+// replay transport because Avro maps like event headers and call metadata
+// are encoded in random order.
+//
+// Request parameters are decoded only if the message protocol implements the
+// protocols.RequestParser interface, otherwise they are compared byte by
+// byte. The message protocol may be nil.
+func NewRequestComparer(proto protocols.MessageProtocol) func(expected, actual []byte) bool {
+	return func(expected, actual []byte) bool {
+		if bytes.Equal(expected, actual) {
+			return true
+		}
+
+		e, n := ParseFrames(expected)
+		if n != len(expected) || n == 0 {
+			return false
+		}
+		a, n := ParseFrames(actual)
+		if n != len(actual) || n == 0 {
+			return false
+		}
+		if e.Serial != a.Serial {
+			return false
+		}
+
+		// Requests don't tell whether they contain a handshake, so both
+		// variants are tried.
+		for _, skipHandshake := range []bool{true, false} {
+			em, err := decodeRequest(proto, e.Payload, skipHandshake)
+			if err != nil {
+				continue
+			}
+			am, err := decodeRequest(proto, a.Payload, skipHandshake)
+			if err != nil {
+				continue
+			}
+			if reflect.DeepEqual(em, am) {
+				return true
+			}
+		}
+
+		return false
+	}
+}
+
+func decodeRequest(proto protocols.MessageProtocol, b []byte, skipHandshake bool) (*protocols.Message, error) {
+	// The error is only related to compilations of Avro schemas and is not
+	// possible at runtime because it will be caught by unit tests.
+	decoder, _ := protocols.NewDecoder(proto)
+	if skipHandshake {
+		decoder.SkipHandshake()
+	}
+
+	return decoder.DecodeRequest(b)
+}
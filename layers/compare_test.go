@@ -0,0 +1,69 @@
+package layers_test
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/myzhan/avroipc/flume"
+	"github.com/myzhan/avroipc/layers"
+)
+
+// frame wraps the payload into a single frame with the serial.
+func frame(serial uint32, payload ...byte) []byte {
+	b := make([]byte, 12, 12+len(payload))
+	binary.BigEndian.PutUint32(b[0:4], serial)
+	binary.BigEndian.PutUint32(b[4:8], 1)
+	binary.BigEndian.PutUint32(b[8:12], uint32(len(payload)))
+	return append(b, payload...)
+}
+
+func TestNewRequestComparer(t *testing.T) {
+	proto, err := flume.NewAvroSource()
+	require.NoError(t, err)
+
+	// Call metadata with the "a" and "b" keys in the passed order.
+	meta := func(first, second byte) []byte {
+		return []byte{0x4, 0x2, first, 0x2, 0x1, 0x2, second, 0x2, 0x1, 0x0}
+	}
+	// An append request with an event with the "a" and "b" headers in the
+	// passed order.
+	appendRequest := func(m []byte, first, second byte, body byte) []byte {
+		b := append([]byte(nil), m...)
+		b = append(b, 0xc, 'a', 'p', 'p', 'e', 'n', 'd')
+		b = append(b, 0x4, 0x2, first, 0x2, '1', 0x2, second, 0x2, '1', 0x0)
+		return append(b, 0x2, body)
+	}
+
+	equal := layers.NewRequestComparer(proto)
+
+	t.Run("maps in different order", func(t *testing.T) {
+		expected := frame(1, appendRequest(meta('a', 'b'), 'a', 'b', 'x')...)
+		actual := frame(1, appendRequest(meta('b', 'a'), 'b', 'a', 'x')...)
+
+		require.NotEqual(t, expected, actual)
+		require.True(t, equal(expected, actual))
+	})
+
+	t.Run("different content", func(t *testing.T) {
+		expected := frame(1, appendRequest(meta('a', 'b'), 'a', 'b', 'x')...)
+
+		require.False(t, equal(expected, frame(1, appendRequest(meta('b', 'a'), 'b', 'a', 'y')...)))
+		require.False(t, equal(expected, frame(2, appendRequest(meta('a', 'b'), 'a', 'b', 'x')...)))
+		require.False(t, equal(expected, expected[:len(expected)-1]))
+	})
+
+	t.Run("without protocol", func(t *testing.T) {
+		equal := layers.NewRequestComparer(nil)
+		expected := frame(1, appendRequest(meta('a', 'b'), 'a', 'b', 'x')...)
+
+		// Parameters are compared byte by byte.
+		require.True(t, equal(expected, frame(1, appendRequest(meta('b', 'a'), 'a', 'b', 'x')...)))
+		require.False(t, equal(expected, frame(1, appendRequest(meta('a', 'b'), 'b', 'a', 'x')...)))
+	})
+
+	t.Run("same bytes", func(t *testing.T) {
+		require.True(t, equal([]byte{0x1}, []byte{0x1}))
+	})
+}
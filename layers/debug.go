@@ -0,0 +1,170 @@
+package layers
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+
+	"github.com/myzhan/avroipc/logger"
+	"github.com/myzhan/avroipc/protocols"
+	"github.com/myzhan/avroipc/transports"
+)
+
+// Frames is a single framed request or response.
+type Frames struct {
+	// A serial number of the request.
+	Serial uint32
+	// Sizes of all frames.
+	Sizes []int
+	// Concatenated content of all frames.
+	Payload []byte
+}
+
+// ParseFrames parses a single framed request or response from the beginning
+// of the buffer. It returns the parsed frames and the number of consumed bytes
+// or zero if the buffer doesn't contain a complete message yet.
+func ParseFrames(b []byte) (*Frames, int) {
+	if len(b) < 8 {
+		return nil, 0
+	}
+
+	f := &Frames{
+		Serial: binary.BigEndian.Uint32(b[0:4]),
+	}
+	frames := binary.BigEndian.Uint32(b[4:8])
+	n := 8
+
+	payload := bytes.Buffer{}
+	for i := uint32(0); i < frames; i++ {
+		if len(b)-n < 4 {
+			return nil, 0
+		}
+		size := int(binary.BigEndian.Uint32(b[n : n+4]))
+		n += 4
+
+		if len(b)-n < size {
+			return nil, 0
+		}
+		payload.Write(b[n : n+size])
+		n += size
+
+		f.Sizes = append(f.Sizes, size)
+	}
+	f.Payload = payload.Bytes()
+
+	return f, n
+}
+
+// DebugConfig provides a configuration for the debug layer.
+type DebugConfig struct {
+	// A logger for dumps of requests and responses. All messages are logged
+	// with the info level.
+	//
+	// Defaults to nil which means that messages are discarded.
+	Logger logger.Logger
+
+	// A message protocol that is used to decode datums of requests and
+	// responses.
+	//
+	// Defaults to nil which means that only handshakes, call metadata and
+	// message names are decoded.
+	Protocol protocols.MessageProtocol
+}
+
+// The debug layer is a transport that is placed right under the framing
+// layer and logs every framed request and response passed through it. It
+// doesn't change passed data in any way.
+type debugLayer struct {
+	transports.Transport
+
+	wb bytes.Buffer
+	rb bytes.Buffer
+
+	decoder *protocols.Decoder
+	logger  logger.Logger
+}
+
+// NewDebug creates a debug layer on top of the passed transport. A new debug
+// layer must be created for each new connection because decoding of messages
+// depends on the handshake state of the connection.
+func NewDebug(trans transports.Transport, config *DebugConfig) transports.Transport {
+	// The error is only related to compilations of Avro schemas and is not
+	// possible at runtime because it will be caught by unit tests.
+	decoder, _ := protocols.NewDecoder(config.Protocol)
+
+	return &debugLayer{
+		Transport: trans,
+		decoder:   decoder,
+		logger:    logger.OrNop(config.Logger),
+	}
+}
+
+func (d *debugLayer) Read(p []byte) (int, error) {
+	n, err := d.Transport.Read(p)
+	d.rb.Write(p[:n])
+	d.dump(&d.rb, false)
+	return n, err
+}
+
+func (d *debugLayer) Write(p []byte) (int, error) {
+	n, err := d.Transport.Write(p)
+	d.wb.Write(p[:n])
+	return n, err
+}
+
+func (d *debugLayer) Flush() error {
+	d.dump(&d.wb, true)
+	return d.Transport.Flush()
+}
+
+func (d *debugLayer) dump(buf *bytes.Buffer, request bool) {
+	for {
+		frames, n := ParseFrames(buf.Bytes())
+		if n == 0 {
+			return
+		}
+		buf.Next(n)
+
+		keysAndValues := []interface{}{
+			"serial", frames.Serial,
+			"frames", frames.Sizes,
+			"size", len(frames.Payload),
+			"dump", hex.Dump(frames.Payload),
+		}
+		if request {
+			keysAndValues = append(keysAndValues, d.decode(d.decoder.DecodeRequest(frames.Payload))...)
+			d.logger.Info("request sent", keysAndValues...)
+		} else {
+			keysAndValues = append(keysAndValues, d.decode(d.decoder.DecodeResponse(frames.Payload))...)
+			d.logger.Info("response received", keysAndValues...)
+		}
+	}
+}
+
+func (d *debugLayer) decode(m *protocols.Message, err error) []interface{} {
+	if err != nil {
+		return []interface{}{"decodeError", err}
+	}
+
+	var keysAndValues []interface{}
+	if m.Handshake != nil {
+		keysAndValues = append(keysAndValues, "handshake", m.Handshake)
+	}
+	if len(m.Meta) > 0 {
+		keysAndValues = append(keysAndValues, "meta", m.Meta)
+	}
+	if m.Method != "" {
+		keysAndValues = append(keysAndValues, "method", m.Method)
+	}
+	if m.Datum != nil {
+		keysAndValues = append(keysAndValues, "datum", m.Datum)
+	}
+	if m.Error != nil {
+		keysAndValues = append(keysAndValues, "error", m.Error)
+	}
+	if m.Rest != nil {
+		keysAndValues = append(keysAndValues, "rest", hex.EncodeToString(m.Rest))
+	}
+
+	return keysAndValues
+}
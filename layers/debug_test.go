@@ -0,0 +1,108 @@
+package layers_test
+
+import (
+	"bytes"
+	"log/slog"
+	"testing"
+
+	"github.com/myzhan/avroipc/logger"
+	"github.com/myzhan/avroipc/mocks"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/myzhan/avroipc/layers"
+)
+
+func TestParseFrames(t *testing.T) {
+	data := []byte{
+		// Serial
+		0x0, 0x0, 0x0, 0x3,
+		// Frame count
+		0x0, 0x0, 0x0, 0x2,
+		// Frame length
+		0x0, 0x0, 0x0, 0x2,
+		// Frame content
+		0x1, 0x2,
+		// Frame length
+		0x0, 0x0, 0x0, 0x1,
+		// Frame content
+		0x3,
+	}
+
+	t.Run("complete message", func(t *testing.T) {
+		f, n := layers.ParseFrames(append(data, 0x0, 0x0))
+		require.Equal(t, len(data), n)
+		require.Equal(t, &layers.Frames{Serial: 3, Sizes: []int{2, 1}, Payload: []byte{0x1, 0x2, 0x3}}, f)
+	})
+
+	t.Run("incomplete message", func(t *testing.T) {
+		for i := 0; i < len(data); i++ {
+			f, n := layers.ParseFrames(data[:i])
+			require.Equal(t, 0, n)
+			require.Nil(t, f)
+		}
+	})
+}
+
+func TestDebugLayer(t *testing.T) {
+	request := []byte{
+		// Serial
+		0x0, 0x0, 0x0, 0x1,
+		// Frame count
+		0x0, 0x0, 0x0, 0x1,
+		// Frame length
+		0x0, 0x0, 0x0, 0x2,
+		// Not a handshake request
+		0x0, 0x0,
+	}
+	response := []byte{
+		// Serial
+		0x0, 0x0, 0x0, 0x1,
+		// Frame count
+		0x0, 0x0, 0x0, 0x1,
+		// Frame length
+		0x0, 0x0, 0x0, 0x4,
+		// Handshake response
+		0x0, 0x0, 0x0, 0x0,
+	}
+
+	b := &bytes.Buffer{}
+	h := slog.NewTextHandler(b, &slog.HandlerOptions{
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey || a.Key == "dump" {
+				return slog.Attr{}
+			}
+			return a
+		},
+	})
+
+	m := &mocks.MockTransport{}
+	d := layers.NewDebug(m, &layers.DebugConfig{Logger: logger.NewSlog(slog.New(h))})
+
+	m.On("Write", request).Return(len(request), nil).Once()
+	m.On("Flush").Return(nil).Once()
+
+	n, err := d.Write(request)
+	require.NoError(t, err)
+	require.Equal(t, len(request), n)
+	require.Empty(t, b.String())
+
+	err = d.Flush()
+	require.NoError(t, err)
+	require.Contains(t, b.String(), `msg="request sent" serial=1 frames=[2] size=2 decodeError="cannot decode handshake request: `)
+
+	b.Reset()
+	for _, data := range [][]byte{response[:10], response[10:]} {
+		func(data []byte) {
+			m.On("Read", make([]byte, len(data))).Return(len(data), nil).Once().Run(func(args mock.Arguments) {
+				copy(args[0].([]byte), data)
+			})
+		}(data)
+
+		n, err = d.Read(make([]byte, len(data)))
+		require.NoError(t, err)
+		require.Equal(t, len(data), n)
+	}
+	require.Equal(t, "level=INFO msg=\"response received\" serial=1 frames=[4] size=4 handshake=\"map[match:BOTH meta:<nil> serverHash:<nil> serverProtocol:<nil>]\"\n", b.String())
+	m.AssertExpectations(t)
+}
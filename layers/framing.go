@@ -6,16 +6,66 @@ import (
 	"fmt"
 	"io"
 
+	"github.com/myzhan/avroipc/logger"
 	"github.com/myzhan/avroipc/transports"
 )
 
-const maxFrameSize = 10 * 1024
+// DefaultFrameSize is a size of outgoing frames that is used when the frame
+// size is not specified explicitly.
+const DefaultFrameSize = 10 * 1024
 
 type FramingLayer interface {
 	Read() ([]byte, error)
 	Write(p []byte) error
 }
 
+// FramingConfig provides a configuration for the framing layer.
+type FramingConfig struct {
+	// A maximum size of outgoing frames. Larger requests are split into
+	// several frames of this size.
+	//
+	// Defaults to zero which means that the DefaultFrameSize will be used.
+	FrameSize int
+
+	// A maximum number of frames in a single response accepted from a peer.
+	//
+	// Defaults to zero which means no limit.
+	MaxFrames int
+
+	// A maximum total size in bytes of all frames in a single response
+	// accepted from a peer.
+	//
+	// Defaults to zero which means no limit.
+	MaxResponseSize int
+
+	// Use the layer on the server side: accept requests with any serial and
+	// answer them with the serial of the last read request.
+	//
+	// Defaults to false which means the client side.
+	Server bool
+
+	// A logger for debug messages about read and written frames.
+	//
+	// Defaults to nil which means that messages are discarded.
+	Logger logger.Logger
+}
+
+// LimitError is returned when a response received from a peer exceeds one of
+// the limits of the FramingConfig. The check is done before allocating any
+// memory for the response data.
+type LimitError struct {
+	// A name of the exceeded limit: "frames" or "response size".
+	Limit string
+	// A value received from the peer.
+	Value uint64
+	// A configured maximum value.
+	Max uint64
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%s limit exceeded: %d > %d", e.Limit, e.Value, e.Max)
+}
+
 // Framing is a part on the Avro RPC protocol.
 // Framing just is a layer between messages and the transport, it isn't transport.
 type framingLayer struct {
@@ -24,17 +74,45 @@ type framingLayer struct {
 	trans transports.Transport
 
 	serial uint32
+	server bool
+
+	frameSize       int
+	maxFrames       uint64
+	maxResponseSize uint64
+
+	logger logger.Logger
 }
 
 func NewFraming(trans transports.Transport) FramingLayer {
-	return &framingLayer{
-		trans: trans,
+	return NewFramingWithConfig(trans, &FramingConfig{})
+}
+
+// NewFramingWithConfig creates a framing layer with considering values of
+// options from the passed configuration object.
+func NewFramingWithConfig(trans transports.Transport, config *FramingConfig) FramingLayer {
+	f := &framingLayer{
+		trans:     trans,
+		frameSize: DefaultFrameSize,
+		server:    config.Server,
+		logger:    logger.OrNop(config.Logger),
 	}
+	if config.FrameSize > 0 {
+		f.frameSize = config.FrameSize
+	}
+	if config.MaxFrames > 0 {
+		f.maxFrames = uint64(config.MaxFrames)
+	}
+	if config.MaxResponseSize > 0 {
+		f.maxResponseSize = uint64(config.MaxResponseSize)
+	}
+
+	return f
 }
 
 func (f *framingLayer) Read() ([]byte, error) {
 	err := f.readFrames()
 	if err != nil {
+		f.rb.Reset()
 		return nil, err
 	}
 
@@ -48,7 +126,9 @@ func (f *framingLayer) readFrames() error {
 	if err != nil {
 		return err
 	}
-	if f.serial != serial {
+	if f.server {
+		f.serial = serial
+	} else if f.serial != serial {
 		return fmt.Errorf("bad serial: %d != %d", f.serial, serial)
 	}
 
@@ -56,13 +136,22 @@ func (f *framingLayer) readFrames() error {
 	if err != nil {
 		return err
 	}
+	if f.maxFrames > 0 && uint64(frames) > f.maxFrames {
+		return &LimitError{Limit: "frames", Value: uint64(frames), Max: f.maxFrames}
+	}
 
+	total := uint64(0)
 	for i := uint32(0); i < frames; i++ {
 		size, err := f.readUint32()
 		if err != nil {
 			return err
 		}
 
+		total += uint64(size)
+		if f.maxResponseSize > 0 && total > f.maxResponseSize {
+			return &LimitError{Limit: "response size", Value: total, Max: f.maxResponseSize}
+		}
+
 		frame := make([]byte, int(size))
 		_, err = io.ReadFull(f.trans, frame)
 		if err != nil {
@@ -71,6 +160,8 @@ func (f *framingLayer) readFrames() error {
 		f.rb.Write(frame)
 	}
 
+	f.logger.Debug("frames read", "serial", serial, "frames", frames, "size", total)
+
 	return nil
 }
 
@@ -85,9 +176,12 @@ func (f *framingLayer) readUint32() (uint32, error) {
 }
 
 func (f *framingLayer) Write(p []byte) error {
-	f.serial++
+	if !f.server {
+		f.serial++
+	}
 
-	if len(p) > 0 {
+	// Servers must answer every request even with an empty response.
+	if len(p) > 0 || f.server {
 		err := f.writeFrames(p)
 		if err != nil {
 			return err
@@ -99,7 +193,7 @@ func (f *framingLayer) Write(p []byte) error {
 
 func (f *framingLayer) writeFrames(p []byte) (err error) {
 	bufLen := len(p)
-	frames := (bufLen-1)/maxFrameSize + 1
+	frames := (bufLen-1)/f.frameSize + 1
 
 	err = binary.Write(f.trans, binary.BigEndian, f.serial)
 	if err != nil {
@@ -110,17 +204,17 @@ func (f *framingLayer) writeFrames(p []byte) (err error) {
 		return
 	}
 
-	for len(p) >= maxFrameSize {
-		err = binary.Write(f.trans, binary.BigEndian, uint32(maxFrameSize))
+	for len(p) > f.frameSize {
+		err = binary.Write(f.trans, binary.BigEndian, uint32(f.frameSize))
 		if err != nil {
 			return
 		}
 
-		_, err = f.trans.Write(p[:maxFrameSize])
+		_, err = f.trans.Write(p[:f.frameSize])
 		if err != nil {
 			return
 		}
-		p = p[maxFrameSize:]
+		p = p[f.frameSize:]
 	}
 
 	err = binary.Write(f.trans, binary.BigEndian, uint32(len(p)))
@@ -133,5 +227,7 @@ func (f *framingLayer) writeFrames(p []byte) (err error) {
 		return
 	}
 
+	f.logger.Debug("frames written", "serial", f.serial, "frames", frames, "size", bufLen)
+
 	return
 }
@@ -19,6 +19,13 @@ func prepareFramingLayer() (layers.FramingLayer, *mocks.MockTransport) {
 	return f, m
 }
 
+func prepareFramingLayerWithConfig(config *layers.FramingConfig) (layers.FramingLayer, *mocks.MockTransport) {
+	m := &mocks.MockTransport{}
+	f := layers.NewFramingWithConfig(m, config)
+
+	return f, m
+}
+
 func TestFramingLayer_Read(t *testing.T) {
 	t.Run("no bytes", func(t *testing.T) {
 		f, m := prepareFramingLayer()
@@ -94,6 +101,104 @@ func TestFramingLayer_Read(t *testing.T) {
 		m.AssertExpectations(t)
 	})
 
+	t.Run("too many frames", func(t *testing.T) {
+		f, m := prepareFramingLayerWithConfig(&layers.FramingConfig{MaxFrames: 2})
+
+		for _, d := range [][]byte{
+			// Serial
+			{0x0, 0x0, 0x0, 0x0},
+			// Frame count
+			{0xf, 0xf, 0xf, 0xf},
+		} {
+			func(data []byte) {
+				m.On("Read", make([]byte, len(data))).Return(len(data), nil).Once().Run(func(args mock.Arguments) {
+					copy(args[0].([]byte), data)
+				})
+			}(d)
+		}
+
+		a, err := f.Read()
+		require.EqualError(t, err, "frames limit exceeded: 252645135 > 2")
+		require.IsType(t, &layers.LimitError{}, err)
+		require.Nil(t, a)
+		m.AssertExpectations(t)
+	})
+
+	t.Run("response too large", func(t *testing.T) {
+		f, m := prepareFramingLayerWithConfig(&layers.FramingConfig{MaxResponseSize: 6})
+
+		for _, d := range [][]byte{
+			// Serial
+			{0x0, 0x0, 0x0, 0x0},
+			// Frame count
+			{0x0, 0x0, 0x0, 0x2},
+			// Frame length
+			{0x0, 0x0, 0x0, 0x4},
+			// Frame content
+			{0x1, 0x2, 0x3, 0x4},
+			// Frame length
+			{0x0, 0x0, 0x0, 0x4},
+		} {
+			func(data []byte) {
+				m.On("Read", make([]byte, len(data))).Return(len(data), nil).Once().Run(func(args mock.Arguments) {
+					copy(args[0].([]byte), data)
+				})
+			}(d)
+		}
+
+		a, err := f.Read()
+		require.EqualError(t, err, "response size limit exceeded: 8 > 6")
+		require.IsType(t, &layers.LimitError{}, err)
+		require.Nil(t, a)
+		m.AssertExpectations(t)
+	})
+
+	t.Run("server side", func(t *testing.T) {
+		f, m := prepareFramingLayerWithConfig(&layers.FramingConfig{Server: true})
+
+		for _, d := range [][]byte{
+			// Serial
+			{0x0, 0x0, 0x0, 0xa},
+			// Frame count
+			{0x0, 0x0, 0x0, 0x1},
+			// Frame length
+			{0x0, 0x0, 0x0, 0x1},
+			// Frame content
+			{0x1},
+		} {
+			func(data []byte) {
+				m.On("Read", make([]byte, len(data))).Return(len(data), nil).Once().Run(func(args mock.Arguments) {
+					copy(args[0].([]byte), data)
+				})
+			}(d)
+		}
+
+		a := bytes.Buffer{}
+		m.On("Write", mock.Anything).Return(0, nil).Times(4).Run(func(args mock.Arguments) {
+			_, err := a.Write(args[0].([]byte))
+			require.NoError(t, err)
+		})
+
+		r, err := f.Read()
+		require.NoError(t, err)
+		require.Equal(t, []byte{0x1}, r)
+
+		// Empty responses are written as well.
+		err = f.Write(nil)
+		require.NoError(t, err)
+
+		e := []byte{
+			// Serial of the request
+			0x0, 0x0, 0x0, 0xa,
+			// Frame count
+			0x0, 0x0, 0x0, 0x1,
+			// Frame length
+			0x0, 0x0, 0x0, 0x0,
+		}
+		require.Equal(t, e, a.Bytes())
+		m.AssertExpectations(t)
+	})
+
 	t.Run("transport error", func(t *testing.T) {
 		f, m := prepareFramingLayer()
 
@@ -172,6 +277,70 @@ func TestFramingLayer_Write(t *testing.T) {
 		m.AssertExpectations(t)
 	})
 
+	t.Run("custom frame size", func(t *testing.T) {
+		d := []byte{0x1, 0x2, 0x3, 0x4, 0x5}
+		f, m := prepareFramingLayerWithConfig(&layers.FramingConfig{FrameSize: 2})
+
+		a := bytes.Buffer{}
+		m.On("Write", mock.Anything).Return(0, nil).Times(8).Run(func(args mock.Arguments) {
+			_, err := a.Write(args[0].([]byte))
+			require.NoError(t, err)
+		})
+
+		e := []byte{
+			// Serial
+			0x0, 0x0, 0x0, 0x1,
+			// Frame count
+			0x0, 0x0, 0x0, 0x3,
+			// Frame length
+			0x0, 0x0, 0x0, 0x2,
+			// Frame content
+			0x1, 0x2,
+			// Frame length
+			0x0, 0x0, 0x0, 0x2,
+			// Frame content
+			0x3, 0x4,
+			// Frame length
+			0x0, 0x0, 0x0, 0x1,
+			// Frame content
+			0x5,
+		}
+		err := f.Write(d)
+		require.NoError(t, err)
+		require.Equal(t, e, a.Bytes())
+		m.AssertExpectations(t)
+	})
+
+	t.Run("exact multiple of frame size", func(t *testing.T) {
+		d := []byte{0x1, 0x2, 0x3, 0x4}
+		f, m := prepareFramingLayerWithConfig(&layers.FramingConfig{FrameSize: 2})
+
+		a := bytes.Buffer{}
+		m.On("Write", mock.Anything).Return(0, nil).Times(6).Run(func(args mock.Arguments) {
+			_, err := a.Write(args[0].([]byte))
+			require.NoError(t, err)
+		})
+
+		e := []byte{
+			// Serial
+			0x0, 0x0, 0x0, 0x1,
+			// Frame count
+			0x0, 0x0, 0x0, 0x2,
+			// Frame length
+			0x0, 0x0, 0x0, 0x2,
+			// Frame content
+			0x1, 0x2,
+			// Frame length
+			0x0, 0x0, 0x0, 0x2,
+			// Frame content
+			0x3, 0x4,
+		}
+		err := f.Write(d)
+		require.NoError(t, err)
+		require.Equal(t, e, a.Bytes())
+		m.AssertExpectations(t)
+	})
+
 	t.Run("frame serial", func(t *testing.T) {
 		d := []byte{0x1, 0x2, 0x3, 0x4}
 		f, m := prepareFramingLayer()
@@ -0,0 +1,75 @@
+// Package logger defines a minimal structured logging interface that is used
+// by all components of the library instead of a particular logging library.
+//
+// There are adapters for the log/slog package in this package and for the
+// logrus and zap libraries in the logruslogger and zaplogger subpackages.
+package logger
+
+import (
+	"context"
+	"log/slog"
+)
+
+// Logger is a structured logger. Each logging method accepts a message and
+// an optional list of alternating keys and values.
+type Logger interface {
+	Debug(msg string, keysAndValues ...interface{})
+	Info(msg string, keysAndValues ...interface{})
+	Warn(msg string, keysAndValues ...interface{})
+	Error(msg string, keysAndValues ...interface{})
+
+	// With returns a logger that adds the passed keys and values to all
+	// messages.
+	With(keysAndValues ...interface{}) Logger
+}
+
+type nop struct{}
+
+// NewNop returns a logger that discards all messages. It is used by default
+// everywhere in the library.
+func NewNop() Logger {
+	return nop{}
+}
+
+func (nop) Debug(string, ...interface{}) {}
+func (nop) Info(string, ...interface{})  {}
+func (nop) Warn(string, ...interface{})  {}
+func (nop) Error(string, ...interface{}) {}
+func (l nop) With(...interface{}) Logger { return l }
+
+// OrNop returns the passed logger or a no-op logger if it is nil.
+func OrNop(l Logger) Logger {
+	if l == nil {
+		return NewNop()
+	}
+	return l
+}
+
+type slogLogger struct {
+	l *slog.Logger
+}
+
+// NewSlog returns a logger that writes messages to the passed slog logger.
+func NewSlog(l *slog.Logger) Logger {
+	return &slogLogger{l: l}
+}
+
+func (s *slogLogger) Debug(msg string, keysAndValues ...interface{}) {
+	s.l.Log(context.Background(), slog.LevelDebug, msg, keysAndValues...)
+}
+
+func (s *slogLogger) Info(msg string, keysAndValues ...interface{}) {
+	s.l.Log(context.Background(), slog.LevelInfo, msg, keysAndValues...)
+}
+
+func (s *slogLogger) Warn(msg string, keysAndValues ...interface{}) {
+	s.l.Log(context.Background(), slog.LevelWarn, msg, keysAndValues...)
+}
+
+func (s *slogLogger) Error(msg string, keysAndValues ...interface{}) {
+	s.l.Log(context.Background(), slog.LevelError, msg, keysAndValues...)
+}
+
+func (s *slogLogger) With(keysAndValues ...interface{}) Logger {
+	return &slogLogger{l: s.l.With(keysAndValues...)}
+}
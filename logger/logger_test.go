@@ -0,0 +1,46 @@
+package logger_test
+
+import (
+	"bytes"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/myzhan/avroipc/logger"
+)
+
+func TestNop(t *testing.T) {
+	l := logger.NewNop()
+	l.Debug("test")
+	l.With("key", "value").Error("test")
+
+	require.NotNil(t, logger.OrNop(nil))
+	require.Equal(t, l, logger.OrNop(l))
+}
+
+func TestSlog(t *testing.T) {
+	b := &bytes.Buffer{}
+	h := slog.NewTextHandler(b, &slog.HandlerOptions{
+		Level: slog.LevelDebug,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return a
+		},
+	})
+	l := logger.NewSlog(slog.New(h)).With("name", "test")
+
+	l.Debug("debug message", "key", 1)
+	l.Info("info message")
+	l.Warn("warn message")
+	l.Error("error message", "error", "test error")
+
+	expected := `level=DEBUG msg="debug message" name=test key=1
+level=INFO msg="info message" name=test
+level=WARN msg="warn message" name=test
+level=ERROR msg="error message" name=test error="test error"
+`
+	require.Equal(t, expected, b.String())
+}
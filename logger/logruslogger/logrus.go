@@ -0,0 +1,63 @@
+// Package logruslogger provides an adapter of the logrus library to the
+// logger.Logger interface.
+package logruslogger
+
+import (
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/myzhan/avroipc/logger"
+)
+
+type logrusLogger struct {
+	l logrus.FieldLogger
+}
+
+// New returns a logger that writes messages to the passed logrus logger or
+// entry. Keys and values are converted to logrus fields.
+func New(l logrus.FieldLogger) logger.Logger {
+	return &logrusLogger{l: l}
+}
+
+func (x *logrusLogger) Debug(msg string, keysAndValues ...interface{}) {
+	x.entry(keysAndValues).Debug(msg)
+}
+
+func (x *logrusLogger) Info(msg string, keysAndValues ...interface{}) {
+	x.entry(keysAndValues).Info(msg)
+}
+
+func (x *logrusLogger) Warn(msg string, keysAndValues ...interface{}) {
+	x.entry(keysAndValues).Warn(msg)
+}
+
+func (x *logrusLogger) Error(msg string, keysAndValues ...interface{}) {
+	x.entry(keysAndValues).Error(msg)
+}
+
+func (x *logrusLogger) With(keysAndValues ...interface{}) logger.Logger {
+	return &logrusLogger{l: x.entry(keysAndValues)}
+}
+
+func (x *logrusLogger) entry(keysAndValues []interface{}) logrus.FieldLogger {
+	if len(keysAndValues) == 0 {
+		return x.l
+	}
+
+	return x.l.WithFields(fields(keysAndValues))
+}
+
+func fields(keysAndValues []interface{}) logrus.Fields {
+	f := make(logrus.Fields, (len(keysAndValues)+1)/2)
+	for i := 0; i < len(keysAndValues); i += 2 {
+		key := fmt.Sprint(keysAndValues[i])
+		if i+1 < len(keysAndValues) {
+			f[key] = keysAndValues[i+1]
+		} else {
+			f[key] = nil
+		}
+	}
+
+	return f
+}
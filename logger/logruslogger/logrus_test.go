@@ -0,0 +1,38 @@
+package logruslogger_test
+
+import (
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/require"
+
+	"github.com/myzhan/avroipc/logger/logruslogger"
+)
+
+func TestLogger(t *testing.T) {
+	x, hook := test.NewNullLogger()
+	x.SetLevel(logrus.DebugLevel)
+
+	l := logruslogger.New(x).With("name", "test")
+
+	l.Debug("debug message", "key", 1)
+	l.Info("info message")
+	l.Warn("warn message", "odd")
+	l.Error("error message")
+
+	entries := hook.AllEntries()
+	require.Len(t, entries, 4)
+
+	require.Equal(t, logrus.DebugLevel, entries[0].Level)
+	require.Equal(t, "debug message", entries[0].Message)
+	require.Equal(t, logrus.Fields{"name": "test", "key": 1}, entries[0].Data)
+
+	require.Equal(t, logrus.InfoLevel, entries[1].Level)
+	require.Equal(t, logrus.Fields{"name": "test"}, entries[1].Data)
+
+	require.Equal(t, logrus.WarnLevel, entries[2].Level)
+	require.Equal(t, logrus.Fields{"name": "test", "odd": nil}, entries[2].Data)
+
+	require.Equal(t, logrus.ErrorLevel, entries[3].Level)
+}
@@ -0,0 +1,38 @@
+// Package zaplogger provides an adapter of the zap library to the
+// logger.Logger interface.
+package zaplogger
+
+import (
+	"go.uber.org/zap"
+
+	"github.com/myzhan/avroipc/logger"
+)
+
+type zapLogger struct {
+	l *zap.SugaredLogger
+}
+
+// New returns a logger that writes messages to the passed zap logger.
+func New(l *zap.Logger) logger.Logger {
+	return &zapLogger{l: l.WithOptions(zap.AddCallerSkip(1)).Sugar()}
+}
+
+func (z *zapLogger) Debug(msg string, keysAndValues ...interface{}) {
+	z.l.Debugw(msg, keysAndValues...)
+}
+
+func (z *zapLogger) Info(msg string, keysAndValues ...interface{}) {
+	z.l.Infow(msg, keysAndValues...)
+}
+
+func (z *zapLogger) Warn(msg string, keysAndValues ...interface{}) {
+	z.l.Warnw(msg, keysAndValues...)
+}
+
+func (z *zapLogger) Error(msg string, keysAndValues ...interface{}) {
+	z.l.Errorw(msg, keysAndValues...)
+}
+
+func (z *zapLogger) With(keysAndValues ...interface{}) logger.Logger {
+	return &zapLogger{l: z.l.With(keysAndValues...)}
+}
@@ -0,0 +1,34 @@
+package zaplogger_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/myzhan/avroipc/logger/zaplogger"
+)
+
+func TestLogger(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	l := zaplogger.New(zap.New(core)).With("name", "test")
+
+	l.Debug("debug message", "key", 1)
+	l.Info("info message")
+	l.Warn("warn message")
+	l.Error("error message")
+
+	entries := logs.AllUntimed()
+	require.Len(t, entries, 4)
+
+	require.Equal(t, zapcore.DebugLevel, entries[0].Level)
+	require.Equal(t, "debug message", entries[0].Message)
+	require.Equal(t, map[string]interface{}{"name": "test", "key": int64(1)}, entries[0].ContextMap())
+
+	require.Equal(t, zapcore.InfoLevel, entries[1].Level)
+	require.Equal(t, zapcore.WarnLevel, entries[2].Level)
+	require.Equal(t, zapcore.ErrorLevel, entries[3].Level)
+	require.Equal(t, map[string]interface{}{"name": "test"}, entries[3].ContextMap())
+}
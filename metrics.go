@@ -0,0 +1,35 @@
+package avroipc
+
+import (
+	"time"
+)
+
+// Metrics is an interface of collectors of client metrics. Implementations
+// must be safe for concurrent use because a single collector may be shared
+// between several clients.
+//
+// See the prometheus subpackage for an implementation based on the
+// Prometheus client library.
+type Metrics interface {
+	// ObserveCall is called after each message with its total duration
+	// including retries and the result error if any.
+	ObserveCall(method string, duration time.Duration, err error)
+
+	// ObserveRequestSize is called after sending each request with the size
+	// of the serialized request and the number of bytes written to the
+	// network, i.e. after compression and encryption.
+	ObserveRequestSize(method string, size, wireSize int)
+
+	// ObserveResponseSize is called after receiving each response with the
+	// size of the serialized response and the number of bytes read from the
+	// network.
+	ObserveResponseSize(method string, size, wireSize int)
+
+	// ObserveHandshake is called after each handshake response with its
+	// match field: BOTH, CLIENT or NONE.
+	ObserveHandshake(match string)
+
+	// ObserveReconnect is called after each attempt to reestablish a broken
+	// connection with the result error if any.
+	ObserveReconnect(err error)
+}
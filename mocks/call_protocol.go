@@ -11,6 +11,11 @@ func (p *MockCallProtocol) PrepareRequest(method string, datum interface{}) ([]b
 	return args.Get(0).([]byte), args.Error(1)
 }
 
+func (p *MockCallProtocol) PrepareRequestWithMeta(method string, meta map[string][]byte, datum interface{}) ([]byte, error) {
+	args := p.Called(method, meta, datum)
+	return args.Get(0).([]byte), args.Error(1)
+}
+
 func (p *MockCallProtocol) ParseResponse(method string, responseBytes []byte) (interface{}, error) {
 	args := p.Called(method, responseBytes)
 	return args.Get(0), args.Error(1)
@@ -25,3 +25,22 @@ func (p *MockProtocol) GetSchema() string {
 	args := p.Called()
 	return args.String(0)
 }
+
+type MockServerProtocol struct {
+	MockProtocol
+}
+
+func (p *MockServerProtocol) ParseRequest(method string, requestBytes []byte) (interface{}, []byte, error) {
+	args := p.Called(method, requestBytes)
+	return args.Get(0), args.Get(1).([]byte), args.Error(2)
+}
+
+func (p *MockServerProtocol) PrepareResponse(method string, datum interface{}) ([]byte, error) {
+	args := p.Called(method, datum)
+	return args.Get(0).([]byte), args.Error(1)
+}
+
+func (p *MockServerProtocol) PrepareError(method string, err error) ([]byte, error) {
+	args := p.Called(method, err)
+	return args.Get(0).([]byte), args.Error(1)
+}
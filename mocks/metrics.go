@@ -0,0 +1,31 @@
+package mocks
+
+import (
+	"time"
+
+	"github.com/stretchr/testify/mock"
+)
+
+type MockMetrics struct {
+	mock.Mock
+}
+
+func (m *MockMetrics) ObserveCall(method string, duration time.Duration, err error) {
+	m.Called(method, duration, err)
+}
+
+func (m *MockMetrics) ObserveRequestSize(method string, size, wireSize int) {
+	m.Called(method, size, wireSize)
+}
+
+func (m *MockMetrics) ObserveResponseSize(method string, size, wireSize int) {
+	m.Called(method, size, wireSize)
+}
+
+func (m *MockMetrics) ObserveHandshake(match string) {
+	m.Called(match)
+}
+
+func (m *MockMetrics) ObserveReconnect(err error) {
+	m.Called(err)
+}
@@ -0,0 +1,172 @@
+package avroipc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+
+	"github.com/myzhan/avroipc/logger"
+	"github.com/myzhan/avroipc/protocols"
+)
+
+// ProbeResult is a result of a handshake performed by the Probe function.
+type ProbeResult struct {
+	// A match of the first handshake response, i.e. whether the server knows
+	// the client protocol by its hash. It differs from the Match if the
+	// handshake is repeated with the client protocol.
+	InitialMatch string
+	// A match of the last handshake response as seen by clients: BOTH if
+	// the server accepts the client protocol and the client knows the server
+	// protocol, CLIENT if the server accepts the client protocol but the
+	// client doesn't know the server one and NONE if the server doesn't
+	// accept the client protocol. The match doesn't show whether protocols
+	// are equal, use the Diff method for that.
+	Match string
+	// Whether the handshake is repeated with the client protocol because the
+	// server doesn't know it, like clients do.
+	ClientProtocolSent bool
+	// Hashes of client and server protocols.
+	ClientHash []byte
+	ServerHash []byte
+	// Declarations of client and server protocols.
+	ClientProtocol string
+	ServerProtocol string
+}
+
+// Diff returns a line-based diff between the client and the server protocols
+// or an empty string if they are equal. Protocols in the JSON format are
+// indented before comparing to produce readable diffs.
+func (r *ProbeResult) Diff() string {
+	return diffLines(indentJSON(r.ClientProtocol), indentJSON(r.ServerProtocol), "client", "server")
+}
+
+// Probe connects to the server, performs a handshake without sending any
+// messages and returns the handshake result. The handshake request is sent
+// again with the client protocol if the server responds with the NONE match.
+// The RetryPolicy, PingInterval and Metrics options of the config are not
+// used.
+func Probe(addr string, proto protocols.MessageProtocol, config *Config) (*ProbeResult, error) {
+	c := &client{
+		addr:   addr,
+		proto:  proto,
+		config: config,
+	}
+	c.sendTimeout = config.SendTimeout
+	c.logger = logger.OrNop(config.Logger).With("addr", addr)
+	c.initDebug(config)
+	c.initTracing(config)
+
+	err := c.initTransports(addr, config)
+	if err != nil {
+		return nil, err
+	}
+	defer c.transport.Close()
+	c.initProtocols(proto, config)
+
+	schema := proto.GetSchema()
+	r := &ProbeResult{
+		ClientHash:     protocols.ProtocolHash(schema),
+		ClientProtocol: schema,
+	}
+
+	for {
+		request, err := c.handshakeProtocol.PrepareRequest()
+		if err != nil {
+			return nil, err
+		}
+		responseBytes, err := c.send(context.Background(), request)
+		if err != nil {
+			return nil, err
+		}
+
+		response, _, err := protocols.ParseHandshakeResponse(responseBytes)
+		if err != nil {
+			return nil, err
+		}
+		if r.InitialMatch == "" {
+			r.InitialMatch = response.Match
+		}
+		r.Match = response.Match
+		// The server protocol is not sent again if the match of the repeated
+		// handshake is BOTH.
+		if response.ServerHash != nil {
+			r.ServerHash = response.ServerHash
+		}
+		if response.ServerProtocol != "" {
+			r.ServerProtocol = response.ServerProtocol
+		}
+
+		if r.Match != "NONE" || r.ClientProtocolSent {
+			break
+		}
+		// Prepare the handshake protocol to send the client protocol.
+		_, err = c.handshakeProtocol.ProcessResponse(responseBytes)
+		if err != nil {
+			return nil, err
+		}
+		r.ClientProtocolSent = true
+	}
+
+	if r.ServerHash == nil {
+		r.ServerHash = r.ClientHash
+		r.ServerProtocol = r.ClientProtocol
+	}
+
+	return r, nil
+}
+
+func indentJSON(s string) string {
+	var buf bytes.Buffer
+	if json.Indent(&buf, []byte(s), "", "  ") != nil {
+		return s
+	}
+	return buf.String()
+}
+
+// diffLines returns a unified-like diff of all lines of the texts based on
+// their longest common subsequence.
+func diffLines(a, b, aName, bName string) string {
+	if a == b {
+		return ""
+	}
+
+	x := strings.Split(a, "\n")
+	y := strings.Split(b, "\n")
+
+	// lcs[i][j] is the length of the longest common subsequence of x[i:]
+	// and y[j:].
+	lcs := make([][]int, len(x)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var sb strings.Builder
+	sb.WriteString("--- " + aName + "\n+++ " + bName + "\n")
+	i, j := 0, 0
+	for i < len(x) || j < len(y) {
+		switch {
+		case i < len(x) && j < len(y) && x[i] == y[j]:
+			sb.WriteString(" " + x[i] + "\n")
+			i++
+			j++
+		case i < len(x) && (j == len(y) || lcs[i+1][j] >= lcs[i][j+1]):
+			sb.WriteString("-" + x[i] + "\n")
+			i++
+		default:
+			sb.WriteString("+" + y[j] + "\n")
+			j++
+		}
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,82 @@
+package avroipc_test
+
+import (
+	"crypto/md5"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/myzhan/avroipc"
+	"github.com/myzhan/avroipc/protocols"
+)
+
+func prepareProtocol(t *testing.T, avpr string) *protocols.Protocol {
+	proto, err := protocols.ParseProtocol(avpr)
+	require.NoError(t, err)
+
+	return proto
+}
+
+func TestProbe(t *testing.T) {
+	clientAvpr := `{"protocol": "P", "messages": {"m": {"request": [], "response": "string"}}}`
+	serverAvpr := `{"protocol": "P", "messages": {"m": {"request": [], "response": "int"}}}`
+	clientHash := md5.Sum([]byte(clientAvpr))
+	serverHash := md5.Sum([]byte(serverAvpr))
+
+	handler := func(string, interface{}) (interface{}, error) {
+		return nil, nil
+	}
+
+	t.Run("same protocol", func(t *testing.T) {
+		proto := prepareProtocol(t, clientAvpr)
+		config := avroipc.NewConfig().WithDialer(avroipc.LoopbackDialer(proto, handler))
+
+		r, err := avroipc.Probe("", proto, config)
+		require.NoError(t, err)
+		require.Equal(t, &avroipc.ProbeResult{
+			InitialMatch:   "BOTH",
+			Match:          "BOTH",
+			ClientHash:     clientHash[:],
+			ServerHash:     clientHash[:],
+			ClientProtocol: clientAvpr,
+			ServerProtocol: clientAvpr,
+		}, r)
+		require.Empty(t, r.Diff())
+	})
+
+	t.Run("different protocol", func(t *testing.T) {
+		proto := prepareProtocol(t, clientAvpr)
+		config := avroipc.NewConfig().WithDialer(avroipc.LoopbackDialer(prepareProtocol(t, serverAvpr), handler))
+
+		r, err := avroipc.Probe("", proto, config)
+		require.NoError(t, err)
+		// The server learns the client protocol from the repeated handshake.
+		require.Equal(t, &avroipc.ProbeResult{
+			InitialMatch:       "NONE",
+			Match:              "BOTH",
+			ClientProtocolSent: true,
+			ClientHash:         clientHash[:],
+			ServerHash:         serverHash[:],
+			ClientProtocol:     clientAvpr,
+			ServerProtocol:     serverAvpr,
+		}, r)
+		require.Equal(t, `--- client
++++ server
+ {
+   "protocol": "P",
+   "messages": {
+     "m": {
+       "request": [],
+-      "response": "string"
++      "response": "int"
+     }
+   }
+ }
+`, r.Diff())
+	})
+
+	t.Run("bad address", func(t *testing.T) {
+		_, err := avroipc.Probe("1:2:3", prepareProtocol(t, clientAvpr), avroipc.NewConfig())
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,141 @@
+// Package prometheus provides an implementation of the avroipc.Metrics
+// interface based on the Prometheus client library.
+package prometheus
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/myzhan/avroipc"
+)
+
+// Metrics collects metrics of avroipc clients. It implements both the
+// avroipc.Metrics and the prometheus.Collector interfaces, so it should be
+// registered in a Prometheus registry to export metrics.
+//
+//	m := prometheus.NewMetrics("myapp")
+//	registry.MustRegister(m)
+//	client, err := flume.NewClientWithConfig(addr, avroipc.NewConfig().WithMetrics(m))
+type Metrics struct {
+	calls         *prometheus.CounterVec
+	errors        *prometheus.CounterVec
+	durations     *prometheus.HistogramVec
+	requestSizes  *prometheus.HistogramVec
+	responseSizes *prometheus.HistogramVec
+	handshakes    *prometheus.CounterVec
+	reconnects    *prometheus.CounterVec
+}
+
+var _ avroipc.Metrics = new(Metrics)
+var _ prometheus.Collector = new(Metrics)
+
+// NewMetrics creates a collector with metric names prefixed by the namespace
+// and the "avroipc" subsystem.
+func NewMetrics(namespace string) *Metrics {
+	const subsystem = "avroipc"
+
+	sizeBuckets := prometheus.ExponentialBuckets(64, 4, 8)
+
+	return &Metrics{
+		calls: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "calls_total",
+			Help:      "Total number of sent messages.",
+		}, []string{"method"}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "errors_total",
+			Help:      "Total number of failed messages by error type.",
+		}, []string{"method", "type"}),
+		durations: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "call_duration_seconds",
+			Help:      "Duration of messages including retries.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method"}),
+		requestSizes: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "request_size_bytes",
+			Help:      "Size of requests before (raw) and after (wire) compression.",
+			Buckets:   sizeBuckets,
+		}, []string{"method", "stage"}),
+		responseSizes: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "response_size_bytes",
+			Help:      "Size of responses before (wire) and after (raw) decompression.",
+			Buckets:   sizeBuckets,
+		}, []string{"method", "stage"}),
+		handshakes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "handshakes_total",
+			Help:      "Total number of handshake responses by match.",
+		}, []string{"match"}),
+		reconnects: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "reconnects_total",
+			Help:      "Total number of reconnection attempts by result.",
+		}, []string{"result"}),
+	}
+}
+
+func (m *Metrics) ObserveCall(method string, duration time.Duration, err error) {
+	m.calls.WithLabelValues(method).Inc()
+	m.durations.WithLabelValues(method).Observe(duration.Seconds())
+	if err != nil {
+		m.errors.WithLabelValues(method, avroipc.ErrorType(err)).Inc()
+	}
+}
+
+func (m *Metrics) ObserveRequestSize(method string, size, wireSize int) {
+	m.requestSizes.WithLabelValues(method, "raw").Observe(float64(size))
+	m.requestSizes.WithLabelValues(method, "wire").Observe(float64(wireSize))
+}
+
+func (m *Metrics) ObserveResponseSize(method string, size, wireSize int) {
+	m.responseSizes.WithLabelValues(method, "raw").Observe(float64(size))
+	m.responseSizes.WithLabelValues(method, "wire").Observe(float64(wireSize))
+}
+
+func (m *Metrics) ObserveHandshake(match string) {
+	m.handshakes.WithLabelValues(match).Inc()
+}
+
+func (m *Metrics) ObserveReconnect(err error) {
+	if err != nil {
+		m.reconnects.WithLabelValues("error").Inc()
+	} else {
+		m.reconnects.WithLabelValues("ok").Inc()
+	}
+}
+
+func (m *Metrics) Describe(ch chan<- *prometheus.Desc) {
+	for _, c := range m.collectors() {
+		c.Describe(ch)
+	}
+}
+
+func (m *Metrics) Collect(ch chan<- prometheus.Metric) {
+	for _, c := range m.collectors() {
+		c.Collect(ch)
+	}
+}
+
+func (m *Metrics) collectors() []prometheus.Collector {
+	return []prometheus.Collector{
+		m.calls,
+		m.errors,
+		m.durations,
+		m.requestSizes,
+		m.responseSizes,
+		m.handshakes,
+		m.reconnects,
+	}
+}
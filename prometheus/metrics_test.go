@@ -0,0 +1,53 @@
+package prometheus_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+
+	"github.com/myzhan/avroipc"
+	"github.com/myzhan/avroipc/prometheus"
+)
+
+func TestMetrics(t *testing.T) {
+	m := prometheus.NewMetrics("test")
+
+	m.ObserveCall("append", time.Second, nil)
+	m.ObserveCall("append", time.Second, &avroipc.TransportError{Err: errors.New("test error")})
+	m.ObserveRequestSize("append", 100, 50)
+	m.ObserveResponseSize("append", 10, 20)
+	m.ObserveHandshake("NONE")
+	m.ObserveHandshake("BOTH")
+	m.ObserveReconnect(nil)
+	m.ObserveReconnect(errors.New("test error"))
+
+	expected := `
+# HELP test_avroipc_calls_total Total number of sent messages.
+# TYPE test_avroipc_calls_total counter
+test_avroipc_calls_total{method="append"} 2
+# HELP test_avroipc_errors_total Total number of failed messages by error type.
+# TYPE test_avroipc_errors_total counter
+test_avroipc_errors_total{method="append",type="transport"} 1
+# HELP test_avroipc_handshakes_total Total number of handshake responses by match.
+# TYPE test_avroipc_handshakes_total counter
+test_avroipc_handshakes_total{match="BOTH"} 1
+test_avroipc_handshakes_total{match="NONE"} 1
+# HELP test_avroipc_reconnects_total Total number of reconnection attempts by result.
+# TYPE test_avroipc_reconnects_total counter
+test_avroipc_reconnects_total{result="error"} 1
+test_avroipc_reconnects_total{result="ok"} 1
+`
+	err := testutil.CollectAndCompare(m, strings.NewReader(expected),
+		"test_avroipc_calls_total",
+		"test_avroipc_errors_total",
+		"test_avroipc_handshakes_total",
+		"test_avroipc_reconnects_total",
+	)
+	require.NoError(t, err)
+
+	require.Equal(t, 11, testutil.CollectAndCount(m))
+}
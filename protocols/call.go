@@ -12,6 +12,15 @@ type CallProtocol interface {
 	ParseResponse(method string, responseBytes []byte) (interface{}, error)
 }
 
+// MetaCallProtocol is an optional interface of call protocols that are able
+// to send call metadata, e.g. to propagate trace contexts. The call protocol
+// returned by NewCall implements it.
+type MetaCallProtocol interface {
+	// PrepareRequestWithMeta prepares a request for the method with the
+	// passed call metadata that may be nil.
+	PrepareRequestWithMeta(method string, meta map[string][]byte, datum interface{}) ([]byte, error)
+}
+
 // The Avro Call format implementation for the Avro RPC protocol.
 //
 // It is used for preparing an Avro RPC request and parsing an Avro RPC response.
@@ -56,7 +65,13 @@ func (p *сallProtocol) init() (err error) {
 }
 
 func (p *сallProtocol) PrepareRequest(method string, datum interface{}) ([]byte, error) {
-	meta := make(map[string][]byte)
+	return p.PrepareRequestWithMeta(method, nil, datum)
+}
+
+func (p *сallProtocol) PrepareRequestWithMeta(method string, meta map[string][]byte, datum interface{}) ([]byte, error) {
+	if meta == nil {
+		meta = make(map[string][]byte)
+	}
 	metaBytes, err := p.metaCodec.BinaryFromNative(nil, meta)
 	if err != nil {
 		return nil, err
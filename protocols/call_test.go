@@ -54,6 +54,16 @@ func TestCallProtocol_PrepareRequest(t *testing.T) {
 
 		m.AssertExpectations(t)
 	})
+	t.Run("with meta", func(t *testing.T) {
+		p, m := prepareCallProtocol(t)
+		m.On("PrepareMessage", appendMethod, datum).Return(message, nilError).Once()
+
+		actual, err := p.(protocols.MetaCallProtocol).PrepareRequestWithMeta(appendMethod, map[string][]byte{"k": {0x1}}, datum)
+		require.NoError(t, err)
+		require.Equal(t, []byte{0x2, 0x2, 0x6b, 0x2, 0x1, 0x0, 0xc, 0x61, 0x70, 0x70, 0x65, 0x6e, 0x64, 0xD, 0xE, 0xF}, actual)
+
+		m.AssertExpectations(t)
+	})
 	t.Run("protocol error", func(t *testing.T) {
 		p, m := prepareCallProtocol(t)
 		m.On("PrepareMessage", "append", datum).Return(message, testError).Once()
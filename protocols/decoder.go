@@ -0,0 +1,192 @@
+package protocols
+
+import (
+	"fmt"
+
+	"github.com/linkedin/goavro/v2"
+)
+
+// Message is a decoded request or response of the Avro RPC protocol.
+type Message struct {
+	// A decoded handshake request or response if the message contains it.
+	Handshake map[string]interface{}
+	// Decoded call metadata.
+	Meta map[string]interface{}
+	// A name of the called message. It is empty for handshake-only requests
+	// and pings.
+	Method string
+	// A decoded request parameters or response datum. It is nil if the
+	// message protocol is unknown or it cannot decode the datum.
+	Datum interface{}
+	// A remote error returned instead of a response datum.
+	Error error
+	// Undecoded bytes of the message if any.
+	Rest []byte
+}
+
+// RequestParser is an optional interface of message protocols that are able
+// to decode request parameters of messages.
+type RequestParser interface {
+	ParseRequest(method string, requestBytes []byte) (interface{}, []byte, error)
+}
+
+// Decoder decodes requests and responses of a single connection for
+// debugging purposes. It tracks the handshake state to distinguish
+// handshakes from calls, so all requests and responses of the connection
+// must be passed to it in order.
+type Decoder struct {
+	proto MessageProtocol
+
+	handshakeDone bool
+	method        string
+
+	handshakeRequestCodec  *goavro.Codec
+	handshakeResponseCodec *goavro.Codec
+	metaCodec              *goavro.Codec
+	stringCodec            *goavro.Codec
+	booleanCodec           *goavro.Codec
+}
+
+// NewDecoder creates a decoder for a new connection. The message protocol
+// is used to decode datums and may be nil.
+func NewDecoder(proto MessageProtocol) (*Decoder, error) {
+	d := &Decoder{
+		proto: proto,
+	}
+
+	err := d.init()
+	if err != nil {
+		return nil, err
+	}
+
+	return d, nil
+}
+
+func (d *Decoder) init() (err error) {
+	d.handshakeRequestCodec, err = goavro.NewCodec(handshakeRequestSchema)
+	if err != nil {
+		return
+	}
+	d.handshakeResponseCodec, err = goavro.NewCodec(handshakeResponseSchema)
+	if err != nil {
+		return
+	}
+	d.metaCodec, err = goavro.NewCodec(`{"type": "map", "values": "bytes"}`)
+	if err != nil {
+		return
+	}
+	d.stringCodec, err = goavro.NewCodec(`"string"`)
+	if err != nil {
+		return
+	}
+	d.booleanCodec, err = goavro.NewCodec(`"boolean"`)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+// SkipHandshake makes the decoder treat the next request and response as a
+// call. It allows to decode connections captured after the handshake.
+func (d *Decoder) SkipHandshake() {
+	d.handshakeDone = true
+}
+
+// DecodeRequest decodes a request sent by a client.
+func (d *Decoder) DecodeRequest(b []byte) (*Message, error) {
+	m := &Message{}
+
+	if !d.handshakeDone {
+		handshake, rest, err := d.handshakeRequestCodec.NativeFromBinary(b)
+		if err != nil {
+			return nil, fmt.Errorf("cannot decode handshake request: %v", err)
+		}
+		m.Handshake, _ = handshake.(map[string]interface{})
+		b = rest
+	}
+
+	meta, b, err := d.metaCodec.NativeFromBinary(b)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode call metadata: %v", err)
+	}
+	m.Meta, _ = meta.(map[string]interface{})
+
+	method, b, err := d.stringCodec.NativeFromBinary(b)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode message name: %v", err)
+	}
+	m.Method, _ = method.(string)
+	d.method = m.Method
+
+	if m.Method != "" {
+		if parser, ok := d.proto.(RequestParser); ok {
+			datum, rest, err := parser.ParseRequest(m.Method, b)
+			if err != nil {
+				return nil, fmt.Errorf("cannot decode request: %v", err)
+			}
+			m.Datum = datum
+			b = rest
+		}
+	}
+
+	if len(b) > 0 {
+		m.Rest = b
+	}
+
+	return m, nil
+}
+
+// DecodeResponse decodes a response to the last request passed to the
+// DecodeRequest method.
+func (d *Decoder) DecodeResponse(b []byte) (*Message, error) {
+	m := &Message{
+		Method: d.method,
+	}
+
+	if !d.handshakeDone {
+		handshake, rest, err := d.handshakeResponseCodec.NativeFromBinary(b)
+		if err != nil {
+			return nil, fmt.Errorf("cannot decode handshake response: %v", err)
+		}
+		m.Handshake, _ = handshake.(map[string]interface{})
+		b = rest
+
+		if match := m.Handshake["match"]; match == "BOTH" || match == "CLIENT" {
+			d.handshakeDone = true
+		}
+	}
+
+	// Handshake-only requests and pings have empty responses.
+	if len(b) == 0 {
+		return m, nil
+	}
+
+	meta, b, err := d.metaCodec.NativeFromBinary(b)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode call metadata: %v", err)
+	}
+	m.Meta, _ = meta.(map[string]interface{})
+
+	flag, b, err := d.booleanCodec.NativeFromBinary(b)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode error flag: %v", err)
+	}
+
+	if d.proto != nil && m.Method != "" {
+		if flag == true {
+			b, m.Error = d.proto.ParseError(m.Method, b)
+		} else {
+			m.Datum, b, err = d.proto.ParseMessage(m.Method, b)
+			if err != nil {
+				return nil, fmt.Errorf("cannot decode response: %v", err)
+			}
+		}
+	}
+
+	if len(b) > 0 {
+		m.Rest = b
+	}
+
+	return m, nil
+}
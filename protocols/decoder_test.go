@@ -0,0 +1,185 @@
+package protocols_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/myzhan/avroipc/mocks"
+	"github.com/stretchr/testify/require"
+
+	"github.com/myzhan/avroipc/protocols"
+)
+
+func prepareDecoder(t *testing.T) (*protocols.Decoder, *mocks.MockProtocol) {
+	m := &mocks.MockProtocol{}
+
+	d, err := protocols.NewDecoder(m)
+	require.NoError(t, err)
+
+	return d, m
+}
+
+func prepareHandshakeRequest(t *testing.T) []byte {
+	m := &mocks.MockProtocol{}
+	m.On("GetSchema").Return("test schema").Once()
+
+	h, err := protocols.NewHandshake(m)
+	require.NoError(t, err)
+
+	request, err := h.PrepareRequest()
+	require.NoError(t, err)
+
+	return request
+}
+
+var (
+	bothResponse = []byte{
+		// Match BOTH.
+		0x0,
+		// No server protocol, server hash and metadata.
+		0x0, 0x0, 0x0,
+	}
+	noneResponse = []byte{
+		// Match NONE.
+		0x4,
+		// No server protocol, server hash and metadata.
+		0x0, 0x0, 0x0,
+	}
+	callRequest = []byte{
+		// Metadata with a single "k" key and "v" value.
+		0x2, 0x2, 0x6b, 0x2, 0x76, 0x0,
+		// Message name.
+		0xc, 0x61, 0x70, 0x70, 0x65, 0x6e, 0x64,
+		// Request datum.
+		0xD, 0xE, 0xF,
+	}
+)
+
+func TestDecoder(t *testing.T) {
+	t.Run("handshake and call", func(t *testing.T) {
+		d, m := prepareDecoder(t)
+
+		request, err := d.DecodeRequest(prepareHandshakeRequest(t))
+		require.NoError(t, err)
+		require.NotNil(t, request.Handshake["clientHash"])
+		require.Equal(t, "", request.Method)
+		require.Nil(t, request.Rest)
+
+		response, err := d.DecodeResponse(bothResponse)
+		require.NoError(t, err)
+		require.Equal(t, "BOTH", response.Handshake["match"])
+
+		// The mock protocol cannot decode request datums.
+		request, err = d.DecodeRequest(callRequest)
+		require.NoError(t, err)
+		require.Nil(t, request.Handshake)
+		require.Equal(t, map[string]interface{}{"k": []byte("v")}, request.Meta)
+		require.Equal(t, "append", request.Method)
+		require.Equal(t, []byte{0xD, 0xE, 0xF}, request.Rest)
+
+		m.On("ParseMessage", "append", []byte{0x4}).Return("OK", []byte{}, nil).Once()
+
+		response, err = d.DecodeResponse([]byte{0x0, 0x0, 0x4})
+		require.NoError(t, err)
+		require.Nil(t, response.Handshake)
+		require.Equal(t, "append", response.Method)
+		require.Equal(t, "OK", response.Datum)
+		require.Nil(t, response.Rest)
+		m.AssertExpectations(t)
+	})
+
+	t.Run("remote error", func(t *testing.T) {
+		d, m := prepareDecoder(t)
+		testError := errors.New("test error")
+
+		_, err := d.DecodeRequest(prepareHandshakeRequest(t))
+		require.NoError(t, err)
+		_, err = d.DecodeResponse(bothResponse)
+		require.NoError(t, err)
+		_, err = d.DecodeRequest(callRequest)
+		require.NoError(t, err)
+
+		m.On("ParseError", "append", []byte{0x4}).Return([]byte{}, testError).Once()
+
+		response, err := d.DecodeResponse([]byte{0x0, 0x1, 0x4})
+		require.NoError(t, err)
+		require.Equal(t, testError, response.Error)
+		require.Nil(t, response.Datum)
+		m.AssertExpectations(t)
+	})
+
+	t.Run("repeated handshake", func(t *testing.T) {
+		d, m := prepareDecoder(t)
+
+		_, err := d.DecodeRequest(prepareHandshakeRequest(t))
+		require.NoError(t, err)
+		response, err := d.DecodeResponse(noneResponse)
+		require.NoError(t, err)
+		require.Equal(t, "NONE", response.Handshake["match"])
+
+		request, err := d.DecodeRequest(prepareHandshakeRequest(t))
+		require.NoError(t, err)
+		require.NotNil(t, request.Handshake)
+		m.AssertExpectations(t)
+	})
+
+	t.Run("ping", func(t *testing.T) {
+		d, m := prepareDecoder(t)
+
+		_, err := d.DecodeRequest(prepareHandshakeRequest(t))
+		require.NoError(t, err)
+		_, err = d.DecodeResponse(bothResponse)
+		require.NoError(t, err)
+
+		request, err := d.DecodeRequest([]byte{0x0, 0x0})
+		require.NoError(t, err)
+		require.Equal(t, "", request.Method)
+
+		response, err := d.DecodeResponse(nil)
+		require.NoError(t, err)
+		require.Equal(t, &protocols.Message{}, response)
+		m.AssertExpectations(t)
+	})
+
+	t.Run("without protocol", func(t *testing.T) {
+		d, err := protocols.NewDecoder(nil)
+		require.NoError(t, err)
+
+		_, err = d.DecodeRequest(prepareHandshakeRequest(t))
+		require.NoError(t, err)
+		_, err = d.DecodeResponse(bothResponse)
+		require.NoError(t, err)
+		_, err = d.DecodeRequest(callRequest)
+		require.NoError(t, err)
+
+		response, err := d.DecodeResponse([]byte{0x0, 0x0, 0x4})
+		require.NoError(t, err)
+		require.Nil(t, response.Datum)
+		require.Equal(t, []byte{0x4}, response.Rest)
+	})
+
+	t.Run("skipped handshake", func(t *testing.T) {
+		d, m := prepareDecoder(t)
+		d.SkipHandshake()
+
+		request, err := d.DecodeRequest(callRequest)
+		require.NoError(t, err)
+		require.Nil(t, request.Handshake)
+		require.Equal(t, "append", request.Method)
+
+		m.On("ParseMessage", "append", []byte{0x4}).Return("OK", []byte{}, nil).Once()
+
+		response, err := d.DecodeResponse([]byte{0x0, 0x0, 0x4})
+		require.NoError(t, err)
+		require.Nil(t, response.Handshake)
+		require.Equal(t, "OK", response.Datum)
+		m.AssertExpectations(t)
+	})
+
+	t.Run("bad handshake", func(t *testing.T) {
+		d, _ := prepareDecoder(t)
+
+		_, err := d.DecodeRequest([]byte{0x1})
+		require.Error(t, err)
+	})
+}
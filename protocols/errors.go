@@ -0,0 +1,13 @@
+package protocols
+
+// RemoteError is an application error returned by a remote side in response
+// to a call instead of a regular response message. Implementations of the
+// MessageProtocol interface return it from the ParseError method after
+// successful decoding of an error.
+type RemoteError struct {
+	Message string
+}
+
+func (e *RemoteError) Error() string {
+	return e.Message
+}
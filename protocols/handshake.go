@@ -6,11 +6,14 @@ import (
 	"fmt"
 
 	"github.com/linkedin/goavro/v2"
-	"github.com/sirupsen/logrus"
+
+	"github.com/myzhan/avroipc/logger"
 )
 
-func getMD5(str string) []byte {
-	sum := md5.Sum([]byte(str))
+// ProtocolHash returns the MD5 hash of the protocol declaration that
+// identifies the protocol in handshakes.
+func ProtocolHash(protocol string) []byte {
+	sum := md5.Sum([]byte(protocol))
 	return sum[:]
 }
 
@@ -19,13 +22,22 @@ type HandshakeProtocol interface {
 	ProcessResponse(responseBytes []byte) (bool, error)
 }
 
+// MatchReporter is an optional interface of handshake protocols that are
+// able to report results of handshakes, e.g. for metrics. The handshake
+// protocol returned by NewHandshake implements it.
+type MatchReporter interface {
+	// Match returns the match field of the last processed response: BOTH,
+	// CLIENT or NONE. It is empty until a response is decoded successfully.
+	Match() string
+}
+
 // The Avro Handshake implementation for the Avro RPC protocol.
 //
 // It is used for establishing a stateful connection between a client and a server.
 //
 // See http://avro.apache.org/docs/1.8.2/spec.html#handshake for details.
 type handshakeProtocol struct {
-	logger *logrus.Entry
+	logger logger.Logger
 
 	proto MessageProtocol
 
@@ -35,22 +47,28 @@ type handshakeProtocol struct {
 
 	needClientProtocol bool
 
+	match string
+
 	handshakeRequestCodec  *goavro.Codec
 	handshakeResponseCodec *goavro.Codec
 }
 
 func NewHandshake(proto MessageProtocol) (HandshakeProtocol, error) {
+	return NewHandshakeWithLogger(proto, logger.NewNop())
+}
+
+// NewHandshakeWithLogger creates a handshake protocol that writes debug
+// messages and warnings about unexpected responses to the passed logger.
+func NewHandshakeWithLogger(proto MessageProtocol, l logger.Logger) (HandshakeProtocol, error) {
 	m := proto.GetSchema()
 	p := &handshakeProtocol{
 		proto:          proto,
-		serverHash:     getMD5(m),
-		clientHash:     getMD5(m),
+		serverHash:     ProtocolHash(m),
+		clientHash:     ProtocolHash(m),
 		clientProtocol: m,
 	}
 
-	p.logger = logrus.WithFields(logrus.Fields{
-		"name": "AvroHandshakeProtocol",
-	})
+	p.logger = logger.OrNop(l).With("name", "AvroHandshakeProtocol")
 	p.logger.Debug("created")
 
 	err := p.init()
@@ -116,6 +134,7 @@ func (p *handshakeProtocol) ProcessResponse(responseBytes []byte) (bool, error)
 	match := responseMap["match"]
 	serverHash := responseMap["serverHash"]
 	serverProtocol := responseMap["serverProtocol"]
+	p.match, _ = match.(string)
 	switch match {
 	case "BOTH":
 		p.logger.Debug("handshake is successful")
@@ -166,6 +185,10 @@ func (p *handshakeProtocol) ProcessResponse(responseBytes []byte) (bool, error)
 	return false, nil
 }
 
+func (p *handshakeProtocol) Match() string {
+	return p.match
+}
+
 func (p *handshakeProtocol) setServerHash(serverHash interface{}) error {
 	if serverHash == nil {
 		return nil
@@ -190,3 +213,43 @@ func (p *handshakeProtocol) setServerHash(serverHash interface{}) error {
 
 	return nil
 }
+
+// HandshakeResponse is a decoded handshake response of a server.
+type HandshakeResponse struct {
+	// BOTH, CLIENT or NONE.
+	Match string
+	// A hash of the server protocol. It is nil if the match is BOTH.
+	ServerHash []byte
+	// A declaration of the server protocol. It is empty if the match is BOTH.
+	ServerProtocol string
+}
+
+// ParseHandshakeResponse decodes the handshake response at the beginning of
+// the passed bytes and returns the rest of them.
+func ParseHandshakeResponse(responseBytes []byte) (*HandshakeResponse, []byte, error) {
+	codec, err := goavro.NewCodec(handshakeResponseSchema)
+	if err != nil {
+		return nil, responseBytes, err
+	}
+
+	response, rest, err := codec.NativeFromBinary(responseBytes)
+	if err != nil {
+		return nil, responseBytes, err
+	}
+
+	responseMap, ok := response.(map[string]interface{})
+	if !ok {
+		return nil, rest, fmt.Errorf("cannot convert handshake response: %v", response)
+	}
+
+	r := &HandshakeResponse{}
+	r.Match, _ = responseMap["match"].(string)
+	if serverHash, ok := responseMap["serverHash"].(map[string]interface{}); ok {
+		r.ServerHash, _ = serverHash["org.apache.avro.ipc.MD5"].([]byte)
+	}
+	if serverProtocol, ok := responseMap["serverProtocol"].(map[string]interface{}); ok {
+		r.ServerProtocol, _ = serverProtocol["string"].(string)
+	}
+
+	return r, rest, nil
+}
@@ -18,16 +18,16 @@ func prepareHandshakeProtocol(t *testing.T) (HandshakeProtocol, *mocks.MockProto
 	return h, m
 }
 
-func Test_getMD5(t *testing.T) {
+func TestProtocolHash(t *testing.T) {
 	t.Run("empty value", func(t *testing.T) {
-		actual := getMD5("")
+		actual := ProtocolHash("")
 		expected := []byte{0xd4, 0x1d, 0x8c, 0xd9, 0x8f, 0x0, 0xb2, 0x4, 0xe9, 0x80, 0x9, 0x98, 0xec, 0xf8, 0x42, 0x7e}
 
 		require.Equal(t, expected, actual)
 	})
 
 	t.Run("normal value", func(t *testing.T) {
-		actual := getMD5("test string")
+		actual := ProtocolHash("test string")
 		expected := []byte{0x6f, 0x8d, 0xb5, 0x99, 0xde, 0x98, 0x6f, 0xab, 0x7a, 0x21, 0x62, 0x5b, 0x79, 0x16, 0x58, 0x9c}
 
 		require.Equal(t, expected, actual)
@@ -137,6 +137,7 @@ func TestHandshakeProtocol_ProcessResponse(t *testing.T) {
 		needResend, err := p.ProcessResponse(response)
 		require.NoError(t, err)
 		require.False(t, needResend)
+		require.Equal(t, "BOTH", p.(MatchReporter).Match())
 		m.AssertExpectations(t)
 	})
 
@@ -157,6 +158,7 @@ func TestHandshakeProtocol_ProcessResponse(t *testing.T) {
 		needResend, err := p.ProcessResponse(response)
 		require.NoError(t, err)
 		require.True(t, needResend)
+		require.Equal(t, "NONE", p.(MatchReporter).Match())
 		m.AssertExpectations(t)
 	})
 
@@ -201,6 +203,7 @@ func TestHandshakeProtocol_ProcessResponse(t *testing.T) {
 		needResend, err := p.ProcessResponse(response)
 		require.NoError(t, err)
 		require.False(t, needResend)
+		require.Equal(t, "CLIENT", p.(MatchReporter).Match())
 		m.AssertExpectations(t)
 	})
 
@@ -228,3 +231,31 @@ func TestHandshakeProtocol_ProcessResponse(t *testing.T) {
 		m.AssertExpectations(t)
 	})
 }
+
+func TestParseHandshakeResponse(t *testing.T) {
+	t.Run("both", func(t *testing.T) {
+		r, rest, err := ParseHandshakeResponse([]byte{0x0, 0x0, 0x0, 0x0, 0x1})
+		require.NoError(t, err)
+		require.Equal(t, &HandshakeResponse{Match: "BOTH"}, r)
+		require.Equal(t, []byte{0x1}, rest)
+	})
+
+	t.Run("none", func(t *testing.T) {
+		hash := ProtocolHash("server")
+		responseBytes := []byte{0x4, 0x2, 0xc}
+		responseBytes = append(responseBytes, "server"...)
+		responseBytes = append(responseBytes, 0x2)
+		responseBytes = append(responseBytes, hash...)
+		responseBytes = append(responseBytes, 0x0)
+
+		r, rest, err := ParseHandshakeResponse(responseBytes)
+		require.NoError(t, err)
+		require.Equal(t, &HandshakeResponse{Match: "NONE", ServerHash: hash, ServerProtocol: "server"}, r)
+		require.Empty(t, rest)
+	})
+
+	t.Run("bad response", func(t *testing.T) {
+		_, _, err := ParseHandshakeResponse([]byte{0x6})
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,466 @@
+package protocols
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/linkedin/goavro/v2"
+)
+
+var primitiveTypes = map[string]bool{
+	"null": true, "boolean": true, "int": true, "long": true,
+	"float": true, "double": true, "bytes": true, "string": true,
+}
+
+// DeclaredError is an error declared by a message of the protocol and
+// returned by a remote side instead of a regular response. System errors are
+// returned as *RemoteError errors.
+type DeclaredError struct {
+	// A full name of the error type.
+	Type string
+	// A native Go form of the error record.
+	Datum interface{}
+	// The Avro JSON encoding of the error record.
+	JSON string
+}
+
+func (e *DeclaredError) Error() string {
+	return e.Type + ": " + e.JSON
+}
+
+type protocolMessage struct {
+	oneWay   bool
+	request  *goavro.Codec
+	response *goavro.Codec
+	errors   *goavro.Codec
+}
+
+// Protocol is a message protocol described by an Avro protocol declaration
+// (an .avpr file). Request parameters of messages are passed as maps from
+// parameter names to their native Go forms as described by the goavro
+// package. Responses are returned in native forms as well.
+//
+// It supports both client and server sides of calls. One-way messages are
+// parsed but cannot be sent by the client because it always waits for
+// responses.
+//
+// See http://avro.apache.org/docs/1.8.2/spec.html#Protocol+Declaration for
+// details.
+type Protocol struct {
+	Name      string
+	Namespace string
+
+	schema   string
+	types    map[string]interface{}
+	messages map[string]protocolMessage
+}
+
+// ParseProtocol parses the Avro protocol declaration in the JSON format.
+func ParseProtocol(avpr string) (*Protocol, error) {
+	d := json.NewDecoder(strings.NewReader(avpr))
+	d.UseNumber()
+
+	var decl struct {
+		Protocol  string                     `json:"protocol"`
+		Namespace string                     `json:"namespace"`
+		Types     []interface{}              `json:"types"`
+		Messages  map[string]json.RawMessage `json:"messages"`
+	}
+	err := d.Decode(&decl)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse protocol: %w", err)
+	}
+	if decl.Protocol == "" {
+		return nil, fmt.Errorf("cannot parse protocol: protocol name is missing")
+	}
+
+	p := &Protocol{
+		Name:      decl.Protocol,
+		Namespace: decl.Namespace,
+		schema:    strings.TrimSpace(avpr),
+		types:     make(map[string]interface{}),
+		messages:  make(map[string]protocolMessage),
+	}
+	for _, t := range decl.Types {
+		err = p.registerTypes(t, p.Namespace)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for name, raw := range decl.Messages {
+		err = p.addMessage(name, raw)
+		if err != nil {
+			return nil, fmt.Errorf("message %s: %w", name, err)
+		}
+	}
+
+	return p, nil
+}
+
+func (p *Protocol) addMessage(name string, raw json.RawMessage) error {
+	d := json.NewDecoder(bytes.NewReader(raw))
+	d.UseNumber()
+
+	var decl struct {
+		Request []map[string]interface{} `json:"request"`
+		// The response type may be a string or a complex schema.
+		Response interface{}   `json:"response"`
+		Errors   []interface{} `json:"errors"`
+		OneWay   bool          `json:"one-way"`
+	}
+	err := d.Decode(&decl)
+	if err != nil {
+		return err
+	}
+
+	fields := make([]interface{}, 0, len(decl.Request))
+	for _, param := range decl.Request {
+		fields = append(fields, param)
+	}
+	// Request parameters are encoded in the same way as fields of a record.
+	// The record is put into the protocol namespace to resolve parameter
+	// types relative to it.
+	request := map[string]interface{}{
+		"type":   "record",
+		"name":   "avroipc_request_" + name,
+		"fields": fields,
+	}
+
+	m := protocolMessage{oneWay: decl.OneWay}
+	m.request, err = p.codec(request)
+	if err != nil {
+		return fmt.Errorf("request: %w", err)
+	}
+
+	if decl.Response == nil {
+		decl.Response = "null"
+	}
+	m.response, err = p.codec(decl.Response)
+	if err != nil {
+		return fmt.Errorf("response: %w", err)
+	}
+
+	errs := append([]interface{}{"string"}, decl.Errors...)
+	m.errors, err = p.codec(errs)
+	if err != nil {
+		return fmt.Errorf("errors: %w", err)
+	}
+
+	p.messages[name] = m
+	return nil
+}
+
+// codec compiles the schema with inlined definitions of named types declared
+// in the protocol.
+func (p *Protocol) codec(schema interface{}) (*goavro.Codec, error) {
+	resolved, err := p.resolve(schema, p.Namespace, make(map[string]bool))
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := json.Marshal(resolved)
+	if err != nil {
+		return nil, err
+	}
+
+	return goavro.NewCodec(string(b))
+}
+
+// registerTypes registers the named type and all named types nested in it.
+func (p *Protocol) registerTypes(schema interface{}, namespace string) error {
+	switch s := schema.(type) {
+	case []interface{}:
+		for _, t := range s {
+			err := p.registerTypes(t, namespace)
+			if err != nil {
+				return err
+			}
+		}
+	case map[string]interface{}:
+		switch s["type"] {
+		case "record", "error", "enum", "fixed":
+			name, ns := fullName(s, namespace)
+			if name == "" {
+				return fmt.Errorf("named type without name: %v", s)
+			}
+
+			// The full name keeps the namespace of the type when it is
+			// referenced from other namespaces.
+			t := make(map[string]interface{}, len(s))
+			for k, v := range s {
+				t[k] = v
+			}
+			t["name"] = name
+			delete(t, "namespace")
+			p.types[name] = t
+
+			fields, _ := s["fields"].([]interface{})
+			for _, f := range fields {
+				field, _ := f.(map[string]interface{})
+				err := p.registerTypes(field["type"], ns)
+				if err != nil {
+					return err
+				}
+			}
+		case "array":
+			return p.registerTypes(s["items"], namespace)
+		case "map":
+			return p.registerTypes(s["values"], namespace)
+		default:
+			return p.registerTypes(s["type"], namespace)
+		}
+	}
+
+	return nil
+}
+
+// resolve returns a copy of the schema where the first reference to each
+// named type is replaced with its definition and all other references are
+// replaced with full names. All named types get full names, so namespaces of
+// enclosing types don't matter.
+func (p *Protocol) resolve(schema interface{}, namespace string, defined map[string]bool) (interface{}, error) {
+	switch s := schema.(type) {
+	case string:
+		if primitiveTypes[s] {
+			return s, nil
+		}
+
+		name := s
+		if !strings.Contains(name, ".") && namespace != "" {
+			name = namespace + "." + name
+		}
+		if _, ok := p.types[name]; !ok {
+			// Names without namespaces may refer to types in the null
+			// namespace.
+			if _, ok := p.types[s]; !ok {
+				return nil, fmt.Errorf("unknown type: %s", s)
+			}
+			name = s
+		}
+		if defined[name] {
+			return name, nil
+		}
+
+		return p.resolve(p.types[name], namespace, defined)
+	case []interface{}:
+		union := make([]interface{}, len(s))
+		for i, t := range s {
+			r, err := p.resolve(t, namespace, defined)
+			if err != nil {
+				return nil, err
+			}
+			union[i] = r
+		}
+		return union, nil
+	case map[string]interface{}:
+		r := make(map[string]interface{}, len(s))
+		for k, v := range s {
+			r[k] = v
+		}
+
+		var err error
+		switch s["type"] {
+		case "record", "error", "enum", "fixed":
+			name, ns := fullName(s, namespace)
+			if defined[name] {
+				return name, nil
+			}
+			defined[name] = true
+
+			r["name"] = name
+			delete(r, "namespace")
+			if r["type"] == "error" {
+				r["type"] = "record"
+			}
+
+			fields, _ := s["fields"].([]interface{})
+			if fields != nil {
+				resolvedFields := make([]interface{}, len(fields))
+				for i, f := range fields {
+					field, ok := f.(map[string]interface{})
+					if !ok {
+						return nil, fmt.Errorf("invalid field of %s: %v", name, f)
+					}
+					resolvedField := make(map[string]interface{}, len(field))
+					for k, v := range field {
+						resolvedField[k] = v
+					}
+					resolvedField["type"], err = p.resolve(field["type"], ns, defined)
+					if err != nil {
+						return nil, err
+					}
+					resolvedFields[i] = resolvedField
+				}
+				r["fields"] = resolvedFields
+			}
+		case "array":
+			r["items"], err = p.resolve(s["items"], namespace, defined)
+		case "map":
+			r["values"], err = p.resolve(s["values"], namespace, defined)
+		default:
+			r["type"], err = p.resolve(s["type"], namespace, defined)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return r, nil
+	default:
+		return nil, fmt.Errorf("invalid schema: %v", schema)
+	}
+}
+
+// fullName returns the full name of the named type and its namespace.
+func fullName(schema map[string]interface{}, namespace string) (string, string) {
+	name, _ := schema["name"].(string)
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		return name, name[:i]
+	}
+	if ns, ok := schema["namespace"].(string); ok {
+		namespace = ns
+	}
+	if namespace == "" {
+		return name, ""
+	}
+
+	return namespace + "." + name, namespace
+}
+
+// Messages returns sorted names of all messages of the protocol.
+func (p *Protocol) Messages() []string {
+	names := make([]string, 0, len(p.messages))
+	for name := range p.messages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// OneWay reports whether the message is declared as one-way.
+func (p *Protocol) OneWay(method string) bool {
+	return p.messages[method].oneWay
+}
+
+// RequestFromJSON converts request parameters in the Avro JSON encoding to
+// their native Go form accepted by the PrepareMessage method.
+func (p *Protocol) RequestFromJSON(method string, b []byte) (interface{}, error) {
+	message, ok := p.messages[method]
+	if !ok {
+		return nil, fmt.Errorf("unknown method name: %s", method)
+	}
+
+	datum, _, err := message.request.NativeFromTextual(b)
+	return datum, err
+}
+
+// ResponseToJSON converts the native Go form of the response returned by the
+// ParseMessage method to the Avro JSON encoding.
+func (p *Protocol) ResponseToJSON(method string, datum interface{}) ([]byte, error) {
+	message, ok := p.messages[method]
+	if !ok {
+		return nil, fmt.Errorf("unknown method name: %s", method)
+	}
+
+	return message.response.TextualFromNative(nil, datum)
+}
+
+func (p *Protocol) PrepareMessage(method string, datum interface{}) ([]byte, error) {
+	message, ok := p.messages[method]
+	if !ok {
+		return nil, fmt.Errorf("unknown method name: %s", method)
+	}
+
+	return message.request.BinaryFromNative(nil, datum)
+}
+
+func (p *Protocol) ParseMessage(method string, responseBytes []byte) (interface{}, []byte, error) {
+	message, ok := p.messages[method]
+	if !ok {
+		return nil, responseBytes, fmt.Errorf("unknown method name: %s", method)
+	}
+
+	return message.response.NativeFromBinary(responseBytes)
+}
+
+func (p *Protocol) ParseError(method string, responseBytes []byte) ([]byte, error) {
+	message, ok := p.messages[method]
+	if !ok {
+		return responseBytes, fmt.Errorf("unknown method name: %s", method)
+	}
+
+	response, responseBytes, err := message.errors.NativeFromBinary(responseBytes)
+	if err != nil {
+		return responseBytes, err
+	}
+
+	responseMap, ok := response.(map[string]interface{})
+	if !ok || len(responseMap) != 1 {
+		return responseBytes, fmt.Errorf("cannot convert error union to map: %v", response)
+	}
+
+	for name, datum := range responseMap {
+		if name == "string" {
+			s, _ := datum.(string)
+			return responseBytes, &RemoteError{Message: s}
+		}
+
+		text, err := message.errors.TextualFromNative(nil, response)
+		if err != nil {
+			return responseBytes, err
+		}
+		// Unwrap the union to get the JSON encoding of the record itself.
+		var union map[string]json.RawMessage
+		if json.Unmarshal(text, &union) == nil {
+			text = union[name]
+		}
+
+		return responseBytes, &DeclaredError{Type: name, Datum: datum, JSON: string(text)}
+	}
+
+	return responseBytes, nil
+}
+
+// ParseRequest decodes request parameters of the method. It is used by the
+// server side of the protocol and to decode requests for debugging purposes.
+func (p *Protocol) ParseRequest(method string, requestBytes []byte) (interface{}, []byte, error) {
+	message, ok := p.messages[method]
+	if !ok {
+		return nil, requestBytes, fmt.Errorf("unknown method name: %s", method)
+	}
+
+	return message.request.NativeFromBinary(requestBytes)
+}
+
+// PrepareResponse encodes a response of the method. It is used by the server
+// side of the protocol.
+func (p *Protocol) PrepareResponse(method string, datum interface{}) ([]byte, error) {
+	message, ok := p.messages[method]
+	if !ok {
+		return nil, fmt.Errorf("unknown method name: %s", method)
+	}
+
+	return message.response.BinaryFromNative(nil, datum)
+}
+
+// PrepareError encodes an error of the method. A *DeclaredError is encoded
+// as the declared error, any other error is encoded as the system string
+// error. It is used by the server side of the protocol.
+func (p *Protocol) PrepareError(method string, err error) ([]byte, error) {
+	message, ok := p.messages[method]
+	if !ok {
+		return nil, fmt.Errorf("unknown method name: %s", method)
+	}
+
+	if declared, ok := err.(*DeclaredError); ok {
+		return message.errors.BinaryFromNative(nil, map[string]interface{}{declared.Type: declared.Datum})
+	}
+
+	return message.errors.BinaryFromNative(nil, map[string]interface{}{"string": err.Error()})
+}
+
+func (p *Protocol) GetSchema() string {
+	return p.schema
+}
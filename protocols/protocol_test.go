@@ -0,0 +1,160 @@
+package protocols_test
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/myzhan/avroipc/protocols"
+)
+
+func prepareProtocol(t *testing.T) *protocols.Protocol {
+	avpr, err := os.ReadFile("testdata/simple.avpr")
+	require.NoError(t, err)
+
+	p, err := protocols.ParseProtocol(string(avpr))
+	require.NoError(t, err)
+
+	return p
+}
+
+func TestParseProtocol(t *testing.T) {
+	t.Run("succeed", func(t *testing.T) {
+		p := prepareProtocol(t)
+		require.Equal(t, "Simple", p.Name)
+		require.Equal(t, "org.apache.avro.test", p.Namespace)
+		require.Equal(t, []string{"ack", "add", "echo", "error", "hello", "nested"}, p.Messages())
+		require.True(t, p.OneWay("ack"))
+		require.False(t, p.OneWay("hello"))
+		require.Contains(t, p.GetSchema(), `"protocol": "Simple"`)
+	})
+
+	tests := map[string]struct {
+		avpr string
+		err  string
+	}{
+		"invalid json": {
+			avpr: `{`,
+			err:  "cannot parse protocol: unexpected EOF",
+		},
+		"missing name": {
+			avpr: `{"messages": {}}`,
+			err:  "cannot parse protocol: protocol name is missing",
+		},
+		"unknown type": {
+			avpr: `{"protocol": "P", "messages": {"m": {"request": [{"name": "a", "type": "Unknown"}], "response": "null"}}}`,
+			err:  "message m: request: unknown type: Unknown",
+		},
+		"invalid schema": {
+			avpr: `{"protocol": "P", "messages": {"m": {"request": [], "response": 1}}}`,
+			err:  "message m: response: invalid schema: 1",
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := protocols.ParseProtocol(tt.avpr)
+			require.EqualError(t, err, tt.err)
+		})
+	}
+}
+
+func TestProtocol_Messages(t *testing.T) {
+	p := prepareProtocol(t)
+
+	record := map[string]interface{}{
+		"name":   "test",
+		"kind":   "BAR",
+		"hash":   []byte("0123456789abcdef"),
+		"nested": map[string]interface{}{"org.apache.avro.other.Nested": map[string]interface{}{"kind": "BAZ"}},
+	}
+
+	t.Run("request", func(t *testing.T) {
+		datum := map[string]interface{}{"arg1": int32(1), "arg2": int32(2)}
+		b, err := p.PrepareMessage("add", datum)
+		require.NoError(t, err)
+		require.Equal(t, []byte{0x02, 0x04}, b)
+
+		parsed, rest, err := p.ParseRequest("add", b)
+		require.NoError(t, err)
+		require.Empty(t, rest)
+		require.Equal(t, datum, parsed)
+
+		fromJSON, err := p.RequestFromJSON("add", []byte(`{"arg1": 1, "arg2": 2}`))
+		require.NoError(t, err)
+		require.Equal(t, datum, fromJSON)
+	})
+
+	t.Run("response", func(t *testing.T) {
+		b, err := p.PrepareResponse("echo", record)
+		require.NoError(t, err)
+
+		parsed, rest, err := p.ParseMessage("echo", b)
+		require.NoError(t, err)
+		require.Empty(t, rest)
+		require.Equal(t, record, parsed)
+
+		text, err := p.ResponseToJSON("hello", "hi")
+		require.NoError(t, err)
+		require.Equal(t, `"hi"`, string(text))
+	})
+
+	t.Run("nested namespace", func(t *testing.T) {
+		nested := map[string]interface{}{"kind": "FOO"}
+		b, err := p.PrepareMessage("nested", map[string]interface{}{"nested": nested})
+		require.NoError(t, err)
+		require.Equal(t, []byte{0x00}, b)
+
+		b, err = p.PrepareResponse("nested", []interface{}{nested})
+		require.NoError(t, err)
+		parsed, _, err := p.ParseMessage("nested", b)
+		require.NoError(t, err)
+		require.Equal(t, []interface{}{nested}, parsed)
+	})
+
+	t.Run("declared error", func(t *testing.T) {
+		declared := &protocols.DeclaredError{
+			Type:  "org.apache.avro.test.TestError",
+			Datum: map[string]interface{}{"message": "oops"},
+		}
+		b, err := p.PrepareError("error", declared)
+		require.NoError(t, err)
+
+		rest, err := p.ParseError("error", b)
+		require.Empty(t, rest)
+		require.Equal(t, &protocols.DeclaredError{
+			Type:  "org.apache.avro.test.TestError",
+			Datum: map[string]interface{}{"message": "oops"},
+			JSON:  `{"message":"oops"}`,
+		}, err)
+		require.EqualError(t, err, `org.apache.avro.test.TestError: {"message":"oops"}`)
+	})
+
+	t.Run("system error", func(t *testing.T) {
+		b, err := p.PrepareError("error", errors.New("test error"))
+		require.NoError(t, err)
+
+		_, err = p.ParseError("error", b)
+		require.Equal(t, &protocols.RemoteError{Message: "test error"}, err)
+	})
+
+	t.Run("unknown method", func(t *testing.T) {
+		_, err := p.PrepareMessage("unknown", nil)
+		require.EqualError(t, err, "unknown method name: unknown")
+		_, _, err = p.ParseMessage("unknown", nil)
+		require.EqualError(t, err, "unknown method name: unknown")
+		_, err = p.ParseError("unknown", nil)
+		require.EqualError(t, err, "unknown method name: unknown")
+		_, _, err = p.ParseRequest("unknown", nil)
+		require.EqualError(t, err, "unknown method name: unknown")
+		_, err = p.PrepareResponse("unknown", nil)
+		require.EqualError(t, err, "unknown method name: unknown")
+		_, err = p.PrepareError("unknown", nil)
+		require.EqualError(t, err, "unknown method name: unknown")
+		_, err = p.RequestFromJSON("unknown", nil)
+		require.EqualError(t, err, "unknown method name: unknown")
+		_, err = p.ResponseToJSON("unknown", nil)
+		require.EqualError(t, err, "unknown method name: unknown")
+	})
+}
@@ -0,0 +1,206 @@
+package protocols
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/linkedin/goavro/v2"
+)
+
+// ServerProtocol is implemented by message protocols that support the server
+// side of calls.
+type ServerProtocol interface {
+	MessageProtocol
+	RequestParser
+
+	PrepareResponse(method string, datum interface{}) ([]byte, error)
+	PrepareError(method string, err error) ([]byte, error)
+}
+
+// Handler handles a call of the method with decoded request parameters. A
+// returned error is sent to the client as a remote error.
+type Handler func(method string, datum interface{}) (interface{}, error)
+
+// The Avro RPC server implementation for a single connection.
+//
+// It performs handshakes and prepares responses to calls using a handler.
+// It is a minimal implementation that is supposed to be used in tests: it
+// accepts any client protocol without checking its compatibility.
+//
+// See http://avro.apache.org/docs/1.8.2/spec.html#handshake for details.
+type Responder struct {
+	proto   ServerProtocol
+	handler Handler
+
+	serverHash     []byte
+	serverProtocol string
+
+	handshakeDone bool
+
+	handshakeRequestCodec  *goavro.Codec
+	handshakeResponseCodec *goavro.Codec
+	metaCodec              *goavro.Codec
+	stringCodec            *goavro.Codec
+	booleanCodec           *goavro.Codec
+}
+
+// NewResponder creates a responder for a new connection.
+func NewResponder(proto ServerProtocol, handler Handler) (*Responder, error) {
+	m := proto.GetSchema()
+	r := &Responder{
+		proto:          proto,
+		handler:        handler,
+		serverHash:     ProtocolHash(m),
+		serverProtocol: m,
+	}
+
+	err := r.init()
+	if err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (r *Responder) init() (err error) {
+	r.handshakeRequestCodec, err = goavro.NewCodec(handshakeRequestSchema)
+	if err != nil {
+		return
+	}
+	r.handshakeResponseCodec, err = goavro.NewCodec(handshakeResponseSchema)
+	if err != nil {
+		return
+	}
+	r.metaCodec, err = goavro.NewCodec(`{"type": "map", "values": "bytes"}`)
+	if err != nil {
+		return
+	}
+	r.stringCodec, err = goavro.NewCodec(`"string"`)
+	if err != nil {
+		return
+	}
+	r.booleanCodec, err = goavro.NewCodec(`"boolean"`)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+// Respond processes a request and returns a response to it. An error is
+// returned only if the request cannot be decoded, errors of the handler are
+// sent to the client as remote errors.
+func (r *Responder) Respond(requestBytes []byte) ([]byte, error) {
+	buf := &bytes.Buffer{}
+
+	if !r.handshakeDone {
+		rest, err := r.handshake(buf, requestBytes)
+		if err != nil {
+			return nil, err
+		}
+		// Calls are not processed until the client protocol is known.
+		if !r.handshakeDone {
+			return buf.Bytes(), nil
+		}
+		requestBytes = rest
+	}
+
+	_, requestBytes, err := r.metaCodec.NativeFromBinary(requestBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	method, requestBytes, err := r.stringCodec.NativeFromBinary(requestBytes)
+	if err != nil {
+		return nil, err
+	}
+	methodStr, _ := method.(string)
+
+	// Handshake-only requests and pings have empty responses.
+	if methodStr == "" {
+		return buf.Bytes(), nil
+	}
+
+	err = r.call(buf, methodStr, requestBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (r *Responder) handshake(buf *bytes.Buffer, requestBytes []byte) ([]byte, error) {
+	request, requestBytes, err := r.handshakeRequestCodec.NativeFromBinary(requestBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	requestMap, ok := request.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("cannot convert handshake request: %v", request)
+	}
+
+	clientHash, _ := requestMap["clientHash"].([]byte)
+	serverHash, _ := requestMap["serverHash"].([]byte)
+	clientProtocol := requestMap["clientProtocol"]
+
+	match := "BOTH"
+	switch {
+	case !bytes.Equal(clientHash, r.serverHash) && clientProtocol == nil:
+		match = "NONE"
+	case !bytes.Equal(serverHash, r.serverHash):
+		match = "CLIENT"
+	}
+	r.handshakeDone = match != "NONE"
+
+	response := map[string]interface{}{
+		"match":          match,
+		"serverProtocol": nil,
+		"serverHash":     nil,
+		"meta":           nil,
+	}
+	if match != "BOTH" {
+		response["serverProtocol"] = map[string]interface{}{"string": r.serverProtocol}
+		response["serverHash"] = map[string]interface{}{"org.apache.avro.ipc.MD5": r.serverHash}
+	}
+
+	responseBytes, err := r.handshakeResponseCodec.BinaryFromNative(nil, response)
+	if err != nil {
+		return nil, err
+	}
+	buf.Write(responseBytes)
+
+	return requestBytes, nil
+}
+
+func (r *Responder) call(buf *bytes.Buffer, method string, requestBytes []byte) error {
+	datum, _, err := r.proto.ParseRequest(method, requestBytes)
+	if err != nil {
+		return err
+	}
+
+	metaBytes, err := r.metaCodec.BinaryFromNative(nil, map[string]interface{}{})
+	if err != nil {
+		return err
+	}
+	buf.Write(metaBytes)
+
+	var responseBytes []byte
+	response, err := r.handler(method, datum)
+	if err != nil {
+		responseBytes, err = r.proto.PrepareError(method, err)
+		if err != nil {
+			return err
+		}
+		buf.WriteByte(1)
+	} else {
+		responseBytes, err = r.proto.PrepareResponse(method, response)
+		if err != nil {
+			return err
+		}
+		buf.WriteByte(0)
+	}
+	buf.Write(responseBytes)
+
+	return nil
+}
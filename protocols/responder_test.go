@@ -0,0 +1,119 @@
+package protocols_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/myzhan/avroipc/mocks"
+	"github.com/stretchr/testify/require"
+
+	"github.com/myzhan/avroipc/protocols"
+)
+
+func prepareResponder(t *testing.T, handler protocols.Handler) (*protocols.Responder, *mocks.MockServerProtocol) {
+	m := &mocks.MockServerProtocol{}
+	m.On("GetSchema").Return("test schema").Once()
+
+	r, err := protocols.NewResponder(m, handler)
+	require.NoError(t, err)
+
+	return r, m
+}
+
+func TestResponder_Respond(t *testing.T) {
+	testError := errors.New("test error")
+	handler := func(method string, datum interface{}) (interface{}, error) {
+		if datum == "bad" {
+			return nil, testError
+		}
+		return "good", nil
+	}
+
+	// Server hash and protocol of the "test schema" protocol.
+	serverHash := []byte{0xc2, 0x20, 0xbe, 0x3a, 0x18, 0x60, 0xad, 0xac, 0xc6, 0x49, 0xc2, 0x5e, 0xba, 0x89, 0x97, 0x59}
+	serverProtocol := []byte{0x16, 0x74, 0x65, 0x73, 0x74, 0x20, 0x73, 0x63, 0x68, 0x65, 0x6d, 0x61}
+
+	t.Run("known protocol", func(t *testing.T) {
+		r, m := prepareResponder(t, handler)
+
+		actual, err := r.Respond(prepareHandshakeRequest(t))
+		require.NoError(t, err)
+		require.Equal(t, bothResponse, actual)
+
+		m.On("ParseRequest", "append", []byte{0xD, 0xE, 0xF}).Return("good", []byte{}, nil).Once()
+		m.On("PrepareResponse", "append", "good").Return([]byte{0x4}, nil).Once()
+
+		actual, err = r.Respond(callRequest)
+		require.NoError(t, err)
+		require.Equal(t, []byte{0x0, 0x0, 0x4}, actual)
+
+		// Ping
+		actual, err = r.Respond([]byte{0x0, 0x0})
+		require.NoError(t, err)
+		require.Empty(t, actual)
+		m.AssertExpectations(t)
+	})
+
+	t.Run("remote error", func(t *testing.T) {
+		r, m := prepareResponder(t, handler)
+
+		_, err := r.Respond(prepareHandshakeRequest(t))
+		require.NoError(t, err)
+
+		m.On("ParseRequest", "append", []byte{0xD, 0xE, 0xF}).Return("bad", []byte{}, nil).Once()
+		m.On("PrepareError", "append", testError).Return([]byte{0x5}, nil).Once()
+
+		actual, err := r.Respond(callRequest)
+		require.NoError(t, err)
+		require.Equal(t, []byte{0x0, 0x1, 0x5}, actual)
+		m.AssertExpectations(t)
+	})
+
+	t.Run("unknown protocol", func(t *testing.T) {
+		r, m := prepareResponder(t, handler)
+
+		request := []byte{
+			// Unknown client hash.
+			0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0,
+			// No client protocol.
+			0x0,
+			// Unknown server hash.
+			0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0,
+			// Metadata
+			0x0,
+		}
+		// Calls are ignored until the client protocol is known.
+		request = append(request, callRequest...)
+
+		expected := []byte{0x4, 0x2}
+		expected = append(expected, serverProtocol...)
+		expected = append(expected, 0x2)
+		expected = append(expected, serverHash...)
+		expected = append(expected, 0x0)
+
+		actual, err := r.Respond(request)
+		require.NoError(t, err)
+		require.Equal(t, expected, actual)
+
+		// Send the client protocol.
+		request[16] = 0x2
+		request = append(request[:17], append(serverProtocol, request[17:]...)...)
+		m.On("ParseRequest", "append", []byte{0xD, 0xE, 0xF}).Return("good", []byte{}, nil).Once()
+		m.On("PrepareResponse", "append", "good").Return([]byte{0x4}, nil).Once()
+
+		expected[0] = 0x2
+		expected = append(expected, 0x0, 0x0, 0x4)
+
+		actual, err = r.Respond(request)
+		require.NoError(t, err)
+		require.Equal(t, expected, actual)
+		m.AssertExpectations(t)
+	})
+
+	t.Run("bad request", func(t *testing.T) {
+		r, _ := prepareResponder(t, handler)
+
+		_, err := r.Respond([]byte{0x1})
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,132 @@
+package avroipc
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/myzhan/avroipc/layers"
+)
+
+var (
+	retryRandMu sync.Mutex
+	retryRand   = rand.New(rand.NewSource(time.Now().UnixNano()))
+)
+
+// RetryPolicy describes how failed requests are retried. A zero value of the
+// policy doesn't retry anything.
+//
+// Keep in mind that a request may have been already processed by a server
+// when a transport error occurs, so retried requests may be delivered more
+// than once.
+type RetryPolicy struct {
+	// A maximum number of attempts including the first one.
+	//
+	// Defaults to zero which means a single attempt without retries.
+	MaxAttempts int
+
+	// A delay before the first retry. Delays before subsequent retries are
+	// doubled every time.
+	//
+	// Defaults to zero which means 100 milliseconds.
+	BaseBackoff time.Duration
+
+	// A maximum delay between retries.
+	//
+	// Defaults to zero which means 10 seconds.
+	MaxBackoff time.Duration
+
+	// A part of each delay from 0 to 1 that is randomized to spread retries
+	// of different clients.
+	//
+	// Defaults to zero which means no randomization.
+	Jitter float64
+
+	// Used to decide whether a failed request may be retried.
+	//
+	// Defaults to nil which means that the IsRetryable function is used.
+	Retryable func(err error) bool
+}
+
+// IsRetryable reports whether the error is a transport error and the request
+// may be safely retried over a new connection. Remote application errors and
+// exceeded response limits are not retryable.
+func IsRetryable(err error) bool {
+	var limitErr *layers.LimitError
+	if errors.As(err, &limitErr) {
+		return false
+	}
+
+	var transportErr *TransportError
+	return errors.As(err, &transportErr)
+}
+
+// Do calls the passed function until it succeeds, returns a non-retryable
+// error or the maximum number of attempts is reached. The last error is
+// returned.
+func (p *RetryPolicy) Do(fn func() error) error {
+	return p.DoContext(context.Background(), fn)
+}
+
+// DoContext calls the passed function in the same way as Do but stops
+// waiting for the next attempt and returns the error of the context as soon
+// as the context is done.
+func (p *RetryPolicy) DoContext(ctx context.Context, fn func() error) error {
+	attempt := 1
+	for {
+		err := fn()
+		if err == nil || attempt >= p.MaxAttempts || !p.retryable(err) {
+			return err
+		}
+
+		timer := time.NewTimer(p.Backoff(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+		attempt++
+	}
+}
+
+// Backoff returns a delay before the next attempt after the specified number
+// of failed attempts.
+func (p *RetryPolicy) Backoff(attempt int) time.Duration {
+	base := p.BaseBackoff
+	if base <= 0 {
+		base = 100 * time.Millisecond
+	}
+	max := p.MaxBackoff
+	if max <= 0 {
+		max = 10 * time.Second
+	}
+
+	d := base
+	for i := 1; i < attempt && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+
+	if p.Jitter > 0 {
+		retryRandMu.Lock()
+		r := retryRand.Float64()
+		retryRandMu.Unlock()
+
+		d -= time.Duration(float64(d) * p.Jitter * r)
+	}
+
+	return d
+}
+
+func (p *RetryPolicy) retryable(err error) bool {
+	if p.Retryable != nil {
+		return p.Retryable(err)
+	}
+
+	return IsRetryable(err)
+}
@@ -0,0 +1,136 @@
+package avroipc_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/myzhan/avroipc"
+	"github.com/myzhan/avroipc/layers"
+	"github.com/myzhan/avroipc/protocols"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsRetryable(t *testing.T) {
+	require.True(t, avroipc.IsRetryable(&avroipc.TransportError{Err: io.EOF}))
+	require.False(t, avroipc.IsRetryable(&avroipc.TransportError{Err: &layers.LimitError{}}))
+	require.False(t, avroipc.IsRetryable(&protocols.RemoteError{Message: "test error"}))
+	require.False(t, avroipc.IsRetryable(errors.New("test error")))
+}
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	t.Run("defaults", func(t *testing.T) {
+		p := &avroipc.RetryPolicy{}
+
+		require.Equal(t, 100*time.Millisecond, p.Backoff(1))
+		require.Equal(t, 200*time.Millisecond, p.Backoff(2))
+		require.Equal(t, 10*time.Second, p.Backoff(100))
+	})
+
+	t.Run("cap", func(t *testing.T) {
+		p := &avroipc.RetryPolicy{BaseBackoff: time.Second, MaxBackoff: 3 * time.Second}
+
+		require.Equal(t, time.Second, p.Backoff(1))
+		require.Equal(t, 2*time.Second, p.Backoff(2))
+		require.Equal(t, 3*time.Second, p.Backoff(3))
+	})
+
+	t.Run("jitter", func(t *testing.T) {
+		p := &avroipc.RetryPolicy{BaseBackoff: time.Second, Jitter: 0.5}
+
+		for i := 0; i < 100; i++ {
+			d := p.Backoff(1)
+			require.True(t, d > 500*time.Millisecond, d)
+			require.True(t, d <= time.Second, d)
+		}
+	})
+}
+
+func TestRetryPolicy_Do(t *testing.T) {
+	testErr := &avroipc.TransportError{Err: errors.New("test error")}
+
+	t.Run("no retries", func(t *testing.T) {
+		p := &avroipc.RetryPolicy{}
+
+		calls := 0
+		err := p.Do(func() error {
+			calls++
+			return testErr
+		})
+		require.EqualError(t, err, "test error")
+		require.Equal(t, 1, calls)
+	})
+
+	t.Run("max attempts", func(t *testing.T) {
+		p := &avroipc.RetryPolicy{MaxAttempts: 3, BaseBackoff: time.Nanosecond}
+
+		calls := 0
+		err := p.Do(func() error {
+			calls++
+			return testErr
+		})
+		require.EqualError(t, err, "test error")
+		require.Equal(t, 3, calls)
+	})
+
+	t.Run("succeed after retry", func(t *testing.T) {
+		p := &avroipc.RetryPolicy{MaxAttempts: 3, BaseBackoff: time.Nanosecond}
+
+		calls := 0
+		err := p.Do(func() error {
+			calls++
+			if calls == 1 {
+				return testErr
+			}
+			return nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, 2, calls)
+	})
+
+	t.Run("not retryable", func(t *testing.T) {
+		p := &avroipc.RetryPolicy{MaxAttempts: 3, BaseBackoff: time.Nanosecond}
+
+		calls := 0
+		err := p.Do(func() error {
+			calls++
+			return &protocols.RemoteError{Message: "remote error"}
+		})
+		require.EqualError(t, err, "remote error")
+		require.Equal(t, 1, calls)
+	})
+
+	t.Run("custom classifier", func(t *testing.T) {
+		p := &avroipc.RetryPolicy{
+			MaxAttempts: 3,
+			BaseBackoff: time.Nanosecond,
+			Retryable: func(err error) bool {
+				return true
+			},
+		}
+
+		calls := 0
+		err := p.Do(func() error {
+			calls++
+			return errors.New("test error")
+		})
+		require.EqualError(t, err, "test error")
+		require.Equal(t, 3, calls)
+	})
+	t.Run("cancelled context", func(t *testing.T) {
+		p := &avroipc.RetryPolicy{MaxAttempts: 3, BaseBackoff: time.Hour}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		calls := 0
+		err := p.DoContext(ctx, func() error {
+			calls++
+			cancel()
+			return testErr
+		})
+		require.Equal(t, context.Canceled, err)
+		require.Equal(t, 1, calls)
+	})
+}
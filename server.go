@@ -0,0 +1,75 @@
+package avroipc
+
+import (
+	"errors"
+	"io"
+
+	"github.com/myzhan/avroipc/layers"
+	"github.com/myzhan/avroipc/protocols"
+	"github.com/myzhan/avroipc/transports"
+)
+
+// Serve serves calls received through the transport with the handler until
+// the client closes the connection. The transport is closed on return.
+//
+// It is a minimal server implementation that accepts any client protocol
+// and is supposed to be used in tests.
+func Serve(trans transports.Transport, proto protocols.ServerProtocol, handler protocols.Handler) error {
+	defer trans.Close()
+
+	responder, err := protocols.NewResponder(proto, handler)
+	if err != nil {
+		return err
+	}
+	framingLayer := layers.NewFramingWithConfig(trans, &layers.FramingConfig{Server: true})
+
+	for {
+		request, err := framingLayer.Read()
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrClosedPipe) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		response, err := responder.Respond(request)
+		if err != nil {
+			return err
+		}
+
+		err = framingLayer.Write(response)
+		if err != nil {
+			return err
+		}
+		err = trans.Flush()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// LoopbackDialer returns a dialer for the Config that connects clients to
+// the handler served in the same process through an in-memory pipe instead
+// of a network connection. Every connection is served by a new goroutine
+// and errors of serving are seen by clients as closed connections.
+func LoopbackDialer(proto protocols.ServerProtocol, handler protocols.Handler) func(addr string) (transports.Transport, error) {
+	return func(addr string) (transports.Transport, error) {
+		client, server := transports.NewPipe()
+		go func() {
+			_ = Serve(server, proto, handler)
+		}()
+		return client, nil
+	}
+}
+
+// NewLoopbackClient creates a client connected to the handler served in the
+// same process. The Dialer option of the passed configuration is ignored.
+//
+// This constructor supposed to be used in tests that need full handshakes
+// and calls without any sockets.
+func NewLoopbackClient(proto protocols.ServerProtocol, handler protocols.Handler, config *Config) (Client, error) {
+	c := *config
+	c.Dialer = LoopbackDialer(proto, handler)
+
+	return NewClientWithConfig("loopback", proto, &c)
+}
@@ -0,0 +1,115 @@
+package avroipc_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/myzhan/avroipc"
+	"github.com/myzhan/avroipc/flume"
+	"github.com/myzhan/avroipc/protocols"
+
+	"github.com/stretchr/testify/require"
+)
+
+func prepareServerProtocol(t *testing.T) protocols.ServerProtocol {
+	proto, err := flume.NewAvroSource()
+	require.NoError(t, err)
+
+	return proto.(protocols.ServerProtocol)
+}
+
+func TestNewLoopbackClient(t *testing.T) {
+	proto := prepareServerProtocol(t)
+
+	var bodies []string
+	handler := func(method string, datum interface{}) (interface{}, error) {
+		body := string(datum.(map[string]interface{})["body"].([]byte))
+		if body == "bad" {
+			return nil, errors.New("bad body")
+		}
+		bodies = append(bodies, body)
+		return "OK", nil
+	}
+
+	config := avroipc.NewConfig().WithSendTimeout(time.Second).WithPingInterval(time.Millisecond)
+	client, err := avroipc.NewLoopbackClient(proto, handler, config)
+	require.NoError(t, err)
+
+	status, err := client.SendMessage("append", map[string]interface{}{
+		"headers": map[string]interface{}{},
+		"body":    []byte("good"),
+	})
+	require.NoError(t, err)
+	require.Equal(t, "OK", status)
+	require.Equal(t, []string{"good"}, bodies)
+
+	_, err = client.SendMessage("append", map[string]interface{}{
+		"headers": map[string]interface{}{},
+		"body":    []byte("bad"),
+	})
+	require.EqualError(t, err, "bad body")
+	require.IsType(t, &protocols.RemoteError{}, err)
+
+	// Let the client ping the server.
+	time.Sleep(10 * time.Millisecond)
+
+	status, err = client.SendMessage("append", map[string]interface{}{
+		"headers": map[string]interface{}{},
+		"body":    []byte("good"),
+	})
+	require.NoError(t, err)
+	require.Equal(t, "OK", status)
+
+	require.NoError(t, client.Close())
+}
+
+func TestLoopbackDialer(t *testing.T) {
+	proto := prepareServerProtocol(t)
+
+	var events int
+	handler := func(method string, datum interface{}) (interface{}, error) {
+		events += len(datum.([]interface{}))
+		return "OK", nil
+	}
+
+	config := avroipc.NewConfig().WithDialer(avroipc.LoopbackDialer(proto, handler))
+	client, err := flume.NewClientWithConfig("loopback", config)
+	require.NoError(t, err)
+
+	status, err := client.AppendBatch([]*flume.Event{{Body: []byte("a")}, {Body: []byte("b")}})
+	require.NoError(t, err)
+	require.Equal(t, "OK", status)
+	require.Equal(t, 2, events)
+
+	require.NoError(t, client.Close())
+}
+
+// plainClient implements only the Client interface.
+type plainClient struct {
+	avroipc.Client
+}
+
+func TestSendMessageContext(t *testing.T) {
+	proto := prepareServerProtocol(t)
+	handler := func(method string, datum interface{}) (interface{}, error) {
+		return "OK", nil
+	}
+
+	client, err := avroipc.NewLoopbackClient(proto, handler, avroipc.NewConfig())
+	require.NoError(t, err)
+	c := plainClient{client}
+
+	datum := map[string]interface{}{"headers": map[string]interface{}{}, "body": []byte("a")}
+	status, err := avroipc.SendMessageContext(context.Background(), c, "append", datum)
+	require.NoError(t, err)
+	require.Equal(t, "OK", status)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = avroipc.SendMessageContext(ctx, c, "append", datum)
+	require.Equal(t, context.Canceled, err)
+
+	require.NoError(t, c.Close())
+}
@@ -0,0 +1,602 @@
+// Package spool implements a durable write-ahead spool of records stored in
+// segmented append-only files.
+//
+// Every record is stored with its length and a CRC-32C checksum. Records are
+// read in the order they were written and are removed only after committing,
+// so a crash may lead to reading the same records again but never to losing
+// committed writes.
+package spool
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/myzhan/avroipc/logger"
+)
+
+// ErrFull is returned by the Write method when the spool reaches its maximum
+// size.
+var ErrFull = errors.New("spool is full")
+
+// ErrClosed is returned by methods of a closed spool.
+var ErrClosed = errors.New("spool is closed")
+
+var errCorrupted = errors.New("corrupted record")
+
+const (
+	headerSize    = 8
+	segmentSuffix = ".seg"
+	cursorFile    = "cursor"
+)
+
+var table = crc32.MakeTable(crc32.Castagnoli)
+
+// SyncPolicy defines when written data is flushed to the disk.
+type SyncPolicy int
+
+const (
+	// Flush data periodically with the SyncInterval.
+	SyncPeriodic SyncPolicy = iota
+	// Flush data after every write and commit.
+	SyncAlways
+	// Never flush data explicitly and rely on the operating system.
+	SyncNever
+)
+
+// Config provides a configuration for the spool.
+type Config struct {
+	// A maximum size of a single segment file in bytes. A larger record is
+	// written to a separate segment.
+	//
+	// Defaults to zero which means that 64 MiB will be used.
+	SegmentSize int64
+	// A maximum total size of records that are not committed yet in bytes
+	// including headers of records.
+	//
+	// Defaults to zero which means no limit.
+	MaxSize int64
+
+	// A policy of flushing data to the disk.
+	//
+	// Defaults to SyncPeriodic.
+	Sync SyncPolicy
+	// An interval of flushing data to the disk for the SyncPeriodic policy.
+	//
+	// Defaults to zero which means that one second will be used.
+	SyncInterval time.Duration
+
+	// A logger for warnings about recovered and corrupted segments.
+	//
+	// Defaults to nil which means that messages are discarded.
+	Logger logger.Logger
+}
+
+type position struct {
+	segment uint64
+	offset  int64
+}
+
+// Spool is a durable queue of records. It is safe for concurrent use.
+type Spool struct {
+	dir         string
+	segmentSize int64
+	maxSize     int64
+	sync        SyncPolicy
+	logger      logger.Logger
+
+	mu       sync.Mutex
+	closed   bool
+	segments []uint64
+	sizes    map[uint64]int64
+	w        *os.File
+	dirty    bool
+
+	cursor  position
+	pending position
+
+	r        *os.File
+	rSegment uint64
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// Open opens a spool in the directory creating it if necessary. Incomplete
+// records at the end of the last segment that may be left after a crash are
+// truncated.
+func Open(dir string, config *Config) (*Spool, error) {
+	s := &Spool{
+		dir:         dir,
+		segmentSize: 64 << 20,
+		maxSize:     config.MaxSize,
+		sync:        config.Sync,
+		logger:      logger.OrNop(config.Logger).With("spool", dir),
+		sizes:       make(map[uint64]int64),
+		done:        make(chan struct{}),
+	}
+	if config.SegmentSize > 0 {
+		s.segmentSize = config.SegmentSize
+	}
+
+	err := s.recover()
+	if err != nil {
+		s.closeFiles()
+		return nil, err
+	}
+
+	if s.sync == SyncPeriodic {
+		interval := time.Second
+		if config.SyncInterval > 0 {
+			interval = config.SyncInterval
+		}
+		s.wg.Add(1)
+		go s.syncPeriodically(interval)
+	}
+
+	return s, nil
+}
+
+func (s *Spool) recover() error {
+	err := os.MkdirAll(s.dir, 0755)
+	if err != nil {
+		return err
+	}
+
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		name := e.Name()
+		if !strings.HasSuffix(name, segmentSuffix) {
+			continue
+		}
+		id, err := strconv.ParseUint(strings.TrimSuffix(name, segmentSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		s.segments = append(s.segments, id)
+	}
+	sort.Slice(s.segments, func(i, j int) bool { return s.segments[i] < s.segments[j] })
+
+	s.cursor = s.readCursor()
+
+	// Remove segments that are consumed completely.
+	for len(s.segments) > 0 && s.segments[0] < s.cursor.segment {
+		err = os.Remove(s.segmentPath(s.segments[0]))
+		if err != nil {
+			return err
+		}
+		s.segments = s.segments[1:]
+	}
+	if len(s.segments) == 0 {
+		s.cursor.offset = 0
+		s.pending = s.cursor
+		return s.rotate(s.cursor.segment)
+	}
+	if s.segments[0] > s.cursor.segment {
+		s.cursor = position{segment: s.segments[0]}
+	}
+
+	for _, id := range s.segments {
+		info, err := os.Stat(s.segmentPath(id))
+		if err != nil {
+			return err
+		}
+		s.sizes[id] = info.Size()
+	}
+
+	last := s.segments[len(s.segments)-1]
+	s.w, err = os.OpenFile(s.segmentPath(last), os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+
+	// Find the end of the last complete record of the last segment.
+	end := int64(0)
+	for {
+		_, next, err := readRecord(s.w, end, s.sizes[last])
+		if err != nil {
+			break
+		}
+		end = next
+	}
+	if end < s.sizes[last] {
+		s.logger.Warn("truncating incomplete records", "segment", last, "size", s.sizes[last], "end", end)
+		err = s.w.Truncate(end)
+		if err != nil {
+			return err
+		}
+		s.sizes[last] = end
+	}
+	if s.cursor.segment == last && s.cursor.offset > end {
+		s.cursor.offset = end
+	}
+
+	_, err = s.w.Seek(end, io.SeekStart)
+	if err != nil {
+		return err
+	}
+	s.pending = s.cursor
+
+	return nil
+}
+
+// Write appends a record to the spool.
+func (s *Spool) Write(record []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return ErrClosed
+	}
+
+	size := int64(headerSize + len(record))
+	if s.maxSize > 0 && s.uncommitted()+size > s.maxSize {
+		return ErrFull
+	}
+
+	last := s.segments[len(s.segments)-1]
+	if s.sizes[last] > 0 && s.sizes[last]+size > s.segmentSize {
+		err := s.rotate(last + 1)
+		if err != nil {
+			return err
+		}
+		last++
+	}
+
+	buf := make([]byte, size)
+	binary.BigEndian.PutUint32(buf[0:4], uint32(len(record)))
+	binary.BigEndian.PutUint32(buf[4:8], crc32.Checksum(record, table))
+	copy(buf[headerSize:], record)
+
+	_, err := s.w.Write(buf)
+	if err != nil {
+		// Drop a partially written record, otherwise the next records are
+		// written after it and cannot be read.
+		prev := s.sizes[last]
+		if truncErr := s.w.Truncate(prev); truncErr != nil {
+			return errors.Join(err, truncErr)
+		}
+		if _, seekErr := s.w.Seek(prev, io.SeekStart); seekErr != nil {
+			return errors.Join(err, seekErr)
+		}
+		return err
+	}
+	s.sizes[last] += size
+	s.dirty = true
+
+	if s.sync == SyncAlways {
+		return s.flush()
+	}
+
+	return nil
+}
+
+// Peek returns up to n oldest records that are not committed yet. It returns
+// the same records until they are committed.
+func (s *Spool) Peek(n int) ([][]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return nil, ErrClosed
+	}
+
+	var records [][]byte
+	pos := s.cursor
+	for len(records) < n {
+		if pos.offset >= s.sizes[pos.segment] {
+			next, ok := s.next(pos.segment)
+			if !ok {
+				break
+			}
+			pos = position{segment: next}
+			continue
+		}
+
+		r, err := s.reader(pos.segment)
+		if err != nil {
+			return nil, err
+		}
+
+		record, next, err := readRecord(r, pos.offset, s.sizes[pos.segment])
+		if err == errCorrupted || err == io.ErrUnexpectedEOF {
+			// Skip the rest of the corrupted segment, records after a
+			// corrupted length cannot be found anyway.
+			s.logger.Warn("skipping corrupted segment", "segment", pos.segment, "offset", pos.offset)
+			if pos.segment == s.segments[len(s.segments)-1] {
+				err = s.rotate(pos.segment + 1)
+				if err != nil {
+					return nil, err
+				}
+			}
+			pos = position{segment: pos.segment, offset: s.sizes[pos.segment]}
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		records = append(records, record)
+		pos.offset = next
+	}
+	s.pending = pos
+
+	return records, nil
+}
+
+// Commit removes records returned by the last Peek call from the spool.
+func (s *Spool) Commit() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return ErrClosed
+	}
+
+	s.cursor = s.pending
+
+	// Start a new segment when all records are committed, so the committed
+	// segment is removed below instead of growing forever.
+	last := s.segments[len(s.segments)-1]
+	if s.cursor.segment == last && s.cursor.offset >= s.sizes[last] && s.sizes[last] > 0 {
+		err := s.rotate(last + 1)
+		if err != nil {
+			return err
+		}
+		s.cursor = position{segment: last + 1}
+		s.pending = s.cursor
+	}
+
+	for len(s.segments) > 1 && s.segments[0] < s.cursor.segment {
+		id := s.segments[0]
+		if s.r != nil && s.rSegment == id {
+			_ = s.r.Close()
+			s.r = nil
+		}
+		err := os.Remove(s.segmentPath(id))
+		if err != nil {
+			return err
+		}
+		delete(s.sizes, id)
+		s.segments = s.segments[1:]
+	}
+
+	return s.writeCursor()
+}
+
+// Empty reports whether all records are committed.
+func (s *Spool) Empty() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	last := s.segments[len(s.segments)-1]
+	return s.cursor.segment == last && s.cursor.offset >= s.sizes[last]
+}
+
+// Size returns the total size of all segments in bytes including committed
+// records of segments that are not removed yet.
+func (s *Spool) Size() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.size()
+}
+
+// Close flushes written data to the disk and closes the spool.
+func (s *Spool) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	close(s.done)
+
+	err := s.flush()
+	s.closeFiles()
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	return err
+}
+
+func (s *Spool) size() int64 {
+	total := int64(0)
+	for _, size := range s.sizes {
+		total += size
+	}
+	return total
+}
+
+// uncommitted returns the size of records after the cursor.
+func (s *Spool) uncommitted() int64 {
+	total := s.sizes[s.cursor.segment] - s.cursor.offset
+	for id, size := range s.sizes {
+		if id > s.cursor.segment {
+			total += size
+		}
+	}
+	return total
+}
+
+func (s *Spool) next(id uint64) (uint64, bool) {
+	for _, segment := range s.segments {
+		if segment > id {
+			return segment, true
+		}
+	}
+	return 0, false
+}
+
+func (s *Spool) reader(id uint64) (*os.File, error) {
+	if s.r != nil && s.rSegment == id {
+		return s.r, nil
+	}
+	if s.r != nil {
+		_ = s.r.Close()
+		s.r = nil
+	}
+
+	r, err := os.Open(s.segmentPath(id))
+	if err != nil {
+		return nil, err
+	}
+	s.r, s.rSegment = r, id
+	return r, nil
+}
+
+func (s *Spool) rotate(id uint64) error {
+	if s.w != nil {
+		err := s.flush()
+		if err != nil {
+			return err
+		}
+		_ = s.w.Close()
+		s.w = nil
+	}
+
+	w, err := os.OpenFile(s.segmentPath(id), os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	s.w = w
+	s.segments = append(s.segments, id)
+	s.sizes[id] = 0
+
+	return nil
+}
+
+func (s *Spool) flush() error {
+	if !s.dirty || s.sync == SyncNever || s.w == nil {
+		return nil
+	}
+	s.dirty = false
+
+	return s.w.Sync()
+}
+
+func (s *Spool) syncPeriodically(interval time.Duration) {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			s.mu.Lock()
+			err := s.flush()
+			s.mu.Unlock()
+			if err != nil {
+				s.logger.Error("cannot flush spool", "error", err)
+			}
+		}
+	}
+}
+
+func (s *Spool) closeFiles() {
+	if s.w != nil {
+		_ = s.w.Close()
+		s.w = nil
+	}
+	if s.r != nil {
+		_ = s.r.Close()
+		s.r = nil
+	}
+}
+
+func (s *Spool) segmentPath(id uint64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%020d%s", id, segmentSuffix))
+}
+
+// readCursor reads the position of the first uncommitted record. A missing
+// or corrupted cursor means that all records are uncommitted.
+func (s *Spool) readCursor() position {
+	b, err := os.ReadFile(filepath.Join(s.dir, cursorFile))
+	if err != nil || len(b) != 20 || crc32.Checksum(b[:16], table) != binary.BigEndian.Uint32(b[16:]) {
+		if !os.IsNotExist(err) {
+			s.logger.Warn("ignoring corrupted cursor")
+		}
+		return position{}
+	}
+
+	return position{
+		segment: binary.BigEndian.Uint64(b[0:8]),
+		offset:  int64(binary.BigEndian.Uint64(b[8:16])),
+	}
+}
+
+// writeCursor replaces the cursor file atomically.
+func (s *Spool) writeCursor() error {
+	b := make([]byte, 20)
+	binary.BigEndian.PutUint64(b[0:8], s.cursor.segment)
+	binary.BigEndian.PutUint64(b[8:16], uint64(s.cursor.offset))
+	binary.BigEndian.PutUint32(b[16:20], crc32.Checksum(b[:16], table))
+
+	path := filepath.Join(s.dir, cursorFile)
+	f, err := os.Create(path + ".tmp")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(b)
+	if err == nil && s.sync == SyncAlways {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(path+".tmp", path)
+}
+
+// readRecord reads a record at the offset of a segment of the specified size
+// and returns it with the offset of the next record. It returns io.EOF if
+// there are no more records and io.ErrUnexpectedEOF if the record is
+// incomplete.
+func readRecord(r io.ReaderAt, offset, size int64) ([]byte, int64, error) {
+	header := make([]byte, headerSize)
+	n, err := r.ReadAt(header, offset)
+	if n == 0 && err == io.EOF {
+		return nil, offset, io.EOF
+	}
+	if n < headerSize {
+		return nil, offset, io.ErrUnexpectedEOF
+	}
+
+	// Check the length before allocating memory because it may be corrupted.
+	length := int64(binary.BigEndian.Uint32(header[0:4]))
+	if offset+headerSize+length > size {
+		return nil, offset, io.ErrUnexpectedEOF
+	}
+
+	record := make([]byte, length)
+	n, err = r.ReadAt(record, offset+headerSize)
+	if n < len(record) {
+		if err == io.EOF {
+			return nil, offset, io.ErrUnexpectedEOF
+		}
+		return nil, offset, err
+	}
+	if crc32.Checksum(record, table) != binary.BigEndian.Uint32(header[4:8]) {
+		return nil, offset, errCorrupted
+	}
+
+	return record, offset + headerSize + int64(len(record)), nil
+}
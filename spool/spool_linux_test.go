@@ -0,0 +1,47 @@
+//go:build linux
+
+package spool_test
+
+import (
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/myzhan/avroipc/spool"
+)
+
+// limitFileSize limits sizes of files written by the process. Writes beyond
+// the limit are written partially and fail because the Go runtime ignores the
+// SIGXFSZ signal.
+func limitFileSize(t *testing.T, size uint64) {
+	var prev syscall.Rlimit
+	require.NoError(t, syscall.Getrlimit(syscall.RLIMIT_FSIZE, &prev))
+
+	limit := prev
+	limit.Cur = size
+	require.NoError(t, syscall.Setrlimit(syscall.RLIMIT_FSIZE, &limit))
+	t.Cleanup(func() {
+		require.NoError(t, syscall.Setrlimit(syscall.RLIMIT_FSIZE, &prev))
+	})
+}
+
+func TestSpool_partialWrite(t *testing.T) {
+	dir := t.TempDir()
+	s := prepareSpool(t, dir, &spool.Config{})
+	write(t, s, "a")
+
+	t.Run("failed", func(t *testing.T) {
+		limitFileSize(t, uint64(s.Size())+4)
+		require.Error(t, s.Write([]byte(strings.Repeat("b", 100))))
+	})
+	require.Equal(t, int64(9), s.Size())
+
+	// The next record is written right after the last complete one.
+	write(t, s, "c")
+	require.NoError(t, s.Close())
+
+	s = prepareSpool(t, dir, &spool.Config{})
+	require.Equal(t, []string{"a", "c"}, peek(t, s, 10))
+}
@@ -0,0 +1,196 @@
+package spool_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/myzhan/avroipc/spool"
+)
+
+func prepareSpool(t *testing.T, dir string, config *spool.Config) *spool.Spool {
+	s, err := spool.Open(dir, config)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = s.Close()
+	})
+
+	return s
+}
+
+func write(t *testing.T, s *spool.Spool, records ...string) {
+	for _, r := range records {
+		require.NoError(t, s.Write([]byte(r)))
+	}
+}
+
+func peek(t *testing.T, s *spool.Spool, n int) []string {
+	records, err := s.Peek(n)
+	require.NoError(t, err)
+
+	result := make([]string, 0)
+	for _, r := range records {
+		result = append(result, string(r))
+	}
+	return result
+}
+
+func segments(t *testing.T, dir string) []string {
+	files, err := filepath.Glob(filepath.Join(dir, "*.seg"))
+	require.NoError(t, err)
+	return files
+}
+
+func TestSpool(t *testing.T) {
+	t.Run("write and commit", func(t *testing.T) {
+		s := prepareSpool(t, t.TempDir(), &spool.Config{})
+		require.True(t, s.Empty())
+
+		write(t, s, "a", "b", "c")
+		require.False(t, s.Empty())
+		require.Equal(t, int64(27), s.Size())
+
+		require.Equal(t, []string{"a", "b"}, peek(t, s, 2))
+		// Records are returned again until they are committed.
+		require.Equal(t, []string{"a", "b"}, peek(t, s, 2))
+		require.NoError(t, s.Commit())
+
+		require.Equal(t, []string{"c"}, peek(t, s, 2))
+		require.NoError(t, s.Commit())
+		require.True(t, s.Empty())
+		require.Empty(t, peek(t, s, 2))
+
+		require.NoError(t, s.Close())
+		require.Equal(t, spool.ErrClosed, s.Write([]byte("d")))
+		_, err := s.Peek(1)
+		require.Equal(t, spool.ErrClosed, err)
+	})
+
+	t.Run("reopen", func(t *testing.T) {
+		dir := t.TempDir()
+		s := prepareSpool(t, dir, &spool.Config{Sync: spool.SyncAlways})
+
+		write(t, s, "a", "b", "c")
+		require.Equal(t, []string{"a"}, peek(t, s, 1))
+		require.NoError(t, s.Commit())
+		// Not committed records are read again after reopening.
+		require.Equal(t, []string{"b"}, peek(t, s, 1))
+		require.NoError(t, s.Close())
+
+		s = prepareSpool(t, dir, &spool.Config{})
+		require.Equal(t, []string{"b", "c"}, peek(t, s, 10))
+
+		write(t, s, "d")
+		require.Equal(t, []string{"b", "c", "d"}, peek(t, s, 10))
+	})
+
+	t.Run("segments", func(t *testing.T) {
+		dir := t.TempDir()
+		s := prepareSpool(t, dir, &spool.Config{SegmentSize: 24, Sync: spool.SyncNever})
+
+		write(t, s, "aaaa", "bbbb", "cccc", "dddddddddddddddddddd")
+		require.Len(t, segments(t, dir), 3)
+
+		require.Equal(t, []string{"aaaa", "bbbb", "cccc"}, peek(t, s, 3))
+		require.NoError(t, s.Commit())
+		require.Len(t, segments(t, dir), 2)
+
+		require.Equal(t, []string{"dddddddddddddddddddd"}, peek(t, s, 3))
+		require.NoError(t, s.Commit())
+		// The last segment is kept for next writes.
+		require.Len(t, segments(t, dir), 1)
+		require.True(t, s.Empty())
+	})
+
+	t.Run("max size", func(t *testing.T) {
+		s := prepareSpool(t, t.TempDir(), &spool.Config{MaxSize: 20})
+
+		write(t, s, "a", "b")
+		require.Equal(t, spool.ErrFull, s.Write([]byte("c")))
+
+		// Space of committed records is available immediately.
+		peek(t, s, 1)
+		require.NoError(t, s.Commit())
+		write(t, s, "c")
+		require.Equal(t, spool.ErrFull, s.Write([]byte("d")))
+
+		require.Equal(t, []string{"b", "c"}, peek(t, s, 2))
+		require.NoError(t, s.Commit())
+		write(t, s, "d", "e")
+		require.Equal(t, []string{"d", "e"}, peek(t, s, 2))
+	})
+
+	t.Run("committed segment", func(t *testing.T) {
+		dir := t.TempDir()
+		s := prepareSpool(t, dir, &spool.Config{})
+
+		write(t, s, "a", "b")
+		peek(t, s, 2)
+		require.NoError(t, s.Commit())
+		// A segment is replaced with a new one when all its records are
+		// committed.
+		require.Equal(t, int64(0), s.Size())
+		require.Len(t, segments(t, dir), 1)
+
+		write(t, s, "c")
+		require.NoError(t, s.Close())
+
+		s = prepareSpool(t, dir, &spool.Config{})
+		require.Equal(t, []string{"c"}, peek(t, s, 10))
+	})
+
+	t.Run("incomplete record", func(t *testing.T) {
+		dir := t.TempDir()
+		s := prepareSpool(t, dir, &spool.Config{})
+		write(t, s, "a", "b")
+		require.NoError(t, s.Close())
+
+		// Emulate a crash in the middle of writing a record.
+		path := segments(t, dir)[0]
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+		require.NoError(t, err)
+		_, err = f.Write([]byte{0x0, 0x0, 0x0, 0x5, 0x1, 0x2})
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+
+		s = prepareSpool(t, dir, &spool.Config{})
+		require.Equal(t, int64(18), s.Size())
+
+		write(t, s, "c")
+		require.Equal(t, []string{"a", "b", "c"}, peek(t, s, 10))
+	})
+
+	t.Run("corrupted record", func(t *testing.T) {
+		dir := t.TempDir()
+		s := prepareSpool(t, dir, &spool.Config{SegmentSize: 24})
+		write(t, s, "aaaa", "bbbb", "cccc")
+		require.NoError(t, s.Close())
+
+		// Corrupt the second record of the first segment.
+		path := segments(t, dir)[0]
+		b, err := os.ReadFile(path)
+		require.NoError(t, err)
+		b[len(b)-1] ^= 0x1
+		require.NoError(t, os.WriteFile(path, b, 0644))
+
+		s = prepareSpool(t, dir, &spool.Config{SegmentSize: 24})
+		require.Equal(t, []string{"aaaa", "cccc"}, peek(t, s, 10))
+	})
+
+	t.Run("corrupted cursor", func(t *testing.T) {
+		dir := t.TempDir()
+		s := prepareSpool(t, dir, &spool.Config{})
+		write(t, s, "a", "b")
+		peek(t, s, 1)
+		require.NoError(t, s.Commit())
+		require.NoError(t, s.Close())
+
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "cursor"), []byte("bad"), 0644))
+
+		// All records are read again.
+		s = prepareSpool(t, dir, &spool.Config{})
+		require.Equal(t, []string{"a", "b"}, peek(t, s, 10))
+	})
+}
@@ -0,0 +1,11 @@
+//go:build !unix
+
+package tail
+
+import "os"
+
+// fileID returns zero because there is no portable file identity, so
+// replaced files are only detected by their sizes after restarts.
+func fileID(os.FileInfo) uint64 {
+	return 0
+}
@@ -0,0 +1,17 @@
+//go:build unix
+
+package tail
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileID returns the inode number of the file. It is used to detect files
+// replaced while the tailer was not running.
+func fileID(fi os.FileInfo) uint64 {
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+		return uint64(st.Ino)
+	}
+	return 0
+}
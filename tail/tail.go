@@ -0,0 +1,515 @@
+// Package tail follows growing files and ships their lines to Flume.
+//
+// Lines are delivered with at-least-once semantics: read offsets are
+// persisted in a checkpoint file only after batches are accepted by the
+// agent, so lines sent just before a crash may be sent again after a restart
+// but never lost. Rotated files are read to the end before switching to new
+// files and truncated files are read from the beginning.
+package tail
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/myzhan/avroipc/flume"
+	"github.com/myzhan/avroipc/logger"
+)
+
+// A minimum interval between repeated warnings about a file that cannot be
+// opened.
+const openWarningInterval = time.Minute
+
+// Headers of events created from lines.
+const (
+	// A path of the file as it is matched by patterns.
+	HeaderFile = "file"
+	// A byte offset of the line in the file.
+	HeaderOffset = "offset"
+)
+
+// Config provides a configuration for the tailer.
+type Config struct {
+	// Paths of followed files. Glob patterns as supported by filepath.Glob
+	// are expanded on every poll, so new files are picked up automatically.
+	Files []string
+
+	// A path of the file with read offsets. Files are read from the
+	// beginning if the file cannot be read or is corrupted.
+	//
+	// Defaults to empty which means that offsets are not persisted and files
+	// are read according to the SkipToEnd option after every start.
+	Checkpoint string
+
+	// Whether files without checkpoints should be read from the end. Files
+	// appearing while the tailer is running are always read from the
+	// beginning.
+	//
+	// Defaults to false which means that files are read from the beginning.
+	SkipToEnd bool
+
+	// An interval of checking files for new lines and retrying failed
+	// batches.
+	//
+	// Defaults to zero which means that 250 milliseconds will be used.
+	PollInterval time.Duration
+
+	// A maximum number of lines in a single batch.
+	//
+	// Defaults to zero which means that 100 lines will be used.
+	BatchSize int
+
+	// A maximum size of a single line in bytes. Longer lines are split into
+	// several events.
+	//
+	// Defaults to zero which means that 1 MiB will be used.
+	MaxLineSize int
+
+	// Headers attached to every event along with the file and the offset.
+	//
+	// Defaults to nil which means no additional headers.
+	Headers map[string]string
+
+	// A logger for failed batches and rotations.
+	//
+	// Defaults to nil which means that messages are discarded.
+	Logger logger.Logger
+}
+
+// followed is a state of a single followed path.
+type followed struct {
+	path   string
+	f      *os.File
+	info   os.FileInfo
+	offset int64
+}
+
+// checkpoint is a persisted read offset of a file.
+type checkpoint struct {
+	Path   string `json:"path"`
+	ID     uint64 `json:"id"`
+	Offset int64  `json:"offset"`
+}
+
+// Tailer follows files and sends their lines to Flume.
+type Tailer struct {
+	client flume.Client
+
+	files        []string
+	checkpoint   string
+	pollInterval time.Duration
+	batchSize    int
+	maxLineSize  int
+	headers      map[string]string
+	logger       logger.Logger
+
+	// Offsets restored from the checkpoint file for files that are not
+	// opened yet.
+	restored map[string]checkpoint
+	// Whether files found on the first poll should be read from the end.
+	skipToEnd bool
+
+	followed map[string]*followed
+	// Times of the last warnings about files that cannot be opened.
+	openWarnings map[string]time.Time
+}
+
+// New creates a tailer that sends lines through the passed client and reads
+// the checkpoint file if it exists. The tailer doesn't close the client.
+func New(client flume.Client, config *Config) (*Tailer, error) {
+	t := &Tailer{
+		client:       client,
+		files:        config.Files,
+		checkpoint:   config.Checkpoint,
+		pollInterval: 250 * time.Millisecond,
+		batchSize:    100,
+		maxLineSize:  1 << 20,
+		headers:      config.Headers,
+		logger:       logger.OrNop(config.Logger),
+		restored:     make(map[string]checkpoint),
+		skipToEnd:    config.SkipToEnd,
+		followed:     make(map[string]*followed),
+		openWarnings: make(map[string]time.Time),
+	}
+	if config.PollInterval > 0 {
+		t.pollInterval = config.PollInterval
+	}
+	if config.BatchSize > 0 {
+		t.batchSize = config.BatchSize
+	}
+	if config.MaxLineSize > 0 {
+		t.maxLineSize = config.MaxLineSize
+	}
+
+	if t.checkpoint != "" {
+		t.readCheckpoint()
+	}
+
+	return t, nil
+}
+
+// readCheckpoint restores offsets from the checkpoint file. An unreadable or
+// corrupted checkpoint means that all files are read from the beginning, so
+// lines may be sent again but are never lost.
+func (t *Tailer) readCheckpoint() {
+	b, err := os.ReadFile(t.checkpoint)
+	if errors.Is(err, os.ErrNotExist) {
+		return
+	}
+
+	var checkpoints []checkpoint
+	if err == nil {
+		err = json.Unmarshal(b, &checkpoints)
+	}
+	if err != nil {
+		t.logger.Warn("ignoring unreadable checkpoint", "checkpoint", t.checkpoint, "error", err)
+		t.skipToEnd = false
+		return
+	}
+
+	for _, c := range checkpoints {
+		t.restored[c.Path] = c
+	}
+}
+
+// Run follows files until the context is done and returns the error of the
+// context. Failed batches are retried with the poll interval. All files are
+// closed on return.
+func (t *Tailer) Run(ctx context.Context) error {
+	defer t.close()
+
+	ticker := time.NewTicker(t.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		err := t.Poll(ctx)
+		if err != nil && ctx.Err() == nil {
+			t.logger.Warn("lines are not delivered", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Poll checks files once and sends all their complete lines. A failure of a
+// file stops reading only this file, its failed batch will be sent again on
+// the next poll. Errors of all failed files are joined.
+func (t *Tailer) Poll(ctx context.Context) error {
+	paths, err := t.expand()
+	if err != nil {
+		return err
+	}
+
+	matched := make(map[string]bool, len(paths))
+	for _, path := range paths {
+		matched[path] = true
+		if t.followed[path] == nil {
+			err = t.open(path)
+			if err != nil {
+				t.warnOpen(path, err)
+			} else {
+				delete(t.openWarnings, path)
+			}
+		}
+	}
+	t.skipToEnd = false
+
+	// Offsets of files that are removed since the last checkpoint are not
+	// needed anymore.
+	for path := range t.restored {
+		if !matched[path] {
+			delete(t.restored, path)
+		}
+	}
+	for path := range t.openWarnings {
+		if !matched[path] {
+			delete(t.openWarnings, path)
+		}
+	}
+
+	var errs []error
+	for _, path := range sortedKeys(t.followed) {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		err = t.follow(ctx, t.followed[path])
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", path, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Close closes all followed files. It is called by the Run method and should
+// be used only after calls of the Poll method.
+func (t *Tailer) Close() error {
+	t.close()
+	return nil
+}
+
+func (t *Tailer) expand() ([]string, error) {
+	seen := make(map[string]bool)
+	var paths []string
+	for _, pattern := range t.files {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range matches {
+			if !seen[m] {
+				seen[m] = true
+				paths = append(paths, m)
+			}
+		}
+	}
+
+	return paths, nil
+}
+
+// warnOpen logs that the file cannot be opened unless it is already logged
+// recently.
+func (t *Tailer) warnOpen(path string, err error) {
+	if last, ok := t.openWarnings[path]; ok && time.Since(last) < openWarningInterval {
+		return
+	}
+	t.openWarnings[path] = time.Now()
+	t.logger.Warn("cannot open file", "file", path, "error", err)
+}
+
+// open starts following the path from the restored offset, the end of the
+// file or its beginning.
+func (t *Tailer) open(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	s := &followed{path: path, f: f, info: info}
+	if c, ok := t.restored[path]; ok {
+		delete(t.restored, path)
+		if (c.ID == 0 || c.ID == fileID(info)) && c.Offset <= info.Size() {
+			s.offset = c.Offset
+		} else {
+			t.logger.Info("file is replaced since the last checkpoint", "file", path)
+		}
+	} else if t.skipToEnd {
+		s.offset = info.Size()
+	}
+
+	t.followed[path] = s
+	return nil
+}
+
+// follow sends new lines of the file and handles its rotation and truncation.
+func (t *Tailer) follow(ctx context.Context, s *followed) error {
+	current, statErr := os.Stat(s.path)
+	rotated := statErr != nil || !os.SameFile(s.info, current)
+
+	info, err := s.f.Stat()
+	if err != nil {
+		return err
+	}
+	if !rotated && info.Size() < s.offset {
+		t.logger.Info("file is truncated", "file", s.path)
+		s.offset = 0
+		err = t.save()
+		if err != nil {
+			return err
+		}
+	}
+
+	for {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		// The last incomplete line of a rotated file will never be
+		// completed, so it is sent as is.
+		events, offset, err := t.read(s, rotated)
+		if err != nil {
+			return err
+		}
+		if len(events) == 0 {
+			s.offset = offset
+			break
+		}
+
+		status, err := flume.AppendBatchContext(ctx, t.client, events)
+		if err == nil && flume.Status(status) != flume.StatusOK {
+			err = &flume.StatusError{Status: flume.Status(status)}
+		}
+		if err != nil {
+			return err
+		}
+
+		s.offset = offset
+		err = t.save()
+		if err != nil {
+			return err
+		}
+	}
+
+	if rotated {
+		t.logger.Info("file is rotated", "file", s.path)
+		_ = s.f.Close()
+		delete(t.followed, s.path)
+		err = t.save()
+		if err != nil {
+			return err
+		}
+		// The new file is read from the beginning.
+		if statErr == nil {
+			err = t.open(s.path)
+			if err != nil {
+				return err
+			}
+			return t.follow(ctx, t.followed[s.path])
+		}
+	}
+
+	return nil
+}
+
+// read reads up to the batch size lines starting at the offset of the file
+// and returns events and the offset after them. Incomplete lines are kept
+// unless the final flag is set.
+func (t *Tailer) read(s *followed, final bool) ([]*flume.Event, int64, error) {
+	r := bufio.NewReader(io.NewSectionReader(s.f, s.offset, math.MaxInt64-s.offset))
+
+	var events []*flume.Event
+	offset := s.offset
+	for len(events) < t.batchSize {
+		line, split, err := readLine(r, t.maxLineSize)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return nil, s.offset, err
+		}
+		if len(line) == 0 || (errors.Is(err, io.EOF) && !final) {
+			// The line is not complete yet.
+			break
+		}
+
+		body := bytes.TrimSuffix(bytes.TrimSuffix(line, []byte("\n")), []byte("\r"))
+		if len(body) > 0 {
+			events = append(events, t.event(s.path, offset, body))
+		}
+		offset += int64(len(line))
+
+		// The reader is ahead of the split line, so the rest of the line is
+		// read by a new reader of the next batch.
+		if split {
+			break
+		}
+	}
+
+	return events, offset, nil
+}
+
+// readLine reads a line including the newline. Lines longer than the limit
+// are split and only the first part of the limit size is returned. The
+// io.EOF error is returned if the line is not terminated by the newline.
+func readLine(r *bufio.Reader, limit int) ([]byte, bool, error) {
+	var line []byte
+	for {
+		chunk, err := r.ReadSlice('\n')
+		if len(line)+len(chunk) > limit {
+			return append(line, chunk[:limit-len(line)]...), true, nil
+		}
+		line = append(line, chunk...)
+		if !errors.Is(err, bufio.ErrBufferFull) {
+			return line, false, err
+		}
+	}
+}
+
+func (t *Tailer) event(path string, offset int64, body []byte) *flume.Event {
+	headers := make(map[string]string, len(t.headers)+2)
+	for k, v := range t.headers {
+		headers[k] = v
+	}
+	headers[HeaderFile] = path
+	headers[HeaderOffset] = strconv.FormatInt(offset, 10)
+
+	return &flume.Event{
+		Headers: headers,
+		Body:    append([]byte(nil), body...),
+	}
+}
+
+// save replaces the checkpoint file atomically with offsets of all followed
+// files and restored offsets of files that are not opened yet.
+func (t *Tailer) save() error {
+	if t.checkpoint == "" {
+		return nil
+	}
+
+	checkpoints := make([]checkpoint, 0, len(t.followed)+len(t.restored))
+	for _, path := range sortedKeys(t.followed) {
+		s := t.followed[path]
+		checkpoints = append(checkpoints, checkpoint{Path: path, ID: fileID(s.info), Offset: s.offset})
+	}
+	for _, c := range t.restored {
+		checkpoints = append(checkpoints, c)
+	}
+
+	b, err := json.Marshal(checkpoints)
+	if err != nil {
+		return err
+	}
+
+	// The temporary file is synced before renaming, otherwise the checkpoint
+	// may be replaced with an empty file after a crash.
+	tmp := t.checkpoint + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(b)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, t.checkpoint)
+}
+
+func (t *Tailer) close() {
+	for path, s := range t.followed {
+		_ = s.f.Close()
+		delete(t.followed, path)
+	}
+}
+
+func sortedKeys(m map[string]*followed) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
@@ -0,0 +1,260 @@
+package tail_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/myzhan/avroipc/flume"
+	"github.com/myzhan/avroipc/flumetest"
+	"github.com/myzhan/avroipc/logger"
+	"github.com/myzhan/avroipc/tail"
+)
+
+func appendFile(t *testing.T, path, data string) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	require.NoError(t, err)
+	_, err = f.WriteString(data)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+}
+
+func prepareTailer(t *testing.T, a *flumetest.Agent, config *tail.Config) *tail.Tailer {
+	x, err := tail.New(a.NewClient(t, nil), config)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = x.Close() })
+
+	return x
+}
+
+func TestTailer(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("lines", func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "a.log")
+		appendFile(t, path, "one\r\n\ntwo\nthr")
+
+		a := flumetest.NewAgent(t)
+		x := prepareTailer(t, a, &tail.Config{
+			Files:     []string{filepath.Join(dir, "*.log")},
+			BatchSize: 1,
+			Headers:   map[string]string{"host": "test"},
+		})
+
+		require.NoError(t, x.Poll(ctx))
+		a.RequireBodies(t, "one", "two")
+		require.Equal(t, map[string]string{"host": "test", "file": path, "offset": "6"}, a.Events()[1].Headers)
+
+		appendFile(t, path, "ee\n")
+		require.NoError(t, x.Poll(ctx))
+		a.RequireBodies(t, "one", "two", "three")
+		require.Len(t, a.Calls(), 3)
+	})
+
+	t.Run("long lines", func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "a.log")
+		appendFile(t, path, "abcdefg\nhi\n")
+
+		a := flumetest.NewAgent(t)
+		x := prepareTailer(t, a, &tail.Config{Files: []string{path}, MaxLineSize: 3})
+
+		require.NoError(t, x.Poll(ctx))
+		a.RequireBodies(t, "abc", "def", "g", "hi")
+	})
+
+	t.Run("checkpoint", func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "a.log")
+		checkpoint := filepath.Join(dir, "checkpoint.json")
+		appendFile(t, path, "one\n")
+
+		a := flumetest.NewAgent(t)
+		config := &tail.Config{Files: []string{path}, Checkpoint: checkpoint}
+		x := prepareTailer(t, a, config)
+		require.NoError(t, x.Poll(ctx))
+		require.NoError(t, x.Close())
+
+		appendFile(t, path, "two\n")
+		x = prepareTailer(t, a, config)
+		require.NoError(t, x.Poll(ctx))
+		a.RequireBodies(t, "one", "two")
+	})
+
+	t.Run("failed batches retried", func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "a.log")
+		checkpoint := filepath.Join(dir, "checkpoint.json")
+		appendFile(t, path, "one\ntwo\n")
+
+		a := flumetest.NewAgent(t)
+		a.Script(flumetest.Reply{}, flumetest.Reply{Status: flume.StatusFailed})
+		config := &tail.Config{Files: []string{path}, Checkpoint: checkpoint, BatchSize: 1}
+		x := prepareTailer(t, a, config)
+
+		err := x.Poll(ctx)
+		var statusErr *flume.StatusError
+		require.ErrorAs(t, err, &statusErr)
+		require.Equal(t, flume.StatusFailed, statusErr.Status)
+		a.RequireBodies(t, "one")
+		require.NoError(t, x.Close())
+
+		// The failed line is sent again after a restart.
+		x = prepareTailer(t, a, config)
+		require.NoError(t, x.Poll(ctx))
+		a.RequireBodies(t, "one", "two")
+	})
+
+	t.Run("failed file", func(t *testing.T) {
+		dir := t.TempDir()
+		appendFile(t, filepath.Join(dir, "a.log"), "a\n")
+		appendFile(t, filepath.Join(dir, "b.log"), "b\n")
+
+		a := flumetest.NewAgent(t)
+		a.Script(flumetest.Reply{Status: flume.StatusFailed})
+		x := prepareTailer(t, a, &tail.Config{Files: []string{filepath.Join(dir, "*.log")}})
+
+		// Other files are read after the failure.
+		err := x.Poll(ctx)
+		require.ErrorContains(t, err, filepath.Join(dir, "a.log")+": unexpected status: FAILED")
+		a.RequireBodies(t, "b")
+
+		require.NoError(t, x.Poll(ctx))
+		a.RequireBodies(t, "b", "a")
+	})
+
+	t.Run("open warnings", func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "a.log")
+		require.NoError(t, os.Symlink(filepath.Join(dir, "missing"), path))
+
+		var buf bytes.Buffer
+		a := flumetest.NewAgent(t)
+		x := prepareTailer(t, a, &tail.Config{
+			Files:  []string{path},
+			Logger: logger.NewSlog(slog.New(slog.NewTextHandler(&buf, nil))),
+		})
+
+		require.NoError(t, x.Poll(ctx))
+		require.NoError(t, x.Poll(ctx))
+		require.Equal(t, 1, strings.Count(buf.String(), "cannot open file"))
+	})
+
+	t.Run("removed files", func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "a.log")
+		checkpoint := filepath.Join(dir, "checkpoint.json")
+		appendFile(t, path, "one\n")
+		require.NoError(t, os.WriteFile(checkpoint, []byte(`[{"path":"`+filepath.Join(dir, "b.log")+`","offset":1}]`), 0o644))
+
+		a := flumetest.NewAgent(t)
+		x := prepareTailer(t, a, &tail.Config{Files: []string{filepath.Join(dir, "*.log")}, Checkpoint: checkpoint})
+		require.NoError(t, x.Poll(ctx))
+
+		// The offset of the removed file is not saved again.
+		b, err := os.ReadFile(checkpoint)
+		require.NoError(t, err)
+		var checkpoints []map[string]interface{}
+		require.NoError(t, json.Unmarshal(b, &checkpoints))
+		require.Len(t, checkpoints, 1)
+		require.Equal(t, path, checkpoints[0]["path"])
+	})
+
+	t.Run("skip to end", func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "a.log")
+		appendFile(t, path, "old\n")
+
+		a := flumetest.NewAgent(t)
+		x := prepareTailer(t, a, &tail.Config{Files: []string{filepath.Join(dir, "*.log")}, SkipToEnd: true})
+		require.NoError(t, x.Poll(ctx))
+
+		appendFile(t, path, "new\n")
+		// Files appearing later are read from the beginning.
+		appendFile(t, filepath.Join(dir, "b.log"), "b\n")
+		require.NoError(t, x.Poll(ctx))
+		a.RequireBodies(t, "new", "b")
+	})
+
+	t.Run("rotation", func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "a.log")
+		appendFile(t, path, "one\n")
+
+		a := flumetest.NewAgent(t)
+		x := prepareTailer(t, a, &tail.Config{Files: []string{path}})
+		require.NoError(t, x.Poll(ctx))
+
+		// Lines written to the old file after the last poll are not lost.
+		appendFile(t, path, "two\nlast")
+		require.NoError(t, os.Rename(path, path+".1"))
+		appendFile(t, path, "three\n")
+
+		require.NoError(t, x.Poll(ctx))
+		a.RequireBodies(t, "one", "two", "last", "three")
+		require.Equal(t, "0", a.Events()[3].Headers["offset"])
+	})
+
+	t.Run("truncation", func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "a.log")
+		appendFile(t, path, "one\n")
+
+		a := flumetest.NewAgent(t)
+		x := prepareTailer(t, a, &tail.Config{Files: []string{path}})
+		require.NoError(t, x.Poll(ctx))
+
+		require.NoError(t, os.Truncate(path, 0))
+		appendFile(t, path, "2\n")
+		require.NoError(t, x.Poll(ctx))
+		a.RequireBodies(t, "one", "2")
+	})
+
+	t.Run("run", func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "a.log")
+
+		a := flumetest.NewAgent(t)
+		x := prepareTailer(t, a, &tail.Config{Files: []string{path}, PollInterval: time.Millisecond})
+
+		ctx, cancel := context.WithCancel(ctx)
+		done := make(chan error)
+		go func() { done <- x.Run(ctx) }()
+
+		appendFile(t, path, "one\n")
+		a.WaitForEvents(t, 1, time.Second)
+		cancel()
+		require.Equal(t, context.Canceled, <-done)
+	})
+
+	t.Run("bad checkpoint", func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "a.log")
+		appendFile(t, path, "one\n")
+		checkpoint := filepath.Join(dir, "checkpoint.json")
+		require.NoError(t, os.WriteFile(checkpoint, []byte("{"), 0o644))
+
+		var buf bytes.Buffer
+		a := flumetest.NewAgent(t)
+		x := prepareTailer(t, a, &tail.Config{
+			Files:      []string{path},
+			Checkpoint: checkpoint,
+			SkipToEnd:  true,
+			Logger:     logger.NewSlog(slog.New(slog.NewTextHandler(&buf, nil))),
+		})
+		require.Contains(t, buf.String(), "ignoring unreadable checkpoint")
+
+		// Files are read from the beginning because offsets are unknown.
+		require.NoError(t, x.Poll(ctx))
+		a.RequireBodies(t, "one")
+	})
+}
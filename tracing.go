@@ -0,0 +1,78 @@
+package avroipc
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+const tracerName = "github.com/myzhan/avroipc"
+
+// MetaCarrier adapts Avro call metadata to the propagation.TextMapCarrier
+// interface. The client uses it to inject a trace context into metadata of
+// outgoing calls, servers may use it to extract the trace context.
+type MetaCarrier map[string][]byte
+
+var _ propagation.TextMapCarrier = MetaCarrier(nil)
+
+func (m MetaCarrier) Get(key string) string {
+	return string(m[key])
+}
+
+func (m MetaCarrier) Set(key string, value string) {
+	m[key] = []byte(value)
+}
+
+func (m MetaCarrier) Keys() []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+func (c *client) initTracing(config *Config) {
+	provider := config.TracerProvider
+	if provider == nil {
+		provider = noop.NewTracerProvider()
+	}
+	c.tracer = provider.Tracer(tracerName)
+
+	c.propagator = config.Propagator
+	if c.propagator == nil {
+		c.propagator = propagation.TraceContext{}
+	}
+}
+
+func (c *client) startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	tracer := c.tracer
+	if tracer == nil {
+		tracer = noop.NewTracerProvider().Tracer(tracerName)
+	}
+
+	return tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+}
+
+// injectMeta returns call metadata with the trace context of the passed
+// context. It returns nil if there is nothing to propagate.
+func (c *client) injectMeta(ctx context.Context) map[string][]byte {
+	if c.propagator == nil || !trace.SpanContextFromContext(ctx).IsValid() {
+		return nil
+	}
+
+	meta := MetaCarrier{}
+	c.propagator.Inject(ctx, meta)
+	return meta
+}
+
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
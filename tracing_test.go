@@ -0,0 +1,100 @@
+package avroipc_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/myzhan/avroipc"
+	"github.com/myzhan/avroipc/layers"
+	"github.com/myzhan/avroipc/protocols"
+	"github.com/myzhan/avroipc/transports"
+)
+
+func TestMetaCarrier(t *testing.T) {
+	m := avroipc.MetaCarrier{}
+	m.Set("key", "value")
+
+	require.Equal(t, "value", m.Get("key"))
+	require.Equal(t, "", m.Get("unknown"))
+	require.Equal(t, []string{"key"}, m.Keys())
+	require.Equal(t, []byte("value"), m["key"])
+}
+
+func TestClient_tracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	proto := prepareServerProtocol(t)
+	handler := func(method string, datum interface{}) (interface{}, error) {
+		return "OK", nil
+	}
+
+	var session bytes.Buffer
+	dial := avroipc.LoopbackDialer(proto, handler)
+	config := avroipc.NewConfig().
+		WithTracerProvider(provider).
+		WithDialer(func(addr string) (transports.Transport, error) {
+			trans, err := dial(addr)
+			if err != nil {
+				return nil, err
+			}
+			return transports.NewRecording(trans, &session), nil
+		})
+
+	client, err := avroipc.NewClientWithConfig("loopback", proto, config)
+	require.NoError(t, err)
+
+	ctx, parent := provider.Tracer("test").Start(context.Background(), "parent")
+	status, err := avroipc.SendMessageContext(ctx, client, "append", map[string]interface{}{
+		"headers": map[string]interface{}{},
+		"body":    []byte("a"),
+	})
+	parent.End()
+	require.NoError(t, err)
+	require.Equal(t, "OK", status)
+	require.NoError(t, client.Close())
+
+	spans := make(map[string]sdktrace.ReadOnlySpan)
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+	require.Contains(t, spans, "avroipc.handshake")
+
+	send := spans["avroipc.SendMessage"]
+	require.NotNil(t, send)
+	require.Equal(t, parent.SpanContext().SpanID(), send.Parent().SpanID())
+	require.Equal(t, trace.SpanKindClient, send.SpanKind())
+	require.Contains(t, send.Attributes(), attribute.String("rpc.method", "append"))
+	require.Equal(t, send.SpanContext().SpanID(), spans["avroipc.framing.write"].Parent().SpanID())
+	require.Equal(t, send.SpanContext().SpanID(), spans["avroipc.framing.read"].Parent().SpanID())
+
+	// The trace context of the call reaches the server in the call metadata.
+	exchanges, err := transports.ReadExchanges(&session)
+	require.NoError(t, err)
+	require.Len(t, exchanges, 2)
+
+	payload := func(b []byte) []byte {
+		frames, _ := layers.ParseFrames(b)
+		return frames.Payload
+	}
+
+	decoder, err := protocols.NewDecoder(proto)
+	require.NoError(t, err)
+	_, err = decoder.DecodeRequest(payload(exchanges[0].Request))
+	require.NoError(t, err)
+	_, err = decoder.DecodeResponse(payload(exchanges[0].Response))
+	require.NoError(t, err)
+	request, err := decoder.DecodeRequest(payload(exchanges[1].Request))
+	require.NoError(t, err)
+
+	traceparent := fmt.Sprintf("00-%s-%s-01", send.SpanContext().TraceID(), send.SpanContext().SpanID())
+	require.Equal(t, map[string]interface{}{"traceparent": []byte(traceparent)}, request.Meta)
+}
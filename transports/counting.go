@@ -0,0 +1,46 @@
+package transports
+
+import (
+	"sync/atomic"
+)
+
+// Counting is a transport that counts bytes read from and written to the
+// underlying transport.
+type Counting struct {
+	Transport
+
+	read    uint64
+	written uint64
+}
+
+var _ Transport = new(Counting)
+
+func NewCounting(trans Transport) *Counting {
+	return &Counting{
+		Transport: trans,
+	}
+}
+
+func (t *Counting) Read(p []byte) (int, error) {
+	n, err := t.Transport.Read(p)
+	atomic.AddUint64(&t.read, uint64(n))
+	return n, err
+}
+
+func (t *Counting) Write(p []byte) (int, error) {
+	n, err := t.Transport.Write(p)
+	atomic.AddUint64(&t.written, uint64(n))
+	return n, err
+}
+
+// BytesRead returns the total number of bytes read from the underlying
+// transport.
+func (t *Counting) BytesRead() uint64 {
+	return atomic.LoadUint64(&t.read)
+}
+
+// BytesWritten returns the total number of bytes written to the underlying
+// transport.
+func (t *Counting) BytesWritten() uint64 {
+	return atomic.LoadUint64(&t.written)
+}
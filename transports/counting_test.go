@@ -0,0 +1,37 @@
+package transports_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/myzhan/avroipc/mocks"
+	"github.com/stretchr/testify/require"
+
+	"github.com/myzhan/avroipc/transports"
+)
+
+func TestCounting(t *testing.T) {
+	m := &mocks.MockTransport{}
+	c := transports.NewCounting(m)
+
+	b := []byte{0x1, 0x2, 0x3, 0x4}
+	m.On("Write", b).Return(4, nil).Once()
+	m.On("Write", b).Return(1, fmt.Errorf("test error")).Once()
+	m.On("Read", b).Return(3, nil).Once()
+
+	n, err := c.Write(b)
+	require.NoError(t, err)
+	require.Equal(t, 4, n)
+
+	n, err = c.Write(b)
+	require.EqualError(t, err, "test error")
+	require.Equal(t, 1, n)
+
+	n, err = c.Read(b)
+	require.NoError(t, err)
+	require.Equal(t, 3, n)
+
+	require.Equal(t, uint64(5), c.BytesWritten())
+	require.Equal(t, uint64(3), c.BytesRead())
+	m.AssertExpectations(t)
+}
@@ -0,0 +1,191 @@
+package transports
+
+import (
+	"errors"
+	"io"
+	"math/rand"
+	"os"
+	"sync"
+	"time"
+)
+
+// ErrInjectedFault is returned by the faulty transport when it drops the
+// connection.
+var ErrInjectedFault = errors.New("injected fault")
+
+// FaultConfig provides a configuration for the faulty transport. Zero values
+// of all options disable corresponding faults.
+type FaultConfig struct {
+	// A delay before every read and write operation.
+	Latency time.Duration
+
+	// A maximum number of bytes per second transferred in each direction.
+	// Operations are delayed according to the number of transferred bytes.
+	Bandwidth int
+
+	// A number of bytes after which the connection is dropped. The write that
+	// crosses the limit is performed partially and returns ErrInjectedFault
+	// as well as all following operations.
+	DropAfter int64
+
+	// Offsets in the stream of read bytes at which the lowest bit is flipped,
+	// e.g. offsets from 0 to 3 corrupt the serial of the first response.
+	FlipBits []int64
+	// A probability of flipping a random bit in a chunk of read bytes.
+	FlipProbability float64
+
+	// A number of the read operation starting from one that fails with the
+	// os.ErrDeadlineExceeded error as if the read deadline were exceeded.
+	TimeoutOnRead int
+	// A probability of failing a read operation with the
+	// os.ErrDeadlineExceeded error.
+	TimeoutProbability float64
+
+	// A number of the read operation starting from one that closes the
+	// connection and returns io.EOF as if the peer closed it.
+	CloseOnRead int
+
+	// A seed of the random generator for probabilistic faults.
+	//
+	// Defaults to zero which means that the current time is used.
+	Seed int64
+}
+
+// The faulty transport injects faults into operations of the underlying
+// transport. It is supposed to be placed under the framing layer, e.g. by
+// wrapping the socket transport in a dialer passed to the avroipc.Config,
+// to check handling of network failures in tests and staging environments.
+type faulty struct {
+	Transport
+
+	config *FaultConfig
+
+	mu      sync.Mutex
+	rand    *rand.Rand
+	read    int64
+	written int64
+	reads   int
+	dropped bool
+}
+
+// NewFaulty creates a faulty transport on top of the passed transport.
+func NewFaulty(trans Transport, config *FaultConfig) Transport {
+	seed := config.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+
+	return &faulty{
+		Transport: trans,
+		config:    config,
+		rand:      rand.New(rand.NewSource(seed)),
+	}
+}
+
+func (t *faulty) Read(p []byte) (int, error) {
+	t.mu.Lock()
+	if t.dropped {
+		t.mu.Unlock()
+		return 0, ErrInjectedFault
+	}
+	t.reads++
+	reads := t.reads
+	timeout := t.config.TimeoutProbability > 0 && t.rand.Float64() < t.config.TimeoutProbability
+	t.mu.Unlock()
+
+	t.sleep(t.config.Latency)
+
+	if reads == t.config.CloseOnRead {
+		t.drop()
+		return 0, io.EOF
+	}
+	if timeout || reads == t.config.TimeoutOnRead {
+		return 0, os.ErrDeadlineExceeded
+	}
+
+	n, err := t.Transport.Read(p)
+	t.throttle(n)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, offset := range t.config.FlipBits {
+		if offset >= t.read && offset < t.read+int64(n) {
+			p[offset-t.read] ^= 0x1
+		}
+	}
+	if n > 0 && t.config.FlipProbability > 0 && t.rand.Float64() < t.config.FlipProbability {
+		p[t.rand.Intn(n)] ^= 1 << uint(t.rand.Intn(8))
+	}
+	t.read += int64(n)
+
+	return n, err
+}
+
+func (t *faulty) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	if t.dropped {
+		t.mu.Unlock()
+		return 0, ErrInjectedFault
+	}
+
+	drop := false
+	if t.config.DropAfter > 0 && t.written+int64(len(p)) > t.config.DropAfter {
+		p = p[:t.config.DropAfter-t.written]
+		drop = true
+	}
+	t.mu.Unlock()
+
+	t.sleep(t.config.Latency)
+
+	n, err := t.Transport.Write(p)
+	t.throttle(n)
+
+	t.mu.Lock()
+	t.written += int64(n)
+	t.mu.Unlock()
+
+	if err != nil {
+		return n, err
+	}
+	if drop {
+		t.drop()
+		return n, ErrInjectedFault
+	}
+
+	return n, nil
+}
+
+func (t *faulty) drop() {
+	t.mu.Lock()
+	t.dropped = true
+	t.mu.Unlock()
+
+	_ = t.Transport.Close()
+}
+
+// Close closes the underlying transport unless the connection is already
+// dropped.
+func (t *faulty) Close() error {
+	t.mu.Lock()
+	dropped := t.dropped
+	t.mu.Unlock()
+
+	if dropped {
+		return nil
+	}
+
+	return t.Transport.Close()
+}
+
+func (t *faulty) throttle(n int) {
+	if t.config.Bandwidth > 0 {
+		t.sleep(time.Duration(n) * time.Second / time.Duration(t.config.Bandwidth))
+	}
+}
+
+func (t *faulty) sleep(d time.Duration) {
+	if d > 0 {
+		time.Sleep(d)
+	}
+}
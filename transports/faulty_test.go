@@ -0,0 +1,153 @@
+package transports_test
+
+import (
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/myzhan/avroipc/mocks"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/myzhan/avroipc/transports"
+)
+
+func prepareFaulty(config *transports.FaultConfig) (transports.Transport, *mocks.MockTransport) {
+	m := &mocks.MockTransport{}
+	f := transports.NewFaulty(m, config)
+
+	return f, m
+}
+
+func mockRead(m *mocks.MockTransport, data []byte) {
+	m.On("Read", mock.Anything).Return(len(data), nil).Once().Run(func(args mock.Arguments) {
+		copy(args[0].([]byte), data)
+	})
+}
+
+func TestFaulty(t *testing.T) {
+	data := []byte{0x0, 0x0, 0x0, 0x1}
+
+	t.Run("no faults", func(t *testing.T) {
+		f, m := prepareFaulty(&transports.FaultConfig{})
+
+		m.On("Write", data).Return(4, nil).Once()
+		mockRead(m, data)
+		m.On("Close").Return(nil).Once()
+
+		n, err := f.Write(data)
+		require.NoError(t, err)
+		require.Equal(t, 4, n)
+
+		b := make([]byte, 4)
+		n, err = f.Read(b)
+		require.NoError(t, err)
+		require.Equal(t, data, b[:n])
+
+		require.NoError(t, f.Close())
+		m.AssertExpectations(t)
+	})
+
+	t.Run("latency and bandwidth", func(t *testing.T) {
+		f, m := prepareFaulty(&transports.FaultConfig{
+			Latency:   10 * time.Millisecond,
+			Bandwidth: 100,
+		})
+
+		m.On("Write", data).Return(4, nil).Once()
+
+		start := time.Now()
+		_, err := f.Write(data)
+		require.NoError(t, err)
+		require.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+		m.AssertExpectations(t)
+	})
+
+	t.Run("drop after", func(t *testing.T) {
+		f, m := prepareFaulty(&transports.FaultConfig{DropAfter: 6})
+
+		m.On("Write", data).Return(4, nil).Once()
+		m.On("Write", data[:2]).Return(2, nil).Once()
+		m.On("Close").Return(nil).Once()
+
+		n, err := f.Write(data)
+		require.NoError(t, err)
+		require.Equal(t, 4, n)
+
+		n, err = f.Write(data)
+		require.Equal(t, transports.ErrInjectedFault, err)
+		require.Equal(t, 2, n)
+
+		_, err = f.Write(data)
+		require.Equal(t, transports.ErrInjectedFault, err)
+		_, err = f.Read(make([]byte, 4))
+		require.Equal(t, transports.ErrInjectedFault, err)
+
+		require.NoError(t, f.Close())
+		m.AssertExpectations(t)
+	})
+
+	t.Run("flip bits", func(t *testing.T) {
+		f, m := prepareFaulty(&transports.FaultConfig{FlipBits: []int64{3, 5}})
+
+		mockRead(m, data)
+		mockRead(m, data)
+
+		b := make([]byte, 4)
+		_, err := f.Read(b)
+		require.NoError(t, err)
+		require.Equal(t, []byte{0x0, 0x0, 0x0, 0x0}, b)
+
+		_, err = f.Read(b)
+		require.NoError(t, err)
+		require.Equal(t, []byte{0x0, 0x1, 0x0, 0x1}, b)
+		m.AssertExpectations(t)
+	})
+
+	t.Run("flip probability", func(t *testing.T) {
+		f, m := prepareFaulty(&transports.FaultConfig{FlipProbability: 1, Seed: 1})
+
+		mockRead(m, data)
+
+		b := make([]byte, 4)
+		_, err := f.Read(b)
+		require.NoError(t, err)
+		require.NotEqual(t, data, b)
+		m.AssertExpectations(t)
+	})
+
+	t.Run("timeout on read", func(t *testing.T) {
+		f, m := prepareFaulty(&transports.FaultConfig{TimeoutOnRead: 2})
+
+		mockRead(m, data)
+
+		_, err := f.Read(make([]byte, 4))
+		require.NoError(t, err)
+
+		_, err = f.Read(make([]byte, 4))
+		require.ErrorIs(t, err, os.ErrDeadlineExceeded)
+		m.AssertExpectations(t)
+	})
+
+	t.Run("timeout probability", func(t *testing.T) {
+		f, m := prepareFaulty(&transports.FaultConfig{TimeoutProbability: 1})
+
+		_, err := f.Read(make([]byte, 4))
+		require.ErrorIs(t, err, os.ErrDeadlineExceeded)
+		m.AssertExpectations(t)
+	})
+
+	t.Run("close on read", func(t *testing.T) {
+		f, m := prepareFaulty(&transports.FaultConfig{CloseOnRead: 1})
+
+		m.On("Close").Return(nil).Once()
+
+		_, err := f.Read(make([]byte, 4))
+		require.Equal(t, io.EOF, err)
+
+		_, err = f.Read(make([]byte, 4))
+		require.Equal(t, transports.ErrInjectedFault, err)
+		m.AssertExpectations(t)
+	})
+}
@@ -0,0 +1,45 @@
+package transports
+
+import (
+	"bytes"
+	"net"
+)
+
+// The conn transport wraps an established connection and buffers written
+// data until flushing.
+type conn struct {
+	net.Conn
+
+	wb bytes.Buffer
+}
+
+// NewConn creates a transport for an established connection, e.g. a
+// connection accepted by a server. Written data is buffered and sent to the
+// connection on flushing.
+func NewConn(c net.Conn) Transport {
+	return &conn{
+		Conn: c,
+	}
+}
+
+// NewPipe creates a pair of in-memory transports built on the net.Pipe. Data
+// written to one of them is buffered until flushing and then may be read from
+// another one. Both ends support deadlines.
+func NewPipe() (Transport, Transport) {
+	c1, c2 := net.Pipe()
+	return NewConn(c1), NewConn(c2)
+}
+
+func (t *conn) Write(p []byte) (int, error) {
+	return t.wb.Write(p)
+}
+
+func (t *conn) Flush() error {
+	if t.wb.Len() == 0 {
+		return nil
+	}
+
+	_, err := t.Conn.Write(t.wb.Bytes())
+	t.wb.Reset()
+	return err
+}
@@ -0,0 +1,38 @@
+package transports_test
+
+import (
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/myzhan/avroipc/transports"
+)
+
+func TestPipe(t *testing.T) {
+	client, server := transports.NewPipe()
+
+	data := []byte{0x1, 0x2, 0x3, 0x4}
+	done := make(chan []byte)
+	go func() {
+		b := make([]byte, len(data))
+		_, err := io.ReadFull(server, b)
+		require.NoError(t, err)
+		done <- b
+	}()
+
+	// Nothing is sent until flushing.
+	_, err := client.Write(data[:2])
+	require.NoError(t, err)
+	_, err = client.Write(data[2:])
+	require.NoError(t, err)
+	require.NoError(t, client.Flush())
+	require.Equal(t, data, <-done)
+
+	// Empty flushes don't block.
+	require.NoError(t, client.Flush())
+
+	require.NoError(t, client.Close())
+	_, err = server.Read(make([]byte, 1))
+	require.Equal(t, io.EOF, err)
+}
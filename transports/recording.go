@@ -0,0 +1,148 @@
+package transports
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"sync"
+)
+
+// Exchange is a single request written to a transport and a response read
+// from it after that.
+type Exchange struct {
+	// A serial number of the request that is taken from the first four bytes
+	// of the request. It is informational only and is meaningless if the
+	// request is compressed or encrypted.
+	Serial uint32 `json:"serial"`
+	// Bytes written to the transport between two flushes.
+	Request []byte `json:"request"`
+	// Bytes read from the transport after flushing the request until
+	// writing the next one.
+	Response []byte `json:"response"`
+}
+
+// ReadExchanges reads a session written by the recording transport. The
+// session is a sequence of exchanges encoded as JSON objects one per line.
+func ReadExchanges(r io.Reader) ([]Exchange, error) {
+	var exchanges []Exchange
+
+	d := json.NewDecoder(bufio.NewReader(r))
+	for {
+		var e Exchange
+		err := d.Decode(&e)
+		if err == io.EOF {
+			return exchanges, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		exchanges = append(exchanges, e)
+	}
+}
+
+// The recording transport writes all exchanges with the underlying transport
+// to a writer. The recorded session may be served back by the replay
+// transport.
+type recording struct {
+	Transport
+
+	mu      sync.Mutex
+	encoder *json.Encoder
+
+	wb      bytes.Buffer
+	rb      bytes.Buffer
+	request []byte
+	flushed bool
+}
+
+// NewRecording creates a recording transport on top of the passed transport.
+// Every exchange is written to the writer as soon as it is completed, the
+// last one is written when the transport is closed.
+//
+// To record raw requests and responses of a client place the transport under
+// all other transports, e.g. by wrapping the socket transport in a dialer
+// passed to the avroipc.Config.
+func NewRecording(trans Transport, w io.Writer) Transport {
+	return &recording{
+		Transport: trans,
+		encoder:   json.NewEncoder(w),
+	}
+}
+
+func (t *recording) Read(p []byte) (int, error) {
+	n, err := t.Transport.Read(p)
+
+	t.mu.Lock()
+	t.rb.Write(p[:n])
+	t.mu.Unlock()
+
+	return n, err
+}
+
+func (t *recording) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.flushed {
+		err := t.record()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := t.Transport.Write(p)
+	t.wb.Write(p[:n])
+	return n, err
+}
+
+func (t *recording) Flush() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.wb.Len() > 0 {
+		if t.flushed {
+			err := t.record()
+			if err != nil {
+				return err
+			}
+		}
+
+		t.request = append([]byte(nil), t.wb.Bytes()...)
+		t.wb.Reset()
+		t.flushed = true
+	}
+
+	return t.Transport.Flush()
+}
+
+func (t *recording) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.flushed || t.rb.Len() > 0 {
+		err := t.record()
+		if err != nil {
+			return err
+		}
+	}
+
+	return t.Transport.Close()
+}
+
+func (t *recording) record() error {
+	e := Exchange{
+		Request:  t.request,
+		Response: append([]byte(nil), t.rb.Bytes()...),
+	}
+	if len(e.Request) >= 4 {
+		e.Serial = binary.BigEndian.Uint32(e.Request)
+	}
+
+	t.request = nil
+	t.rb.Reset()
+	t.flushed = false
+
+	return t.encoder.Encode(&e)
+}
@@ -0,0 +1,63 @@
+package transports_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/myzhan/avroipc/mocks"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/myzhan/avroipc/transports"
+)
+
+func TestRecording(t *testing.T) {
+	request1 := []byte{0x0, 0x0, 0x0, 0x1, 0xA}
+	request2 := []byte{0x0, 0x0, 0x0, 0x2, 0xB}
+	response1 := []byte{0x0, 0x0, 0x0, 0x1, 0xC}
+	response2 := []byte{0x0, 0x0, 0x0, 0x2, 0xD}
+
+	m := &mocks.MockTransport{}
+	w := &bytes.Buffer{}
+	r := transports.NewRecording(m, w)
+
+	for _, e := range []struct{ request, response []byte }{
+		{request1, response1},
+		{request2, response2},
+	} {
+		func(request, response []byte) {
+			m.On("Write", request[:2]).Return(2, nil).Once()
+			m.On("Write", request[2:]).Return(3, nil).Once()
+			m.On("Flush").Return(nil).Once()
+			m.On("Read", make([]byte, len(response))).Return(len(response), nil).Once().Run(func(args mock.Arguments) {
+				copy(args[0].([]byte), response)
+			})
+
+			_, err := r.Write(request[:2])
+			require.NoError(t, err)
+			_, err = r.Write(request[2:])
+			require.NoError(t, err)
+			require.NoError(t, r.Flush())
+			_, err = r.Read(make([]byte, len(response)))
+			require.NoError(t, err)
+		}(e.request, e.response)
+	}
+
+	// The first exchange is written when the second request is started.
+	expected := `{"serial":1,"request":"AAAAAQo=","response":"AAAAAQw="}` + "\n"
+	require.Equal(t, expected, w.String())
+
+	m.On("Close").Return(nil).Once()
+	require.NoError(t, r.Close())
+
+	expected += `{"serial":2,"request":"AAAAAgs=","response":"AAAAAg0="}` + "\n"
+	require.Equal(t, expected, w.String())
+
+	exchanges, err := transports.ReadExchanges(w)
+	require.NoError(t, err)
+	require.Equal(t, []transports.Exchange{
+		{Serial: 1, Request: request1, Response: response1},
+		{Serial: 2, Request: request2, Response: response2},
+	}, exchanges)
+	m.AssertExpectations(t)
+}
@@ -0,0 +1,149 @@
+package transports
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+// ErrReplayExhausted is returned by the replay transport when a client sends
+// more requests than there are in the replayed session.
+var ErrReplayExhausted = errors.New("replay session is exhausted")
+
+// MismatchError is returned by the replay transport when a request sent by
+// a client differs from the recorded one.
+type MismatchError struct {
+	// An index of the exchange in the session.
+	Index int
+	// A recorded request.
+	Expected []byte
+	// A request sent by the client.
+	Actual []byte
+}
+
+func (e *MismatchError) Error() string {
+	return fmt.Sprintf("request %d mismatch: expected %x, actual %x", e.Index, e.Expected, e.Actual)
+}
+
+// ReplayConfig provides a configuration for the replay transport.
+type ReplayConfig struct {
+	// Skip comparison of sent requests with recorded ones. It is useful when
+	// requests contain data that changes every time like timestamps.
+	SkipVerification bool
+
+	// Used to compare sent requests with recorded ones.
+	//
+	// Defaults to nil which means that requests are compared byte by byte.
+	// Avro maps like event headers and call metadata are encoded in random
+	// order, so requests with maps of several entries should be compared by
+	// a comparer returned by the layers.NewRequestComparer function.
+	Equal func(expected, actual []byte) bool
+}
+
+type replayAddr struct{}
+
+func (replayAddr) Network() string { return "replay" }
+func (replayAddr) String() string  { return "replay" }
+
+// The replay transport serves responses of a recorded session back to a
+// client without connecting to any server. It may be used instead of the
+// socket transport in tests.
+type replay struct {
+	exchanges []Exchange
+	index     int
+	verify    bool
+	equal     func(expected, actual []byte) bool
+
+	wb bytes.Buffer
+	rb bytes.Reader
+}
+
+// NewReplay creates a replay transport for a session written by the
+// recording transport.
+func NewReplay(r io.Reader) (Transport, error) {
+	return NewReplayWithConfig(r, &ReplayConfig{})
+}
+
+// NewReplayWithConfig creates a replay transport with considering values of
+// options from the passed configuration object.
+func NewReplayWithConfig(r io.Reader, config *ReplayConfig) (Transport, error) {
+	exchanges, err := ReadExchanges(r)
+	if err != nil {
+		return nil, err
+	}
+
+	equal := config.Equal
+	if equal == nil {
+		equal = bytes.Equal
+	}
+
+	return &replay{
+		exchanges: exchanges,
+		verify:    !config.SkipVerification,
+		equal:     equal,
+	}, nil
+}
+
+// Read returns bytes of the response to the last flushed request and io.EOF
+// after all of them are read.
+func (t *replay) Read(p []byte) (int, error) {
+	return t.rb.Read(p)
+}
+
+func (t *replay) Write(p []byte) (int, error) {
+	return t.wb.Write(p)
+}
+
+// Flush takes the next exchange of the session and verifies that the written
+// request matches the recorded one.
+func (t *replay) Flush() error {
+	if t.wb.Len() == 0 {
+		return nil
+	}
+	defer t.wb.Reset()
+
+	if t.index >= len(t.exchanges) {
+		return ErrReplayExhausted
+	}
+	e := t.exchanges[t.index]
+	t.index++
+
+	if t.verify && !t.equal(e.Request, t.wb.Bytes()) {
+		return &MismatchError{
+			Index:    t.index - 1,
+			Expected: e.Request,
+			Actual:   append([]byte(nil), t.wb.Bytes()...),
+		}
+	}
+
+	t.rb.Reset(e.Response)
+	return nil
+}
+
+// Close does nothing to allow reusing the transport for reconnections.
+func (t *replay) Close() error {
+	return nil
+}
+
+func (t *replay) LocalAddr() net.Addr {
+	return replayAddr{}
+}
+
+func (t *replay) RemoteAddr() net.Addr {
+	return replayAddr{}
+}
+
+func (t *replay) SetDeadline(time.Time) error {
+	return nil
+}
+
+func (t *replay) SetReadDeadline(time.Time) error {
+	return nil
+}
+
+func (t *replay) SetWriteDeadline(time.Time) error {
+	return nil
+}
@@ -0,0 +1,92 @@
+package transports_test
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/myzhan/avroipc/transports"
+)
+
+const session = `{"serial":1,"request":"AAAAAQo=","response":"AAAAAQw="}
+{"serial":2,"request":"AAAAAgs=","response":"AAAAAg0="}
+`
+
+func TestReplay(t *testing.T) {
+	request1 := []byte{0x0, 0x0, 0x0, 0x1, 0xA}
+	request2 := []byte{0x0, 0x0, 0x0, 0x2, 0xB}
+	response1 := []byte{0x0, 0x0, 0x0, 0x1, 0xC}
+	response2 := []byte{0x0, 0x0, 0x0, 0x2, 0xD}
+
+	t.Run("succeed", func(t *testing.T) {
+		r, err := transports.NewReplay(strings.NewReader(session))
+		require.NoError(t, err)
+
+		for _, e := range []struct{ request, response []byte }{
+			{request1, response1},
+			{request2, response2},
+		} {
+			_, err = r.Write(e.request)
+			require.NoError(t, err)
+			require.NoError(t, r.Flush())
+
+			actual, err := io.ReadAll(r)
+			require.NoError(t, err)
+			require.Equal(t, e.response, actual)
+		}
+
+		_, err = r.Write(request1)
+		require.NoError(t, err)
+		require.Equal(t, transports.ErrReplayExhausted, r.Flush())
+		require.NoError(t, r.Close())
+	})
+
+	t.Run("mismatch", func(t *testing.T) {
+		r, err := transports.NewReplay(strings.NewReader(session))
+		require.NoError(t, err)
+
+		_, err = r.Write(request2)
+		require.NoError(t, err)
+		err = r.Flush()
+		require.EqualError(t, err, "request 0 mismatch: expected 000000010a, actual 000000020b")
+		require.IsType(t, &transports.MismatchError{}, err)
+	})
+
+	t.Run("skip verification", func(t *testing.T) {
+		r, err := transports.NewReplayWithConfig(strings.NewReader(session), &transports.ReplayConfig{
+			SkipVerification: true,
+		})
+		require.NoError(t, err)
+
+		_, err = r.Write(request2)
+		require.NoError(t, err)
+		require.NoError(t, r.Flush())
+
+		actual, err := io.ReadAll(r)
+		require.NoError(t, err)
+		require.Equal(t, response1, actual)
+	})
+
+	t.Run("custom comparison", func(t *testing.T) {
+		var compared [][]byte
+		r, err := transports.NewReplayWithConfig(strings.NewReader(session), &transports.ReplayConfig{
+			Equal: func(expected, actual []byte) bool {
+				compared = append(compared, expected, actual)
+				return true
+			},
+		})
+		require.NoError(t, err)
+
+		_, err = r.Write(request2)
+		require.NoError(t, err)
+		require.NoError(t, r.Flush())
+		require.Equal(t, [][]byte{request1, request2}, compared)
+	})
+
+	t.Run("bad session", func(t *testing.T) {
+		_, err := transports.NewReplay(strings.NewReader("bad session"))
+		require.Error(t, err)
+	})
+}
@@ -3,27 +3,69 @@ package transports
 import (
 	"net"
 	"time"
+
+	"github.com/myzhan/avroipc/logger"
 )
 
+// SocketConfig provides a configuration for the socket transport.
+type SocketConfig struct {
+	// A connection timeout. Zero means no timeout.
+	Timeout time.Duration
+
+	// A period between TCP keep-alive probes. Zero means that the default
+	// period of the net package is used, negative value disables keep-alive
+	// probes.
+	KeepAlive time.Duration
+
+	// A logger for debug messages about opened and closed connections.
+	// Nil means that messages are discarded.
+	Logger logger.Logger
+}
+
 type socket struct {
 	net.Conn
+
+	logger logger.Logger
 }
 
 func NewSocket(hostPort string, timeout time.Duration) (Transport, error) {
+	return NewSocketWithConfig(hostPort, &SocketConfig{
+		Timeout: timeout,
+	})
+}
+
+// NewSocketWithConfig creates a socket transport with considering values of
+// options from the passed configuration object.
+func NewSocketWithConfig(hostPort string, config *SocketConfig) (Transport, error) {
 	addr, err := net.ResolveTCPAddr("tcp", hostPort)
 	if err != nil {
 		return nil, err
 	}
 
-	s := &socket{}
-	s.Conn, err = net.DialTimeout(addr.Network(), addr.String(), timeout)
+	d := &net.Dialer{
+		Timeout:   config.Timeout,
+		KeepAlive: config.KeepAlive,
+	}
+
+	s := &socket{
+		logger: logger.OrNop(config.Logger),
+	}
+	s.Conn, err = d.Dial(addr.Network(), addr.String())
 	if err != nil {
 		return nil, err
 	}
 
+	s.logger.Debug("connected", "local", s.LocalAddr().String(), "remote", s.RemoteAddr().String())
+
 	return s, nil
 }
 
+func (s *socket) Close() error {
+	s.logger.Debug("closing", "local", s.LocalAddr().String(), "remote", s.RemoteAddr().String())
+
+	return s.Conn.Close()
+}
+
 func (s *socket) Flush() error {
 	return nil
 }
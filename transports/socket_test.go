@@ -9,6 +9,7 @@ import (
 
 	"github.com/stretchr/testify/require"
 
+	"github.com/myzhan/avroipc/flumetest"
 	"github.com/myzhan/avroipc/internal"
 	"github.com/myzhan/avroipc/transports"
 )
@@ -30,7 +31,7 @@ func handler(conn net.Conn) error {
 }
 
 func prepareSocket(t *testing.T) (transports.Transport, func() error) {
-	addr, clean := internal.RunServer(t, handler)
+	addr, clean := flumetest.RunServer(t, handler)
 
 	trans, err := transports.NewSocket(addr, time.Second)
 	require.NoError(t, err)
@@ -59,7 +60,7 @@ func TestSocket(t *testing.T) {
 
 	// TODO Use a more robust method to test timeout errors
 	t.Run("timeout", func(t *testing.T) {
-		addr, clean := internal.RunServer(t, handler)
+		addr, clean := flumetest.RunServer(t, handler)
 
 		_, err := transports.NewSocket(addr, 1)
 		require.Error(t, err)
@@ -98,6 +99,30 @@ func TestSocket(t *testing.T) {
 		require.NoError(t, trans.Close())
 	})
 
+	t.Run("keep-alive", func(t *testing.T) {
+		addr, clean := flumetest.RunServer(t, handler)
+
+		for _, d := range []time.Duration{-1, 0, time.Second} {
+			trans, err := transports.NewSocketWithConfig(addr, &transports.SocketConfig{
+				Timeout:   time.Second,
+				KeepAlive: d,
+			})
+			require.NoError(t, err)
+
+			_, err = trans.Write([]byte("ping\n"))
+			require.NoError(t, err)
+
+			b := &internal.Buffer{}
+			err = b.ReadFrom(trans)
+			require.NoError(t, err)
+			require.Equal(t, []byte("pong"), b.Bytes())
+
+			require.NoError(t, trans.Close())
+		}
+
+		require.NoError(t, clean())
+	})
+
 	t.Run("close multiple times", func(t *testing.T) {
 		trans, clean := prepareSocket(t)
 